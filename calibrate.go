@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"slowfs/slowfs"
+	"slowfs/slowfs/calibrate"
+	"slowfs/slowfs/units"
+)
+
+// calibrateMain implements the calibrate command, which measures a real disk and prints a config
+// file describing it.
+func calibrateMain(args []string) {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory on the disk to measure")
+	name := fs.String("name", "calibrated", "name of the generated device config")
+	output := fs.String("output", "", "path to write the config file to, instead of standard output")
+	fileSize := fs.String("file-size", "256MiB", "size of the file used to "+
+		"measure throughput; should be much larger than the disk's cache")
+	blockSize := fs.String("block-size", "1MiB", "size of each read and "+
+		"write when measuring throughput")
+	randomOps := fs.Int("random-ops", calibrate.DefaultOptions.RandomOps, "number of accesses to time when "+
+		"measuring random access")
+	metadataOps := fs.Int("metadata-ops", calibrate.DefaultOptions.MetadataOps, "number of files to create, "+
+		"stat and remove when measuring metadata operations")
+	fs.Parse(args)
+
+	if *dir == "" {
+		log.Fatalf("argument dir is required.")
+	}
+
+	opts := calibrate.Options{
+		Dir:         *dir,
+		RandomOps:   *randomOps,
+		MetadataOps: *metadataOps,
+	}
+	var err error
+	if opts.FileSize, err = units.ParseNumBytesFromString(*fileSize); err != nil {
+		log.Fatalf("flag file-size: %s", err)
+	}
+	if opts.BlockSize, err = units.ParseNumBytesFromString(*blockSize); err != nil {
+		log.Fatalf("flag block-size: %s", err)
+	}
+
+	m, err := calibrate.Measure(opts)
+	if err != nil {
+		log.Fatalf("couldn't measure %s: %s", *dir, err)
+	}
+	config := m.DeviceConfig(*name)
+	if err := config.Validate(); err != nil {
+		log.Fatalf("measurements gave an invalid config: %s", err)
+	}
+
+	data, err := json.MarshalIndent([]*slowfs.DeviceConfig{config}, "", "  ")
+	if err != nil {
+		log.Fatalf("couldn't encode config: %s", err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		fmt.Print(string(data))
+		return
+	}
+	if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+		log.Fatalf("couldn't write config file: %s", err)
+	}
+}
@@ -19,40 +19,61 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"os"
 	"path/filepath"
 	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/control"
+	"slowfs/slowfs/crash"
+	"slowfs/slowfs/fault"
 	"slowfs/slowfs/fuselayer"
+	"slowfs/slowfs/metrics"
 	"slowfs/slowfs/scheduler"
-	"slowfs/slowfs/units"
+	"slowfs/slowfs/trace"
+	"strings"
 	"time"
 
+	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
 	"github.com/hanwen/go-fuse/fuse/pathfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
-	configs := map[string]*slowfs.DeviceConfig{
-		slowfs.HDD7200RpmDeviceConfig.Name: &slowfs.HDD7200RpmDeviceConfig,
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			simulateMain(os.Args[2:])
+			return
+		case "calibrate":
+			calibrateMain(os.Args[2:])
+			return
+		}
 	}
 
 	backingDir := flag.String("backing-dir", "", "directory to use as storage")
 	mountDir := flag.String("mount-dir", "", "directory to mount at")
 
-	configFile := flag.String("config-file", "", "path to config file listing device configurations")
-	configName := flag.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm)")
-
-	// Flags for overriding any subset of the config. These are all strings (even the durations)
-	// because we need to differentiate between the flag not being specified, and being set to the
-	// default value.
-	seekWindow := flag.String("seek-window", "", "")
-	seekTime := flag.String("seek-time", "", "")
-	readBytesPerSecond := flag.String("read-bytes-per-second", "", "")
-	writeBytesPerSecond := flag.String("write-bytes-per-second", "", "")
-	allocateBytesPerSecond := flag.String("allocate-bytes-per-second", "", "")
-	requestReorderMaxDelay := flag.String("request-reorder-max-delay", "", "")
-	fsyncStrategy := flag.String("fsync-strategy", "", "choice of none/no, dumb, writebackcache/wbc")
-	writeStrategy := flag.String("write-strategy", "", "choice of fast, simulate")
-	metadataOpTime := flag.String("metadata-op-time", "", "duration value (e.g. 10ms)")
+	controlSocket := flag.String("control-socket", "", "path to a Unix socket to listen on for commands "+
+		"that change the device config while mounted")
+	metricsAddress := flag.String("metrics-address", "", "address to serve Prometheus metrics on at /metrics "+
+		"(e.g. localhost:9100)")
+	faultFile := flag.String("fault-file", "", "path to a file listing rules for operations that should fail")
+	faultSeed := flag.Int64("fault-seed", 1, "seed for deciding which operations fail when rules have a Probability")
+	simulateCrashes := flag.Bool("simulate-crashes", false, "record unpersisted writes so that a power cut can "+
+		"be simulated through the control socket")
+	crashSeed := flag.Int64("crash-seed", 1, "seed for choosing torn and reordered writes in power cuts")
+	traceFile := flag.String("trace-file", "", "path to write a trace of every request to")
+	traceFormat := flag.String("trace-format", "json", "format of the trace: choice of json, binary")
+	computeOnly := flag.Bool("compute-only", false, "don't actually wait; instead report how long the workload would have "+
+		"taken when unmounted, assuming it's single threaded")
+	routes := flag.String("routes", "", "comma separated list of path=config-name rules putting different paths on "+
+		"different devices (e.g. wal=nvme,data=hdd7200rpm); paths no rule matches aren't slowed down, and "+
+		"config overrides from flags apply to every device")
+
+	deviceFlags := addDeviceFlags(flag.CommandLine)
 	flag.Parse()
 
 	if *backingDir == "" || *mountDir == "" {
@@ -75,99 +96,278 @@ func main() {
 		log.Fatalf("backing directory may not be the same as mount directory.")
 	}
 
-	if *configFile != "" {
-		data, err := ioutil.ReadFile(*configFile)
+	configs := deviceFlags.configs()
+
+	var faultRules []*fault.Rule
+	if *faultFile != "" {
+		data, err := ioutil.ReadFile(*faultFile)
 		if err != nil {
-			log.Fatalf("couldn't read config file %s: %s", *configFile, err)
+			log.Fatalf("couldn't read fault file %s: %s", *faultFile, err)
 		}
-		dcs, err := slowfs.ParseDeviceConfigsFromJSON(data)
+		faultRules, err = fault.ParseRulesFromJSON(data)
 		if err != nil {
-			log.Fatalf("couldn't parse config file %s: %s", *configFile, err)
-		}
-		for _, dc := range dcs {
-			if _, ok := configs[dc.Name]; ok {
-				log.Fatalf("duplicate device config with name '%s'", dc.Name)
-			}
-			configs[dc.Name] = dc
+			log.Fatalf("couldn't parse fault file %s: %s", *faultFile, err)
 		}
 	}
+	faults := fault.NewInjector(faultRules, *faultSeed)
 
-	config, ok := configs[*configName]
-
-	if !ok {
-		log.Fatalf("unknown config %s", *configName)
+	var clk clock.Clock = clock.RealClock{}
+	start := time.Now()
+	if *computeOnly {
+		clk = clock.NewSimulatedClock(start)
 	}
+	router, devices := newRouter(deviceFlags, configs, *routes, clk)
 
-	flagsHadError := false
+	var journal *crash.Journal
+	if *simulateCrashes {
+		journal = crash.NewJournal(*backingDir, router, *crashSeed)
+	}
 
-	if *seekWindow != "" {
-		config.SeekWindow, err = units.ParseNumBytesFromString(*seekWindow)
+	if *traceFile != "" {
+		format, err := trace.ParseFormatFromString(*traceFormat)
 		if err != nil {
-			log.Printf("flag seek-window: %s", err)
-			flagsHadError = true
+			log.Fatalf("flag trace-format: %s", err)
 		}
-	}
-
-	if *seekTime != "" {
-		config.SeekTime, err = time.ParseDuration(*seekTime)
+		f, err := os.Create(*traceFile)
 		if err != nil {
-			log.Printf("flag seek-time: %s", err)
-			flagsHadError = true
+			log.Fatalf("couldn't create trace file: %s", err)
 		}
-	}
-
-	if *readBytesPerSecond != "" {
-		config.ReadBytesPerSecond, err = units.ParseNumBytesFromString(*readBytesPerSecond)
+		defer f.Close()
+		traceWriter, err := trace.NewWriter(f, format)
 		if err != nil {
-			log.Printf("flag read-bytes-per-second: %s", err)
-			flagsHadError = true
+			log.Fatalf("couldn't write trace file: %s", err)
 		}
+		for _, d := range devices {
+			d.scheduler.AddObserver(traceWriter)
+		}
+		defer func() {
+			if err := traceWriter.Flush(); err != nil {
+				log.Printf("couldn't write trace file: %s", err)
+			}
+		}()
 	}
 
-	if *writeBytesPerSecond != "" {
-		config.WriteBytesPerSecond, err = units.ParseNumBytesFromString(*writeBytesPerSecond)
-		if err != nil {
-			log.Printf("flag write-bytes-per-second: %s", err)
-			flagsHadError = true
+	if *metricsAddress != "" {
+		registry := prometheus.NewRegistry()
+		if *routes == "" {
+			registry.MustRegister(metrics.New(devices[0].scheduler))
+		} else {
+			// Tell each device's metrics apart by the name of its config.
+			for _, d := range devices {
+				labels := prometheus.Labels{"device": d.name}
+				prometheus.WrapRegistererWith(labels, registry).MustRegister(metrics.New(d.scheduler))
+			}
 		}
+		http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		go func() {
+			log.Fatalf("metrics server: %s", http.ListenAndServe(*metricsAddress, nil))
+		}()
 	}
 
-	if *allocateBytesPerSecond != "" {
-		config.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(*allocateBytesPerSecond)
+	if *controlSocket != "" {
+		controlServer, err := control.NewServer(*controlSocket, devices[0].scheduler, configs, faults, journal)
 		if err != nil {
-			log.Printf("flag allocate-bytes-per-second: %s", err)
-			flagsHadError = true
+			log.Fatalf("couldn't start control server: %s", err)
 		}
+		if *routes != "" {
+			for _, d := range devices {
+				controlServer.AddDevice(d.name, d.scheduler)
+			}
+		}
+		defer controlServer.Close()
+		go controlServer.Serve()
 	}
 
-	if *requestReorderMaxDelay != "" {
-		config.RequestReorderMaxDelay, err = time.ParseDuration(*requestReorderMaxDelay)
-		if err != nil {
-			log.Printf("flag request-reorder-max-delay: %s", err)
-			flagsHadError = true
+	sfs := fuselayer.NewRoutedSlowFs(*backingDir, router, faults, journal)
+	conn := nodefs.NewFileSystemConnector(pathfs.NewPathNodeFs(sfs, nil).Root(), nil)
+	server, err := fuse.NewServer(fuselayer.NewRawFileSystem(conn.RawFS(), sfs), *mountDir, &fuse.MountOptions{})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	server.Serve()
+
+	if *computeOnly {
+		fmt.Printf("simulated time taken: %s\n", clk.Since(start))
+	}
+}
+
+// device is a scheduler for one of the devices the filesystem is on, along with the name of its
+// config.
+type device struct {
+	name      string
+	scheduler *scheduler.Scheduler
+}
+
+// newRouter creates a router for the given routes flag, with a scheduler for each device config
+// it names, and returns it along with the devices in the order they are first named. Without
+// routes, everything is on the device chosen by the device flags.
+func newRouter(df *deviceFlags, configs map[string]*slowfs.DeviceConfig, routes string,
+	clk clock.Clock) (*scheduler.Router, []device) {
+	if routes == "" {
+		config := df.config(configs, *df.configName)
+		fmt.Printf("using config: %s\n", config)
+		s := scheduler.NewWithClock(config, clk)
+		router, _ := scheduler.NewRouter(clk, nil, s)
+		return router, []device{{config.Name, s}}
+	}
+
+	var devices []device
+	var schedulerRoutes []scheduler.Route
+	byName := make(map[string]*scheduler.Scheduler)
+	for _, rule := range strings.Split(routes, ",") {
+		idx := strings.LastIndex(rule, "=")
+		if idx < 0 {
+			log.Fatalf("flag routes: expected path=config-name, got %s", rule)
+		}
+		pattern, name := rule[:idx], rule[idx+1:]
+		s, ok := byName[name]
+		if !ok {
+			config := df.config(configs, name)
+			fmt.Printf("using config: %s\n", config)
+			s = scheduler.NewWithClock(config, clk)
+			byName[name] = s
+			devices = append(devices, device{name, s})
 		}
+		schedulerRoutes = append(schedulerRoutes, scheduler.Route{Pattern: pattern, Scheduler: s})
+	}
+	router, err := scheduler.NewRouter(clk, schedulerRoutes, nil)
+	if err != nil {
+		log.Fatalf("flag routes: %s", err)
+	}
+	return router, devices
+}
+
+// Flags for overriding any subset of the config, along with the DeviceConfig field each one
+// overrides. These are all strings (even the durations) because we need to differentiate
+// between the flag not being specified, and being set to the default value.
+var overrides = []struct {
+	flagName, field, usage string
+}{
+	{"seek-window", "SeekWindow", ""},
+	{"seek-time", "SeekTime", ""},
+	{"read-bytes-per-second", "ReadBytesPerSecond", ""},
+	{"write-bytes-per-second", "WriteBytesPerSecond", ""},
+	{"allocate-bytes-per-second", "AllocateBytesPerSecond", ""},
+	{"request-reorder-max-delay", "RequestReorderMaxDelay", ""},
+	{"fsync-strategy", "FsyncStrategy", "choice of none/no, dumb, writebackcache/wbc, journaled"},
+	{"write-strategy", "WriteStrategy", "choice of fast, simulate"},
+	{"metadata-op-time", "MetadataOpTime", "duration value (e.g. 10ms), or a distribution (e.g. lognormal(10ms,0.5))"},
+	{"media-type", "MediaType", "choice of rotational/hdd, solidstate/ssd, network/nfs"},
+	{"channels", "Channels", "number of requests a solid state device can run in parallel, or can be in flight to network media"},
+	{"read-latency", "ReadLatency", "fixed latency of each read on solid state media (e.g. 100us)"},
+	{"write-latency", "WriteLatency", "fixed latency of each write on solid state media (e.g. 50us)"},
+	{"round-trip-time", "RoundTripTime", "network round trip time each request to network media takes (e.g. 500us)"},
+	{"round-trip-jitter", "RoundTripJitter", "how much longer than the round trip time a request to network media can take (e.g. 100us)"},
+	{"network-window", "NetworkWindow", "data in flight before waiting for an acknowledgement on network media (e.g. 1MiB), or 0 for no limit"},
+	{"seek-model", "SeekModel", "choice of flat, distance"},
+	{"disk-capacity", "DiskCapacity", "size of the simulated disk for distance seeks (e.g. 1TB)"},
+	{"track-to-track-seek-time", "TrackToTrackSeekTime", "shortest seek for distance seeks (e.g. 1ms)"},
+	{"full-stroke-seek-time", "FullStrokeSeekTime", "seek across the whole disk for distance seeks (e.g. 20ms)"},
+	{"rpm", "RPM", "rotational speed, used for rotational latency with distance seeks"},
+	{"page-cache-size", "PageCacheSize", "how much file data to cache in memory (e.g. 1GiB), or 0 for no page cache"},
+	{"page-size", "PageSize", "granularity of the page cache (e.g. 4KiB)"},
+	{"page-cache-eviction", "PageCacheEviction", "choice of lru, 2q"},
+	{"memory-bytes-per-second", "MemoryBytesPerSecond", "how fast reads are served from the page cache"},
+	{"readahead-initial-window", "ReadaheadInitialWindow", "how much to read ahead when a sequential read starts (e.g. 16KiB)"},
+	{"readahead-max-window", "ReadaheadMaxWindow", "the most to read ahead at once (e.g. 128KiB), or 0 for no read-ahead"},
+	{"stream-table-size", "StreamTableSize", "how many files to track sequential access through at once"},
+	{"dirty-background-bytes", "DirtyBackgroundBytes", "dirty data in the write back cache before writes may be throttled (e.g. 64MiB)"},
+	{"dirty-limit-bytes", "DirtyLimitBytes", "dirty data in the write back cache at which writes block (e.g. 256MiB)"},
+	{"dirty-expire-interval", "DirtyExpireInterval", "how old dirty data gets before the flusher writes it back (e.g. 30s)"},
+	{"dirty-writeback-interval", "DirtyWritebackInterval", "how often the flusher wakes up (e.g. 5s)"},
+	{"journal-commit-time", "JournalCommitTime", "time to write a journal commit on fsync with the journaled fsync strategy (e.g. 2ms)"},
+	{"journal-policy", "JournalPolicy", "which other files fsync writes back with the journaled fsync strategy: choice of all, older, file"},
+	{"metadata-fsync-time", "MetadataFsyncTime", "time to fsync a file without dirty data with the journaled fsync strategy (e.g. 1ms)"},
+	{"direct-io-alignment", "DirectIOAlignment", "alignment O_DIRECT reads and writes must have (e.g. 4KiB), or 0 for none"},
+	{"io-scheduler", "IOScheduler", "order queued reads and writes are sent to the device in: choice of reorder, noop, deadline, elevator, fair"},
+	{"deadline-read-expire", "DeadlineReadExpire", "how long reads can wait with the deadline I/O scheduler (e.g. 500ms)"},
+	{"deadline-write-expire", "DeadlineWriteExpire", "how long writes can wait with the deadline I/O scheduler (e.g. 5s)"},
+	{"io-limits", "IOLimits", "per user, group or process limits, e.g. \"uid=1000 rbps=1MiB wiops=100; process=backup weight=50\""},
+	{"layout", "Layout", "build the device from members: choice of single, raid0, raid1, raid5, raid6, tiered"},
+	{"members", "Members", "comma separated names of the device configs the device is built from, fast tier first"},
+	{"stripe-size", "StripeSize", "how much data striped layouts put on each member in turn, and the tiered chunk size (e.g. 64KiB)"},
+	{"tier-cache-size", "TierCacheSize", "how much data the fast member of a tiered device holds (e.g. 1GiB)"},
+	{"tier-promote-after", "TierPromoteAfter", "how many accesses move a chunk to the fast member of a tiered device"},
+	{"random-seed", "RandomSeed", "seed for picking latencies from distributions, so different runs can pick different ones"},
+}
+
+// deviceFlags are the flags for choosing a device config, shared by all commands.
+type deviceFlags struct {
+	configFile     *string
+	configName     *string
+	overrideValues []*string
+}
+
+func addDeviceFlags(fs *flag.FlagSet) *deviceFlags {
+	df := &deviceFlags{
+		configFile:     fs.String("config-file", "", "path to config file listing device configurations"),
+		configName:     fs.String("config-name", "hdd7200rpm", "which config to use (built-ins: hdd7200rpm, ssd-sata, nvme, nfs-lan, nfs-wan, object-store)"),
+		overrideValues: make([]*string, len(overrides)),
+	}
+	for i, o := range overrides {
+		df.overrideValues[i] = fs.String(o.flagName, "", o.usage)
+	}
+	return df
+}
+
+// configs returns the built-in device configs, along with any from the config file, by name.
+func (df *deviceFlags) configs() map[string]*slowfs.DeviceConfig {
+	configs := map[string]*slowfs.DeviceConfig{
+		slowfs.HDD7200RpmDeviceConfig.Name:  &slowfs.HDD7200RpmDeviceConfig,
+		slowfs.SSDSataDeviceConfig.Name:     &slowfs.SSDSataDeviceConfig,
+		slowfs.NVMeDeviceConfig.Name:        &slowfs.NVMeDeviceConfig,
+		slowfs.NFSLANDeviceConfig.Name:      &slowfs.NFSLANDeviceConfig,
+		slowfs.NFSWANDeviceConfig.Name:      &slowfs.NFSWANDeviceConfig,
+		slowfs.ObjectStoreDeviceConfig.Name: &slowfs.ObjectStoreDeviceConfig,
 	}
 
-	if *fsyncStrategy != "" {
-		config.FsyncStrategy, err = slowfs.ParseFsyncStrategyFromString(*fsyncStrategy)
+	if *df.configFile != "" {
+		data, err := ioutil.ReadFile(*df.configFile)
 		if err != nil {
-			log.Printf("flag fsync-strategy: %s", err)
-			flagsHadError = true
+			log.Fatalf("couldn't read config file %s: %s", *df.configFile, err)
+		}
+		dcs, err := slowfs.ParseDeviceConfigsFromJSON(data)
+		if err != nil {
+			log.Fatalf("couldn't parse config file %s: %s", *df.configFile, err)
+		}
+		for _, dc := range dcs {
+			if _, ok := configs[dc.Name]; ok {
+				log.Fatalf("duplicate device config with name '%s'", dc.Name)
+			}
+			configs[dc.Name] = dc
 		}
 	}
 
-	if *writeStrategy != "" {
-		config.WriteStrategy, err = slowfs.ParseWriteStrategyFromString(*writeStrategy)
-		if err != nil {
-			log.Printf("flag write-strategy: %s", err)
-			flagsHadError = true
+	for _, dc := range configs {
+		if err := dc.ResolveMembers(configs); err != nil {
+			log.Fatalf("couldn't resolve device config %s: %s", dc.Name, err)
 		}
 	}
 
-	if *metadataOpTime != "" {
-		config.MetadataOpTime, err = time.ParseDuration(*metadataOpTime)
-		if err != nil {
-			log.Printf("flag metadata-op-time: %s", err)
+	return configs
+}
+
+// config returns a copy of the named config from configs, with any overrides from flags applied.
+// The configs themselves are left alone, so overrides don't leak into other devices built from
+// them, or into configs the control socket switches to.
+func (df *deviceFlags) config(configs map[string]*slowfs.DeviceConfig, name string) *slowfs.DeviceConfig {
+	named, ok := configs[name]
+
+	if !ok {
+		log.Fatalf("unknown config %s", name)
+	}
+	c := *named
+	config := &c
+
+	flagsHadError := false
+
+	for i, o := range overrides {
+		if *df.overrideValues[i] == "" {
+			continue
+		}
+		if err := config.SetField(o.field, *df.overrideValues[i]); err != nil {
+			log.Printf("flag %s: %s", o.flagName, err)
 			flagsHadError = true
 		}
 	}
@@ -176,18 +376,14 @@ func main() {
 		log.Fatalf("flags had error(s), exiting")
 	}
 
-	err = config.Validate()
-	if err != nil {
-		log.Fatalf("error validating config: %s", err)
+	if err := config.ResolveMembers(configs); err != nil {
+		log.Fatalf("error resolving config members: %s", err)
 	}
 
-	fmt.Printf("using config: %s\n", config)
-	scheduler := scheduler.New(config)
-	fs := pathfs.NewPathNodeFs(fuselayer.NewSlowFs(*backingDir, scheduler), nil)
-	server, _, err := nodefs.MountRoot(*mountDir, fs.Root(), nil)
+	err := config.Validate()
 	if err != nil {
-		log.Fatalf("%v", err)
+		log.Fatalf("error validating config: %s", err)
 	}
 
-	server.Serve()
+	return config
 }
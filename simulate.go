@@ -0,0 +1,88 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slowfs/slowfs/simulate"
+	"slowfs/slowfs/trace"
+	"strings"
+	"time"
+)
+
+// simulateMain implements the simulate command, which replays a trace against one or more device
+// configs without mounting anything.
+func simulateMain(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	traceFile := fs.String("trace-file", "", "path to a trace of requests, as written by --trace-file")
+	stallThreshold := fs.Duration("stall-threshold", 100*time.Millisecond, "fsyncs taking longer than this "+
+		"are reported as stalls")
+	deviceFlags := addDeviceFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s simulate --trace-file=FILE [--config-name=NAME[,NAME...]] [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *traceFile == "" {
+		log.Fatalf("argument trace-file is required.")
+	}
+
+	records, err := readTrace(*traceFile)
+	if err != nil {
+		log.Fatalf("couldn't read trace file %s: %s", *traceFile, err)
+	}
+
+	configs := deviceFlags.configs()
+	for i, name := range strings.Split(*deviceFlags.configName, ",") {
+		config := deviceFlags.config(configs, name)
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("config: %s\n", config.Name)
+		if err := simulate.Run(config, records).WriteReport(os.Stdout, *stallThreshold); err != nil {
+			log.Fatalf("couldn't write report: %s", err)
+		}
+	}
+}
+
+func readTrace(path string) ([]*trace.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr, err := trace.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*trace.Record
+	for {
+		r, err := tr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package calibrate measures a real disk with microbenchmarks, and derives a DeviceConfig that
+// makes slowfs behave like it.
+package calibrate
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Reads and writes using O_DIRECT must use buffers, offsets and sizes aligned to this.
+const alignment = 4096
+
+// Random reads with less latency than this are taken to mean the disk is solid state.
+const solidStateThreshold = time.Millisecond
+
+// The most requests to run in parallel when measuring how many channels a disk has.
+const maxChannels = 32
+
+// Options control how thorough calibration is.
+type Options struct {
+	// Directory on the disk to measure. A temporary file is created in it, and removed afterwards.
+	Dir string
+	// Size of the file used for measuring throughput. Should be much larger than any cache.
+	FileSize units.NumBytes
+	// Size of each read and write when measuring throughput.
+	BlockSize units.NumBytes
+	// Number of accesses to make when measuring random access times.
+	RandomOps int
+	// Number of files to create, stat and remove when measuring metadata operations.
+	MetadataOps int
+}
+
+// DefaultOptions are reasonable options for measuring a disk in a minute or so.
+var DefaultOptions = Options{
+	FileSize:    256 * units.Mebibyte,
+	BlockSize:   units.Mebibyte,
+	RandomOps:   256,
+	MetadataOps: 256,
+}
+
+// Stride is how long reads took on average when each started Stride bytes after the previous one.
+type Stride struct {
+	Stride units.NumBytes
+	Time   time.Duration
+}
+
+// Measurements are the results of the microbenchmarks.
+type Measurements struct {
+	// Whether I/O bypassed the page cache. If not, reads are likely to be too fast.
+	Direct bool
+
+	ReadBytesPerSecond  units.NumBytes
+	WriteBytesPerSecond units.NumBytes
+	// Zero if preallocating isn't supported.
+	AllocateBytesPerSecond units.NumBytes
+
+	// Average time for single block reads and writes at random offsets.
+	RandomReadTime  time.Duration
+	RandomWriteTime time.Duration
+	// Average read times for increasing strides.
+	Strides []Stride
+	// Random reads per second when running 1, 2, 4... reads in parallel.
+	ParallelReadsPerSecond []float64
+
+	// Average time to create, stat or remove a file.
+	MetadataOpTime time.Duration
+}
+
+// Measure runs the microbenchmarks described by opts.
+func Measure(opts Options) (*Measurements, error) {
+	if opts.BlockSize <= 0 || opts.BlockSize%alignment != 0 {
+		return nil, fmt.Errorf("block size must be a multiple of %d bytes", alignment)
+	}
+	if opts.FileSize < 2*opts.BlockSize {
+		return nil, fmt.Errorf("file size must be at least two blocks")
+	}
+	if opts.RandomOps <= 0 || opts.MetadataOps <= 0 {
+		return nil, fmt.Errorf("must make at least one random and metadata operation")
+	}
+
+	path := filepath.Join(opts.Dir, fmt.Sprintf("slowfs-calibrate-%d", os.Getpid()))
+	defer os.Remove(path)
+
+	m := &Measurements{}
+	var err error
+	if m.WriteBytesPerSecond, m.Direct, err = measureSequentialWrite(path, opts); err != nil {
+		return nil, fmt.Errorf("sequential write: %s", err)
+	}
+	if !m.Direct {
+		log.Printf("couldn't bypass the page cache in %s, so reads may look faster than the disk is", opts.Dir)
+	}
+	if m.ReadBytesPerSecond, err = measureSequentialRead(path, opts); err != nil {
+		return nil, fmt.Errorf("sequential read: %s", err)
+	}
+	if m.RandomReadTime, err = measureRandom(path, opts, false); err != nil {
+		return nil, fmt.Errorf("random read: %s", err)
+	}
+	if m.RandomWriteTime, err = measureRandom(path, opts, true); err != nil {
+		return nil, fmt.Errorf("random write: %s", err)
+	}
+	if m.Strides, err = measureStrides(path, opts); err != nil {
+		return nil, fmt.Errorf("strided read: %s", err)
+	}
+	if m.ParallelReadsPerSecond, err = measureParallel(path, opts); err != nil {
+		return nil, fmt.Errorf("parallel read: %s", err)
+	}
+	if m.AllocateBytesPerSecond, err = measureAllocate(path+"-allocate", opts); err != nil {
+		log.Printf("couldn't measure preallocation, so estimating it: %s", err)
+	}
+	if m.MetadataOpTime, err = measureMetadata(opts); err != nil {
+		return nil, fmt.Errorf("metadata: %s", err)
+	}
+	return m, nil
+}
+
+// DeviceConfig derives a device config with the given name from the measurements.
+func (m *Measurements) DeviceConfig(name string) *slowfs.DeviceConfig {
+	config := &slowfs.DeviceConfig{
+		Name:                   name,
+		ReadBytesPerSecond:     m.ReadBytesPerSecond,
+		WriteBytesPerSecond:    m.WriteBytesPerSecond,
+		AllocateBytesPerSecond: m.AllocateBytesPerSecond,
+		FsyncStrategy:          slowfs.WriteBackCachedFsync,
+		WriteStrategy:          slowfs.FastWrite,
+		MetadataOpTime:         m.MetadataOpTime,
+	}
+	if config.AllocateBytesPerSecond == 0 {
+		// As for the built-in configs, assume allocating a 4KiB block costs as much as writing a
+		// byte.
+		config.AllocateBytesPerSecond = 4096 * config.WriteBytesPerSecond
+	}
+
+	readLatency := positive(m.RandomReadTime - config.ReadTime(alignment))
+	writeLatency := positive(m.RandomWriteTime - config.WriteTime(alignment))
+
+	if readLatency < solidStateThreshold {
+		config.MediaType = slowfs.SolidStateMedia
+		config.ReadLatency = readLatency
+		config.WriteLatency = writeLatency
+		config.Channels = m.channels()
+		return config
+	}
+
+	config.SeekTime = readLatency
+	config.RequestReorderMaxDelay = slowfs.HDD7200RpmDeviceConfig.RequestReorderMaxDelay
+	// Reads within the seek window don't need a seek, so take nowhere near as long as a random
+	// read.
+	for _, s := range m.Strides {
+		if s.Time > config.ReadTime(alignment)+config.SeekTime/2 {
+			break
+		}
+		config.SeekWindow = s.Stride
+	}
+	return config
+}
+
+// channels returns how many reads can run in parallel before running more stops helping much.
+func (m *Measurements) channels() int {
+	channels := 1
+	for i := 1; i < len(m.ParallelReadsPerSecond); i++ {
+		if m.ParallelReadsPerSecond[i] < 1.25*m.ParallelReadsPerSecond[i-1] {
+			break
+		}
+		channels *= 2
+	}
+	return channels
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// openDirect opens path, bypassing the page cache if the platform and filesystem allow it.
+func openDirect(path string, flag int) (f *os.File, direct bool, err error) {
+	if directFlag != 0 {
+		if f, err := os.OpenFile(path, flag|directFlag, 0644); err == nil {
+			return f, true, nil
+		}
+	}
+	f, err = os.OpenFile(path, flag, 0644)
+	return f, false, err
+}
+
+// alignedBuffer returns a buffer of random bytes, suitably aligned for direct I/O.
+func alignedBuffer(size units.NumBytes) []byte {
+	buf := make([]byte, int(size)+alignment)
+	off := int(alignment-uintptr(unsafe.Pointer(&buf[0]))%alignment) % alignment
+	buf = buf[off : off+int(size)]
+	rand.Read(buf)
+	return buf
+}
+
+func throughput(bytes units.NumBytes, d time.Duration) units.NumBytes {
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return units.NumBytes(float64(bytes) / d.Seconds())
+}
+
+func measureSequentialWrite(path string, opts Options) (units.NumBytes, bool, error) {
+	f, direct, err := openDirect(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	buf := alignedBuffer(opts.BlockSize)
+	start := time.Now()
+	for off := units.NumBytes(0); off < opts.FileSize; off += opts.BlockSize {
+		if _, err := f.WriteAt(buf, int64(off)); err != nil {
+			return 0, false, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return 0, false, err
+	}
+	return throughput(opts.FileSize, time.Since(start)), direct, nil
+}
+
+func measureSequentialRead(path string, opts Options) (units.NumBytes, error) {
+	f, _, err := openDirect(path, os.O_RDONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := alignedBuffer(opts.BlockSize)
+	start := time.Now()
+	for off := units.NumBytes(0); off < opts.FileSize; off += opts.BlockSize {
+		if _, err := f.ReadAt(buf, int64(off)); err != nil {
+			return 0, err
+		}
+	}
+	return throughput(opts.FileSize, time.Since(start)), nil
+}
+
+// randomOffset returns an aligned offset of a block in a file of the given size.
+func randomOffset(fileSize units.NumBytes) int64 {
+	return rand.Int63n(int64(fileSize/alignment)) * alignment
+}
+
+func measureRandom(path string, opts Options, write bool) (time.Duration, error) {
+	flag := os.O_RDONLY
+	if write {
+		flag = os.O_WRONLY
+	}
+	f, _, err := openDirect(path, flag)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := alignedBuffer(alignment)
+	start := time.Now()
+	for i := 0; i < opts.RandomOps; i++ {
+		if write {
+			_, err = f.WriteAt(buf, randomOffset(opts.FileSize))
+		} else {
+			_, err = f.ReadAt(buf, randomOffset(opts.FileSize))
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if write {
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start) / time.Duration(opts.RandomOps), nil
+}
+
+func measureStrides(path string, opts Options) ([]Stride, error) {
+	f, _, err := openDirect(path, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := alignedBuffer(alignment)
+	var strides []Stride
+	for stride := units.NumBytes(alignment); stride <= opts.FileSize/2; stride *= 2 {
+		// Start somewhere random, so earlier strides haven't left anything in the disk's cache.
+		off := randomOffset(opts.FileSize / 2)
+		ops := 0
+		start := time.Now()
+		for ; ops < opts.RandomOps && off+int64(alignment) <= int64(opts.FileSize); ops++ {
+			if _, err := f.ReadAt(buf, off); err != nil {
+				return nil, err
+			}
+			off += int64(stride)
+		}
+		strides = append(strides, Stride{stride, time.Since(start) / time.Duration(ops)})
+	}
+	return strides, nil
+}
+
+func measureParallel(path string, opts Options) ([]float64, error) {
+	var readsPerSecond []float64
+	for parallel := 1; parallel <= maxChannels; parallel *= 2 {
+		var wg sync.WaitGroup
+		errs := make(chan error, parallel)
+		start := time.Now()
+		for i := 0; i < parallel; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := measureRandom(path, opts, false); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		if err := <-errs; err != nil {
+			return nil, err
+		}
+		readsPerSecond = append(readsPerSecond, float64(parallel*opts.RandomOps)/time.Since(start).Seconds())
+	}
+	return readsPerSecond, nil
+}
+
+func measureAllocate(path string, opts Options) (units.NumBytes, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(path)
+	defer f.Close()
+
+	// Allocation is fast, so allocate a lot to be measurable.
+	size := 16 * opts.FileSize
+	start := time.Now()
+	if err := fallocate(f, int64(size)); err != nil {
+		return 0, err
+	}
+	return throughput(size, time.Since(start)), nil
+}
+
+func measureMetadata(opts Options) (time.Duration, error) {
+	dir := filepath.Join(opts.Dir, fmt.Sprintf("slowfs-calibrate-%d-metadata", os.Getpid()))
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Now()
+	for i := 0; i < opts.MetadataOps; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("%d", i))
+		f, err := os.Create(path)
+		if err != nil {
+			return 0, err
+		}
+		f.Close()
+		if _, err := os.Stat(path); err != nil {
+			return 0, err
+		}
+		if err := os.Remove(path); err != nil {
+			return 0, err
+		}
+	}
+	// Flush the directory, so that the metadata actually reaches the disk.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	// Each iteration was a create, a close, a stat and a remove.
+	return time.Since(start) / time.Duration(4*opts.MetadataOps), nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calibrate
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestMeasurements_DeviceConfig(t *testing.T) {
+	cases := []struct {
+		desc         string
+		measurements Measurements
+		want         slowfs.DeviceConfig
+	}{
+		{
+			desc: "hdd",
+			measurements: Measurements{
+				ReadBytesPerSecond:     4096 * units.Kilobyte,
+				WriteBytesPerSecond:    2048 * units.Kilobyte,
+				AllocateBytesPerSecond: 10 * units.Gibibyte,
+				RandomReadTime:         9 * time.Millisecond,
+				RandomWriteTime:        10 * time.Millisecond,
+				Strides: []Stride{
+					{4 * units.Kibibyte, 1 * time.Millisecond},
+					{8 * units.Kibibyte, 2 * time.Millisecond},
+					{16 * units.Kibibyte, 7 * time.Millisecond},
+					{32 * units.Kibibyte, 3 * time.Millisecond},
+				},
+				ParallelReadsPerSecond: []float64{100, 150},
+				MetadataOpTime:         5 * time.Millisecond,
+			},
+			want: slowfs.DeviceConfig{
+				Name:                   "test",
+				SeekWindow:             8 * units.Kibibyte,
+				SeekTime:               8 * time.Millisecond,
+				ReadBytesPerSecond:     4096 * units.Kilobyte,
+				WriteBytesPerSecond:    2048 * units.Kilobyte,
+				AllocateBytesPerSecond: 10 * units.Gibibyte,
+				RequestReorderMaxDelay: 100 * time.Microsecond,
+				FsyncStrategy:          slowfs.WriteBackCachedFsync,
+				WriteStrategy:          slowfs.FastWrite,
+				MetadataOpTime:         5 * time.Millisecond,
+			},
+		},
+		{
+			desc: "ssd",
+			measurements: Measurements{
+				ReadBytesPerSecond:     4096 * units.Kilobyte,
+				WriteBytesPerSecond:    4096 * units.Kilobyte,
+				RandomReadTime:         1100 * time.Microsecond,
+				RandomWriteTime:        1050 * time.Microsecond,
+				ParallelReadsPerSecond: []float64{100, 190, 360, 400, 800},
+				MetadataOpTime:         50 * time.Microsecond,
+			},
+			want: slowfs.DeviceConfig{
+				Name:                   "test",
+				ReadBytesPerSecond:     4096 * units.Kilobyte,
+				WriteBytesPerSecond:    4096 * units.Kilobyte,
+				AllocateBytesPerSecond: 4096 * 4096 * units.Kilobyte,
+				FsyncStrategy:          slowfs.WriteBackCachedFsync,
+				WriteStrategy:          slowfs.FastWrite,
+				MetadataOpTime:         50 * time.Microsecond,
+				MediaType:              slowfs.SolidStateMedia,
+				Channels:               4,
+				ReadLatency:            100 * time.Microsecond,
+				WriteLatency:           50 * time.Microsecond,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got := c.measurements.DeviceConfig("test")
+		if !reflect.DeepEqual(*got, c.want) {
+			t.Errorf("fail (%s) DeviceConfig() = %s, want %s", c.desc, got, &c.want)
+		}
+		if err := got.Validate(); err != nil {
+			t.Errorf("fail (%s) DeviceConfig() gives invalid config: %s", c.desc, err)
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "calibrate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{
+		Dir:         dir,
+		FileSize:    256 * units.Kibibyte,
+		BlockSize:   64 * units.Kibibyte,
+		RandomOps:   4,
+		MetadataOps: 4,
+	}
+	m, err := Measure(opts)
+	if err != nil {
+		t.Fatalf("Measure(%+v) error: %s", opts, err)
+	}
+	if err := m.DeviceConfig("test").Validate(); err != nil {
+		t.Errorf("Measure(%+v) gives invalid config: %s", opts, err)
+	}
+
+	// Measure shouldn't leave anything behind.
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("Measure(%+v) left files %v behind", opts, files)
+	}
+
+	opts.BlockSize = 100
+	if _, err := Measure(opts); err == nil {
+		t.Errorf("Measure(%+v) with unaligned block size should fail", opts)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package calibrate
+
+import (
+	"errors"
+	"os"
+)
+
+// There is no portable way of bypassing the page cache.
+const directFlag = 0
+
+// fallocate isn't supported outside Linux.
+func fallocate(f *os.File, size int64) error {
+	return errors.New("preallocation isn't supported on this platform")
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clock provides an abstraction over the passing of time, so that the scheduler and FUSE
+// layer can be driven either by the real clock, or by a simulated one that never actually waits.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time, and waits for time to pass.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+	// Sleep waits for the given duration to pass. Non-positive durations return immediately.
+	Sleep(d time.Duration)
+	// NewTimer creates a Timer that fires once the given duration has passed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer sends the current time on its channel once it fires.
+type Timer interface {
+	// C returns the channel the timer fires on.
+	C() <-chan time.Time
+	// Reset changes the timer to fire after the given duration.
+	Reset(d time.Duration)
+}
+
+// RealClock is a Clock backed by the system clock.
+type RealClock struct{}
+
+// Now returns time.Now().
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Since returns time.Since(t).
+func (RealClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+// Sleep calls time.Sleep(d).
+func (RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTimer wraps time.NewTimer(d).
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Reset(d time.Duration) {
+	t.timer.Reset(d)
+}
+
+// SimulatedClock is a Clock whose time only moves when something waits on it, and then jumps
+// straight to the end of the wait. This makes everything driven by it deterministic and instant,
+// and the time it reports is how long the work would have taken in reality.
+//
+// Since nothing else would move the time forward while the owner of a timer is waiting on it, a
+// simulated timer fires as soon as it is started, moving the clock just past its deadline (a real
+// timer is only ever observed to have fired after its deadline). A timer whose deadline has already
+// passed fires without moving the clock at all.
+type SimulatedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewSimulatedClock creates a SimulatedClock whose time starts at start.
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	return &SimulatedClock{now: start}
+}
+
+// Now returns the simulated time.
+func (c *SimulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the simulated time elapsed since t.
+func (c *SimulatedClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Sleep moves the simulated time forward by d, and returns immediately. Sleeps by different
+// goroutines add up, rather than overlapping as they would in reality, so the simulated time is
+// only how long the work would have taken if it was done one thing at a time.
+func (c *SimulatedClock) Sleep(d time.Duration) {
+	if d > 0 {
+		c.Advance(d)
+	}
+}
+
+// Advance moves the simulated time forward by d.
+func (c *SimulatedClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// AdvanceTo moves the simulated time forward to t. If t is in the past, this does nothing.
+func (c *SimulatedClock) AdvanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// NewTimer creates a timer which immediately fires, moving the simulated time just past d from now
+// unless d is negative.
+func (c *SimulatedClock) NewTimer(d time.Duration) Timer {
+	t := &simulatedTimer{
+		clock: c,
+		ch:    make(chan time.Time, 1),
+	}
+	t.Reset(d)
+	return t
+}
+
+type simulatedTimer struct {
+	clock *SimulatedClock
+	ch    chan time.Time
+}
+
+func (t *simulatedTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *simulatedTimer) Reset(d time.Duration) {
+	if d >= 0 {
+		t.clock.Advance(d + time.Nanosecond)
+	}
+
+	// Like a real timer, a fire that hasn't been received yet is superseded by this one.
+	select {
+	case <-t.ch:
+	default:
+	}
+	t.ch <- t.clock.Now()
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var startTime time.Time
+
+func TestSimulatedClock_Sleep(t *testing.T) {
+	cases := []struct {
+		sleep time.Duration
+		want  time.Duration
+	}{
+		{0, 0},
+		{time.Second, time.Second},
+		{-time.Second, time.Second},
+		{5 * time.Millisecond, time.Second + 5*time.Millisecond},
+	}
+
+	clk := NewSimulatedClock(startTime)
+	for _, c := range cases {
+		clk.Sleep(c.sleep)
+		if got, want := clk.Since(startTime), c.want; got != want {
+			t.Errorf("after Sleep(%s), Since(start) = %s, want %s", c.sleep, got, want)
+		}
+	}
+}
+
+func TestSimulatedClock_AdvanceTo(t *testing.T) {
+	cases := []struct {
+		to   time.Time
+		want time.Time
+	}{
+		{startTime.Add(time.Second), startTime.Add(time.Second)},
+		{startTime, startTime.Add(time.Second)},
+		{startTime.Add(2 * time.Second), startTime.Add(2 * time.Second)},
+	}
+
+	clk := NewSimulatedClock(startTime)
+	for _, c := range cases {
+		clk.AdvanceTo(c.to)
+		if got, want := clk.Now(), c.want; got != want {
+			t.Errorf("after AdvanceTo(%s), Now() = %s, want %s", c.to, got, want)
+		}
+	}
+}
+
+func TestSimulatedClock_Timer(t *testing.T) {
+	clk := NewSimulatedClock(startTime)
+	timer := clk.NewTimer(time.Second)
+	if got, want := <-timer.C(), startTime.Add(time.Second+time.Nanosecond); got != want {
+		t.Errorf("timer fired at %s, want %s", got, want)
+	}
+
+	// A fire that was never received is superseded by a reset.
+	timer.Reset(time.Second)
+	timer.Reset(-time.Second)
+	if got, want := <-timer.C(), startTime.Add(2*time.Second+2*time.Nanosecond); got != want {
+		t.Errorf("timer fired at %s, want %s", got, want)
+	}
+	select {
+	case got := <-timer.C():
+		t.Errorf("timer fired again at %s", got)
+	default:
+	}
+
+	// Resetting to a deadline that has already passed doesn't move the time.
+	for i := 0; i < 3; i++ {
+		timer.Reset(-time.Second)
+		if got, want := <-timer.C(), startTime.Add(2*time.Second+2*time.Nanosecond); got != want {
+			t.Errorf("timer fired at %s, want %s", got, want)
+		}
+	}
+}
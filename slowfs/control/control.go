@@ -0,0 +1,263 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package control provides a server that changes the behaviour of a running slowfs. It listens on
+// a Unix socket, and speaks a protocol where each line sent is a JSON encoded Request, answered by
+// a line containing a JSON encoded Response.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/crash"
+	"slowfs/slowfs/fault"
+	"slowfs/slowfs/scheduler"
+	"sync"
+	"time"
+)
+
+// Request is a command sent to the control server.
+type Request struct {
+	// Command is one of:
+	//   get:    reply with the device config currently in use.
+	//   set:    set the device config field named Field to Value (e.g. "SeekTime", "5ms").
+	//   use:    switch to the device config named Name.
+	//   pause:  stop all I/O from completing until resumed.
+	//   resume: undo pause.
+	//   faults: replace the fault injection rules with those in Value, in the same format as fault
+	//           files. An empty Value removes all rules.
+	//   powercut: simulate losing power, discarding data that hasn't been persisted. Value is
+	//             an optional comma separated list of options: reorder, torn.
+	//   dropcaches: empty the page cache, like writing 3 to /proc/sys/vm/drop_caches.
+	//   syncfs: write back everything waiting in the write back cache, like syncfs, which FUSE
+	//           doesn't pass on. The response is sent once it's done.
+	Command string
+	Field   string `json:",omitempty"`
+	Value   string `json:",omitempty"`
+	Name    string `json:",omitempty"`
+	// Device is which device the command acts on, by the name it was added to the server with,
+	// when different paths are on different devices. By default, pause, resume, dropcaches and
+	// syncfs act on every device, get on the server's scheduler, and set and use fail if there is
+	// more than one device.
+	Device string `json:",omitempty"`
+}
+
+// Response is the reply to a Request. If the request failed, Error says why. Otherwise, Config
+// holds the device config in use after the request, in the same format as config files.
+type Response struct {
+	Error  string               `json:",omitempty"`
+	Config *slowfs.DeviceConfig `json:",omitempty"`
+	Paused bool
+}
+
+// Server serves control requests for a scheduler.
+type Server struct {
+	scheduler *scheduler.Scheduler
+	// Other schedulers that requests can name as their Device.
+	devices map[string]*scheduler.Scheduler
+
+	// Device configs that can be switched to by name.
+	configs map[string]*slowfs.DeviceConfig
+	faults  *fault.Injector
+	journal *crash.Journal
+
+	listener net.Listener
+	logger   *log.Logger
+
+	// Serialises requests, so that read-modify-write of the config is atomic. It isn't held by
+	// syncfs, which waits for paused devices to be resumed.
+	mu sync.Mutex
+}
+
+// NewServer creates a Server listening on a Unix socket at socketPath, which controls the given
+// scheduler. Named configs can be switched to with the use command, faults has its rules
+// replaced by the faults command, and journal is used for the powercut command, which fails if
+// journal is nil. If there is a leftover socket at socketPath, it is replaced.
+func NewServer(socketPath string, s *scheduler.Scheduler, configs map[string]*slowfs.DeviceConfig,
+	faults *fault.Injector, journal *crash.Journal) (*Server, error) {
+	if fi, err := os.Lstat(socketPath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(socketPath); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		scheduler: s,
+		devices:   make(map[string]*scheduler.Scheduler),
+		configs:   configs,
+		faults:    faults,
+		journal:   journal,
+		listener:  listener,
+		logger:    log.New(os.Stderr, "Control: ", log.Ldate|log.Ltime|log.Lshortfile),
+	}, nil
+}
+
+// AddDevice lets requests act on another scheduler, by giving name as their Device. It must be
+// called before Serve.
+func (srv *Server) AddDevice(name string, s *scheduler.Scheduler) {
+	srv.devices[name] = s
+}
+
+// Serve accepts connections until the server is closed.
+func (srv *Server) Serve() error {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+// Close stops the server listening, and removes its socket.
+func (srv *Server) Close() error {
+	return srv.listener.Close()
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp *Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = &Response{Error: fmt.Sprintf("couldn't parse request: %s", err)}
+		} else {
+			resp = srv.handle(&req)
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			srv.logger.Printf("couldn't write response: %s\n", err)
+			return
+		}
+	}
+}
+
+// errAmbiguousDevice is the error for commands that need to be told which device to change.
+var errAmbiguousDevice = errors.New("there is more than one device, so Device must say which")
+
+// schedulers returns every scheduler the server controls.
+func (srv *Server) schedulers() []*scheduler.Scheduler {
+	schedulers := []*scheduler.Scheduler{srv.scheduler}
+	for _, s := range srv.devices {
+		if s != srv.scheduler {
+			schedulers = append(schedulers, s)
+		}
+	}
+	return schedulers
+}
+
+func (srv *Server) handle(req *Request) *Response {
+	if req.Command != "syncfs" {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+	}
+
+	s := srv.scheduler
+	targets := srv.schedulers()
+	if req.Device != "" {
+		if s = srv.devices[req.Device]; s == nil {
+			return &Response{Error: fmt.Sprintf("unknown device %s", req.Device)}
+		}
+		targets = []*scheduler.Scheduler{s}
+	}
+
+	var err error
+	switch req.Command {
+	case "get":
+		// Nothing to do, the config is always returned.
+	case "set":
+		config := s.Config()
+		if len(targets) > 1 {
+			err = errAmbiguousDevice
+		} else if err = config.SetField(req.Field, req.Value); err == nil {
+			err = config.ResolveMembers(srv.configs)
+		}
+		if err == nil {
+			err = s.SetConfig(&config)
+		}
+	case "use":
+		config, ok := srv.configs[req.Name]
+		if len(targets) > 1 {
+			err = errAmbiguousDevice
+		} else if !ok {
+			err = fmt.Errorf("unknown config %s", req.Name)
+		} else {
+			err = s.SetConfig(config)
+		}
+	case "pause":
+		for _, t := range targets {
+			t.Pause()
+		}
+	case "resume":
+		for _, t := range targets {
+			t.Resume()
+		}
+	case "faults":
+		var rules []*fault.Rule
+		if req.Value != "" {
+			rules, err = fault.ParseRulesFromJSON([]byte(req.Value))
+		}
+		if err == nil {
+			srv.faults.SetRules(rules)
+		}
+	case "powercut":
+		var opts crash.PowerCutOptions
+		if srv.journal == nil {
+			err = errors.New("power cuts need crash simulation to be enabled")
+		} else if opts, err = crash.ParsePowerCutOptionsFromString(req.Value); err == nil {
+			err = srv.journal.PowerCut(opts)
+		}
+	case "dropcaches":
+		for _, t := range targets {
+			t.DropCaches()
+		}
+	case "syncfs":
+		// Every device writes back at once, so wait for the slowest.
+		start := s.Clock().Now()
+		var opTime time.Duration
+		for _, t := range targets {
+			if d := t.Schedule(&scheduler.Request{Type: scheduler.SyncfsRequest, Timestamp: start}); d > opTime {
+				opTime = d
+			}
+		}
+		s.Clock().Sleep(opTime - s.Clock().Since(start))
+		srv.journal.SyncAll()
+	default:
+		err = fmt.Errorf("unknown command %s", req.Command)
+	}
+
+	config := s.Config()
+	resp := &Response{
+		Config: &config,
+		Paused: s.Paused(),
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/fault"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*Server, func()) {
+	dir, err := ioutil.TempDir("", "control_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := slowfs.HDD7200RpmDeviceConfig
+	s := scheduler.NewWithClock(&config, clock.NewSimulatedClock(time.Time{}))
+	configs := map[string]*slowfs.DeviceConfig{
+		slowfs.NVMeDeviceConfig.Name: &slowfs.NVMeDeviceConfig,
+	}
+	srv, err := NewServer(filepath.Join(dir, "control.sock"), s, configs, fault.NewInjector(nil, 1), nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return srv, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServer_Handle(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		req        Request
+		wantErr    bool
+		wantField  string
+		wantValue  string
+		wantPaused bool
+	}{
+		{Request{Command: "get"}, false, "SeekTime", "10ms", false},
+		{Request{Command: "set", Field: "SeekTime", Value: "5ms"}, false, "SeekTime", "5ms", false},
+		{Request{Command: "set", Field: "ReadBytesPerSecond", Value: "5MiB"}, false, "ReadBytesPerSecond", "5242880B", false},
+		{Request{Command: "set", Field: "FsyncStrategy", Value: "dumb"}, false, "FsyncStrategy", "DumbFsync", false},
+		{Request{Command: "set", Field: "SeekTime", Value: "-5ms"}, true, "SeekTime", "5ms", false},
+		{Request{Command: "set", Field: "Chicken", Value: "5ms"}, true, "SeekTime", "5ms", false},
+		{Request{Command: "pause"}, false, "SeekTime", "5ms", true},
+		{Request{Command: "use", Name: "nvme"}, false, "Name", "nvme", true},
+		{Request{Command: "use", Name: "chicken"}, true, "Name", "nvme", true},
+		{Request{Command: "resume"}, false, "Name", "nvme", false},
+		{Request{Command: "chicken"}, true, "Name", "nvme", false},
+		{Request{Command: "powercut"}, true, "Name", "nvme", false},
+	}
+
+	for _, c := range cases {
+		resp := srv.handle(&c.req)
+		if c.wantErr != (resp.Error != "") {
+			t.Errorf("handle(%+v) error = %q, want error: %t", c.req, resp.Error, c.wantErr)
+		}
+		if got, _ := resp.Config.GetField(c.wantField); got != c.wantValue {
+			t.Errorf("handle(%+v) gives %s = %s, want %s", c.req, c.wantField, got, c.wantValue)
+		}
+		if got, want := resp.Paused, c.wantPaused; got != want {
+			t.Errorf("handle(%+v) gives paused = %t, want %t", c.req, got, want)
+		}
+	}
+}
+
+func TestServer_HandleDevice(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+	config := slowfs.NVMeDeviceConfig
+	wal := scheduler.NewWithClock(&config, clock.NewSimulatedClock(time.Time{}))
+	srv.AddDevice("wal", wal)
+
+	req := Request{Command: "set", Field: "SeekTime", Value: "5ms", Device: "wal"}
+	if resp := srv.handle(&req); resp.Error != "" {
+		t.Errorf("handle(%+v) error = %q", req, resp.Error)
+	}
+	if got, want := wal.Config().SeekTime, 5*time.Millisecond; got != want {
+		t.Errorf("handle(%+v) sets wal SeekTime = %s, want %s", req, got, want)
+	}
+	if got, want := srv.scheduler.Config().SeekTime, 10*time.Millisecond; got != want {
+		t.Errorf("handle(%+v) sets default SeekTime = %s, want %s", req, got, want)
+	}
+
+	req = Request{Command: "pause"}
+	if resp := srv.handle(&req); resp.Error != "" || !resp.Paused {
+		t.Errorf("handle(%+v) = %+v, want paused", req, resp)
+	}
+	if !wal.Paused() {
+		t.Errorf("handle(%+v) didn't pause wal", req)
+	}
+	req = Request{Command: "resume"}
+	srv.handle(&req)
+	if srv.scheduler.Paused() || wal.Paused() {
+		t.Errorf("handle(%+v) didn't resume every device", req)
+	}
+
+	for _, req := range []Request{{Command: "set", Field: "SeekTime", Value: "1ms"}, {Command: "use", Name: "nvme"}} {
+		if resp := srv.handle(&req); resp.Error == "" {
+			t.Errorf("handle(%+v) should fail without a Device when there are two", req)
+		}
+	}
+	if got, want := srv.scheduler.Config().SeekTime, 10*time.Millisecond; got != want {
+		t.Errorf("failed set changed default SeekTime to %s, want %s", got, want)
+	}
+
+	req = Request{Command: "get", Device: "chicken"}
+	if resp := srv.handle(&req); resp.Error == "" {
+		t.Errorf("handle(%+v) should fail for an unknown device", req)
+	}
+}
+
+func TestServer_HandleSyncfs(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+	s := srv.scheduler
+	clk := s.Clock()
+
+	s.Schedule(&scheduler.Request{Type: scheduler.WriteRequest, Timestamp: clk.Now(), Path: "a", Size: 1024 * 1024})
+	req := Request{Command: "syncfs"}
+	start := clk.Now()
+	if resp := srv.handle(&req); resp.Error != "" {
+		t.Errorf("handle(%+v) error = %q", req, resp.Error)
+	}
+	withData := clk.Since(start)
+
+	start = clk.Now()
+	srv.handle(&req)
+	if withoutData := clk.Since(start); withoutData >= withData {
+		t.Errorf("syncfs took %s with nothing to write back, want less than the %s it took with 1MiB", withoutData, withData)
+	}
+}
+
+func TestServer_HandleSyncfsWhilePaused(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	if resp := srv.handle(&Request{Command: "pause"}); resp.Error != "" {
+		t.Fatalf("pause error = %q", resp.Error)
+	}
+
+	// The syncfs can't finish until the device is resumed, but mustn't stop it being resumed.
+	done := make(chan *Response)
+	go func() {
+		done <- srv.handle(&Request{Command: "syncfs"})
+	}()
+	select {
+	case resp := <-done:
+		t.Fatalf("syncfs returned %+v while paused", resp)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if resp := srv.handle(&Request{Command: "resume"}); resp.Error != "" {
+		t.Errorf("resume error = %q", resp.Error)
+	}
+	select {
+	case resp := <-done:
+		if resp.Error != "" {
+			t.Errorf("syncfs error = %q", resp.Error)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("syncfs didn't return after resume")
+	}
+}
+
+func TestServer_HandleFaults(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		value     string
+		wantErr   bool
+		wantRules int
+	}{
+		{`[{"Ops": "read", "Effect": "EIO"}, {"Path": "*.log", "Effect": "ENOSPC"}]`, false, 2},
+		{`[{"Effect": "chicken"}]`, true, 2},
+		{`chicken`, true, 2},
+		{``, false, 0},
+	}
+
+	for _, c := range cases {
+		req := Request{Command: "faults", Value: c.value}
+		resp := srv.handle(&req)
+		if c.wantErr != (resp.Error != "") {
+			t.Errorf("handle(%+v) error = %q, want error: %t", req, resp.Error, c.wantErr)
+		}
+		if got, want := len(srv.faults.Rules()), c.wantRules; got != want {
+			t.Errorf("handle(%+v) leaves %d fault rules, want %d", req, got, want)
+		}
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	srv, cleanup := newTestServer(t)
+	defer cleanup()
+	go srv.Serve()
+
+	conn, err := net.Dial("unix", srv.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(`{"Command": "set", "Field": "MetadataOpTime", "Value": "1s"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		Error  string
+		Config map[string]string
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		t.Fatalf("couldn't parse response %s: %s", line, err)
+	}
+	if resp.Error != "" {
+		t.Errorf("response error: %s", resp.Error)
+	}
+	if got, want := resp.Config["MetadataOpTime"], "1s"; got != want {
+		t.Errorf("response MetadataOpTime = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crash simulates power cuts, by undoing writes to the backing directory that the
+// device model says haven't been persisted yet.
+package crash
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"strings"
+	"sync"
+)
+
+// Torn writes are persisted or lost a sector at a time.
+const sectorSize = 512
+
+// PowerCutOptions control which unpersisted data survives a power cut.
+type PowerCutOptions struct {
+	// By default, the most recent writes to a file are the ones lost. With Reorder, bytes are lost
+	// from randomly chosen writes instead, as if the device wrote back out of order.
+	Reorder bool
+	// With Torn, each sector of a lost write independently has an even chance of surviving.
+	Torn bool
+}
+
+// ParsePowerCutOptionsFromString parses a comma separated list of options, e.g. "reorder,torn".
+// Case insensitive.
+func ParsePowerCutOptionsFromString(s string) (PowerCutOptions, error) {
+	var opts PowerCutOptions
+	for _, opt := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(opt)) {
+		case "":
+		case "reorder":
+			opts.Reorder = true
+		case "torn":
+			opts.Torn = true
+		default:
+			return PowerCutOptions{}, fmt.Errorf("unknown power cut option %s", opt)
+		}
+	}
+	return opts, nil
+}
+
+type write struct {
+	path string
+	off  int64
+	data []byte
+
+	// What the write overwrote, and the size of the file before the write.
+	old     []byte
+	oldSize int64
+
+	// Whether the file was closed after the write, making its unwritten bytes orphaned.
+	orphaned bool
+	// Whether the write went straight to the device, so was persisted when it completed.
+	persisted bool
+}
+
+// Journal records writes to files in a backing directory that may not have been persisted yet, so
+// that a power cut can undo them. It keeps both the old and new data of every write to a file
+// until the file is synced, so is only suitable for tests. It is safe for concurrent use.
+type Journal struct {
+	// Held while writing, so that writes are recorded in the order they happen.
+	mu sync.Mutex
+
+	dir       string
+	scheduler Scheduler
+	writes    []*write
+	rand      *rand.Rand
+}
+
+// Scheduler models the devices a Journal's files are on. It is implemented by scheduler.Router.
+type Scheduler interface {
+	// PowerCut forgets everything that hasn't been persisted, and returns how many bytes of each
+	// open file were lost, and how many bytes of closed files were lost on each device.
+	PowerCut() (lost map[string]units.NumBytes, orphaned map[*scheduler.Scheduler]units.NumBytes)
+	// Scheduler returns the scheduler for the device the given path is on, or nil if it isn't on
+	// one.
+	Scheduler(path string) *scheduler.Scheduler
+}
+
+// NewJournal creates a Journal for files in the directory dir, which uses the scheduler's model of
+// the device to decide what is lost in a power cut. Torn and reordered writes are chosen randomly
+// from a source seeded with seed, so that runs can be repeated.
+func NewJournal(dir string, scheduler Scheduler, seed int64) *Journal {
+	return &Journal{
+		dir:       dir,
+		scheduler: scheduler,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Write records a write of data at off to the file at path, relative to the journal's directory.
+// The write itself is done by calling write, which returns how many bytes it wrote. persisted says
+// whether the write skips the write back cache, like writes to files opened with O_SYNC, O_DSYNC
+// or O_DIRECT, so survives a power cut. If there is no longer a file at path, because it was
+// unlinked or renamed while open, the write is done but not recorded, so also survives a power cut.
+// A nil *Journal just calls write.
+func (j *Journal) Write(path string, off int64, data []byte, persisted bool, write func() int) error {
+	if j == nil {
+		write()
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	w, err := j.readOld(path, off, len(data))
+	if os.IsNotExist(err) {
+		write()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	n := write()
+	if n <= 0 {
+		return nil
+	}
+	w.data = append([]byte(nil), data[:n]...)
+	w.old = w.old[:minInt64(int64(len(w.old)), int64(n))]
+	w.persisted = persisted
+	j.writes = append(j.writes, w)
+	return nil
+}
+
+// readOld returns a write to path at off, holding what size bytes would overwrite.
+func (j *Journal) readOld(path string, off int64, size int) (*write, error) {
+	f, err := os.Open(filepath.Join(j.dir, path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &write{
+		path:    path,
+		off:     off,
+		oldSize: fi.Size(),
+	}
+	if off < fi.Size() {
+		w.old = make([]byte, minInt64(int64(size), fi.Size()-off))
+		if _, err := f.ReadAt(w.old, off); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Sync forgets the writes to path, as they have been persisted. This includes writes made before
+// the file was last closed, as fsync persists all of a file's data.
+func (j *Journal) Sync(path string) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	writes := j.writes[:0]
+	for _, w := range j.writes {
+		if w.path != path {
+			writes = append(writes, w)
+		}
+	}
+	j.writes = writes
+}
+
+// SyncAll forgets the writes to every file, as they have been persisted, like syncfs does.
+func (j *Journal) SyncAll() {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.writes = nil
+}
+
+// Close records that path was closed, so that any of its writes still unpersisted are orphaned.
+func (j *Journal) Close(path string) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, w := range j.writes {
+		if w.path == path {
+			w.orphaned = true
+		}
+	}
+}
+
+// PowerCut simulates a power cut: the scheduler forgets its write back cache, and the bytes it
+// hadn't persisted are removed from the backing directory. Files are rolled back to how they were
+// before their unpersisted writes, and the parts of those writes that survive are then reapplied.
+// Only data written through the journal is rolled back; metadata changes such as creating,
+// renaming or truncating files are not, and writes to files no longer at the path they were written
+// through are left alone.
+func (j *Journal) PowerCut(opts PowerCutOptions) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	lost, orphaned := j.scheduler.PowerCut()
+
+	// Decide which bytes of each write survive.
+	order := make([]int, len(j.writes))
+	for i := range order {
+		order[i] = len(order) - 1 - i
+	}
+	if opts.Reorder {
+		for i := range order {
+			idx := i + j.rand.Intn(len(order)-i)
+			order[i], order[idx] = order[idx], order[i]
+		}
+	}
+	kept := make([][]span, len(j.writes))
+	for _, i := range order {
+		w := j.writes[i]
+		// Persisted writes are still undone and redone, so that undoing older writes they overlap
+		// doesn't roll them back.
+		if w.persisted {
+			kept[i] = []span{{0, int64(len(w.data))}}
+			continue
+		}
+		// Closed files' lost bytes aren't told apart, so come out of their device's total.
+		var device *scheduler.Scheduler
+		budget := lost[w.path]
+		if w.orphaned {
+			device = j.scheduler.Scheduler(w.path)
+			budget = orphaned[device]
+		}
+		n := units.NumBytesMin(budget, units.NumBytes(len(w.data)))
+		if w.orphaned {
+			orphaned[device] -= n
+		} else {
+			lost[w.path] -= n
+		}
+		kept[i] = j.keptSpans(w, int64(len(w.data))-int64(n), opts.Torn)
+	}
+
+	// Undo every write, newest first, then redo the parts that survived, oldest first.
+	var firstErr error
+	for i := len(j.writes) - 1; i >= 0; i-- {
+		if err := j.undo(j.writes[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for i, w := range j.writes {
+		if err := j.redo(w, kept[i]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	j.writes = nil
+	return firstErr
+}
+
+// span is a range of bytes [start, end) within a write.
+type span struct {
+	start, end int64
+}
+
+// keptSpans returns which parts of w survive a power cut, given that the device had persisted its
+// first persisted bytes. If torn is set, each sector of the rest has an even chance of surviving.
+func (j *Journal) keptSpans(w *write, persisted int64, torn bool) []span {
+	var spans []span
+	if persisted > 0 {
+		spans = append(spans, span{0, persisted})
+	}
+	if !torn {
+		return spans
+	}
+
+	for start := persisted; start < int64(len(w.data)); {
+		// Sectors are aligned within the file, not within the write.
+		end := minInt64((w.off+start)/sectorSize*sectorSize+sectorSize-w.off, int64(len(w.data)))
+		if j.rand.Intn(2) == 0 {
+			if len(spans) != 0 && spans[len(spans)-1].end == start {
+				spans[len(spans)-1].end = end
+			} else {
+				spans = append(spans, span{start, end})
+			}
+		}
+		start = end
+	}
+	return spans
+}
+
+// undo restores what the file looked like before w.
+func (j *Journal) undo(w *write) error {
+	f, err := os.OpenFile(filepath.Join(j.dir, w.path), os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt(w.old, w.off); err != nil {
+		return err
+	}
+	if w.off+int64(len(w.data)) > w.oldSize {
+		return f.Truncate(w.oldSize)
+	}
+	return nil
+}
+
+// redo reapplies the given spans of w.
+func (j *Journal) redo(w *write, spans []span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(j.dir, w.path), os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, s := range spans {
+		if _, err := f.WriteAt(w.data[s.start:s.end], w.off+s.start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,343 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+var writeBackCacheDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+}
+
+type testFs struct {
+	t       *testing.T
+	dir     string
+	router  *scheduler.Router
+	journal *Journal
+}
+
+func newTestFs(t *testing.T) *testFs {
+	clk := clock.NewSimulatedClock(time.Time{})
+	return newRoutedTestFs(t, clk, nil, scheduler.NewWithClock(writeBackCacheDeviceConfig, clk))
+}
+
+// newRoutedTestFs creates a testFs with its files on the devices of the given routes, or on
+// fallback.
+func newRoutedTestFs(t *testing.T, clk clock.Clock, routes []scheduler.Route, fallback *scheduler.Scheduler) *testFs {
+	dir, err := ioutil.TempDir("", "crash_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := scheduler.NewRouter(clk, routes, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testFs{
+		t:       t,
+		dir:     dir,
+		router:  router,
+		journal: NewJournal(dir, router, 1),
+	}
+}
+
+func (fs *testFs) cleanup() {
+	os.RemoveAll(fs.dir)
+}
+
+// write does what the FUSE layer does for a write.
+func (fs *testFs) write(path string, off int64, data string) {
+	fs.writeWithFlags(path, off, data, 0)
+}
+
+// writeWithFlags does what the FUSE layer does for a write to a file opened with the given flags.
+func (fs *testFs) writeWithFlags(path string, off int64, data string, flags scheduler.RequestFlags) {
+	f, err := os.OpenFile(filepath.Join(fs.dir, path), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		fs.t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = fs.journal.Write(path, off, []byte(data), flags.WritesThrough(), func() int {
+		n, _ := f.WriteAt([]byte(data), off)
+		return n
+	})
+	if err != nil {
+		fs.t.Fatalf("Write(%s, %d, %q) error: %s", path, off, data, err)
+	}
+	fs.router.Schedule(&scheduler.Request{
+		Type:      scheduler.WriteRequest,
+		Timestamp: fs.router.Clock().Now(),
+		Path:      path,
+		Start:     units.NumBytes(off),
+		Size:      units.NumBytes(len(data)),
+		Flags:     flags,
+	})
+}
+
+func (fs *testFs) fsync(path string) {
+	fs.journal.Sync(path)
+	fs.schedule(scheduler.FsyncRequest, path, 0, 0)
+}
+
+func (fs *testFs) close(path string) {
+	fs.journal.Close(path)
+	fs.schedule(scheduler.CloseRequest, path, 0, 0)
+}
+
+func (fs *testFs) schedule(reqType scheduler.RequestType, path string, off int64, size int) {
+	fs.router.Schedule(&scheduler.Request{
+		Type:      reqType,
+		Timestamp: fs.router.Clock().Now(),
+		Path:      path,
+		Start:     units.NumBytes(off),
+		Size:      units.NumBytes(size),
+	})
+}
+
+func (fs *testFs) contents(path string) string {
+	data, err := ioutil.ReadFile(filepath.Join(fs.dir, path))
+	if err != nil {
+		fs.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJournal_PowerCut(t *testing.T) {
+	fs := newTestFs(t)
+	defer fs.cleanup()
+
+	if err := ioutil.WriteFile(filepath.Join(fs.dir, "existing"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.write("synced", 0, "hello")
+	fs.write("synced", 5, "world")
+	fs.fsync("synced")
+	fs.write("synced", 0, "HELLO")
+	fs.write("synced", 10, "!")
+
+	fs.write("existing", 8, "abcd")
+	fs.write("existing", 2, "xy")
+
+	fs.write("closed", 0, "gone")
+	fs.close("closed")
+
+	if err := fs.journal.PowerCut(PowerCutOptions{}); err != nil {
+		t.Fatalf("PowerCut() error: %s", err)
+	}
+
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"synced", "helloworld"},
+		{"existing", "0123456789"},
+		{"closed", ""},
+	}
+	for _, c := range cases {
+		if got := fs.contents(c.path); got != c.want {
+			t.Errorf("%s after PowerCut() = %q, want %q", c.path, got, c.want)
+		}
+	}
+
+	// Nothing is left to lose.
+	fs.write("synced", 0, "again")
+	fs.fsync("synced")
+	if err := fs.journal.PowerCut(PowerCutOptions{}); err != nil {
+		t.Fatalf("PowerCut() error: %s", err)
+	}
+	if got, want := fs.contents("synced"), "againworld"; got != want {
+		t.Errorf("synced after second PowerCut() = %q, want %q", got, want)
+	}
+}
+
+func TestJournal_PowerCutRouted(t *testing.T) {
+	clk := clock.NewSimulatedClock(time.Time{})
+	persistedConfig := *writeBackCacheDeviceConfig
+	persistedConfig.FsyncStrategy = slowfs.DumbFsync
+	routes := []scheduler.Route{{Pattern: "persisted", Scheduler: scheduler.NewWithClock(&persistedConfig, clk)}}
+	fs := newRoutedTestFs(t, clk, routes, scheduler.NewWithClock(writeBackCacheDeviceConfig, clk))
+	defer fs.cleanup()
+	if err := os.Mkdir(filepath.Join(fs.dir, "persisted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// What the write back cache loses of closed files can't come from another device's files.
+	fs.write("cached", 0, "gone")
+	fs.close("cached")
+	fs.write("persisted/kept", 0, "kept")
+	fs.close("persisted/kept")
+
+	if err := fs.journal.PowerCut(PowerCutOptions{}); err != nil {
+		t.Fatalf("PowerCut() error: %s", err)
+	}
+
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"cached", ""},
+		{"persisted/kept", "kept"},
+	}
+	for _, c := range cases {
+		if got := fs.contents(c.path); got != c.want {
+			t.Errorf("%s after PowerCut() = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestJournal_PowerCutWriteThrough(t *testing.T) {
+	fs := newTestFs(t)
+	defer fs.cleanup()
+
+	for _, path := range []string{"sync", "direct"} {
+		if err := ioutil.WriteFile(filepath.Join(fs.dir, path), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The buffered writes are lost, but the write through ones between them were persisted.
+	fs.write("sync", 0, "aaaa")
+	fs.writeWithFlags("sync", 2, "SS", scheduler.SyncFlag)
+	fs.write("sync", 6, "bb")
+
+	fs.write("direct", 4, "cccc")
+	fs.writeWithFlags("direct", 0, "DDDDDD", scheduler.DirectFlag)
+
+	if err := fs.journal.PowerCut(PowerCutOptions{}); err != nil {
+		t.Fatalf("PowerCut() error: %s", err)
+	}
+
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"sync", "01SS456789"},
+		{"direct", "DDDDDD6789"},
+	}
+	for _, c := range cases {
+		if got := fs.contents(c.path); got != c.want {
+			t.Errorf("%s after PowerCut() = %q, want %q", c.path, got, c.want)
+		}
+	}
+}
+
+func TestJournal_WriteAfterUnlink(t *testing.T) {
+	fs := newTestFs(t)
+	defer fs.cleanup()
+
+	fs.write("tmp", 0, "0123")
+	f, err := os.OpenFile(filepath.Join(fs.dir, "tmp"), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := os.Remove(filepath.Join(fs.dir, "tmp")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file can still be written through the open handle, and a power cut leaves it alone.
+	err = fs.journal.Write("tmp", 2, []byte("ab"), false, func() int {
+		n, _ := f.WriteAt([]byte("ab"), 2)
+		return n
+	})
+	if err != nil {
+		t.Fatalf("Write() after unlink error: %s", err)
+	}
+	if err := fs.journal.PowerCut(PowerCutOptions{}); err != nil {
+		t.Fatalf("PowerCut() error: %s", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf), "01ab"; got != want {
+		t.Errorf("unlinked file after PowerCut() = %q, want %q", got, want)
+	}
+}
+
+func TestJournal_KeptSpans(t *testing.T) {
+	j := &Journal{}
+	w := &write{off: 1000, data: make([]byte, 2000)}
+
+	if got := j.keptSpans(w, 0, false); len(got) != 0 {
+		t.Errorf("keptSpans(nothing persisted) = %v, want none", got)
+	}
+	if got, want := j.keptSpans(w, 300, false), []span{{0, 300}}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("keptSpans(300 persisted) = %v, want %v", got, want)
+	}
+
+	j = NewJournal("", nil, 1)
+	for i := 0; i < 10; i++ {
+		spans := j.keptSpans(w, 300, true)
+		if len(spans) == 0 || spans[0].start != 0 {
+			t.Fatalf("torn keptSpans(300 persisted) = %v, want the first 300 bytes kept", spans)
+		}
+		if spans[0].end < 300 {
+			t.Errorf("torn keptSpans(300 persisted) = %v, want the first 300 bytes kept", spans)
+		}
+		for k, s := range spans {
+			if k > 0 && s.start <= spans[k-1].end {
+				t.Errorf("torn keptSpans = %v, want sorted, disjoint spans", spans)
+			}
+			for _, b := range []int64{s.start, s.end} {
+				if (w.off+b)%sectorSize != 0 && b != 0 && b != 300 && b != int64(len(w.data)) {
+					t.Errorf("torn keptSpans = %v, span %+v doesn't start and end on sectors", spans, s)
+				}
+			}
+		}
+	}
+}
+
+func TestParsePowerCutOptionsFromString(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    PowerCutOptions
+		wantErr bool
+	}{
+		{"", PowerCutOptions{}, false},
+		{"reorder", PowerCutOptions{Reorder: true}, false},
+		{"Torn, reorder", PowerCutOptions{Reorder: true, Torn: true}, false},
+		{"chicken", PowerCutOptions{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParsePowerCutOptionsFromString(c.s)
+		if c.wantErr != (err != nil) {
+			t.Errorf("ParsePowerCutOptionsFromString(%s) error = %v, want error: %t", c.s, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("ParsePowerCutOptionsFromString(%s) = %+v, want %+v", c.s, got, c.want)
+		}
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"log"
 	"slowfs/slowfs/units"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -37,6 +39,10 @@ const (
 	// IO time. When fsync is called on a file, how much unwritten data remaining for that file
 	// determines how long the fsync takes.
 	WriteBackCachedFsync
+	// JournaledFsync simulates a write back cache like WriteBackCachedFsync, but with a journaling
+	// filesystem such as ext4 on top. Fsyncing a file commits the journal, which can also force
+	// other files' data to be written back first, depending on JournalPolicy.
+	JournaledFsync
 )
 
 func (f FsyncStrategy) String() string {
@@ -47,11 +53,18 @@ func (f FsyncStrategy) String() string {
 		return "DumbFsync"
 	case WriteBackCachedFsync:
 		return "WriteBackCachedFsync"
+	case JournaledFsync:
+		return "JournaledFsync"
 	default:
 		return "unknown fsync strategy"
 	}
 }
 
+// UsesWriteBackCache returns whether the strategy simulates a write back cache.
+func (f FsyncStrategy) UsesWriteBackCache() bool {
+	return f == WriteBackCachedFsync || f == JournaledFsync
+}
+
 // ParseFsyncStrategyFromString parses a FsyncStrategy from a string. There can be multiple ways to
 // specify each FsyncStrategy (e.g. nofsync, none, and no all mean 'NoFsync'). This function is
 // case insensitive.
@@ -63,11 +76,57 @@ func ParseFsyncStrategyFromString(s string) (FsyncStrategy, error) {
 		return DumbFsync, nil
 	case "writebackcachedfsync", "writebackcache", "wbc":
 		return WriteBackCachedFsync, nil
+	case "journaledfsync", "journaled", "journal":
+		return JournaledFsync, nil
 	default:
 		return 0, fmt.Errorf("unknown fsync strategy %s", s)
 	}
 }
 
+// JournalPolicy indicates which files' data a journal commit has to write back, along with the
+// data of the file being fsynced.
+type JournalPolicy int
+
+const (
+	// JournalAllFiles writes back every file's data, like ext4's data=ordered mode, where a commit
+	// has to wait for all data written in the transaction.
+	JournalAllFiles JournalPolicy = iota
+	// JournalOlderFiles writes back the data of files that were written to no later than the file
+	// being fsynced, as if only they had joined the transaction being committed.
+	JournalOlderFiles
+	// JournalFileOnly only writes back the file being fsynced, like ext4's data=writeback mode.
+	JournalFileOnly
+)
+
+func (p JournalPolicy) String() string {
+	switch p {
+	case JournalAllFiles:
+		return "JournalAllFiles"
+	case JournalOlderFiles:
+		return "JournalOlderFiles"
+	case JournalFileOnly:
+		return "JournalFileOnly"
+	default:
+		return "unknown journal policy"
+	}
+}
+
+// ParseJournalPolicyFromString parses a JournalPolicy from the given string. This function is case
+// insensitive, and also accepts synonyms for each JournalPolicy. For example, journalallfiles, all
+// and ordered all map to JournalAllFiles.
+func ParseJournalPolicyFromString(s string) (JournalPolicy, error) {
+	switch strings.ToLower(s) {
+	case "journalallfiles", "all", "ordered":
+		return JournalAllFiles, nil
+	case "journalolderfiles", "older":
+		return JournalOlderFiles, nil
+	case "journalfileonly", "file", "writeback":
+		return JournalFileOnly, nil
+	default:
+		return 0, fmt.Errorf("unknown journal policy %s", s)
+	}
+}
+
 // WriteStrategy indicates which strategy to use for write simulation.
 type WriteStrategy int
 
@@ -106,6 +165,287 @@ func ParseWriteStrategyFromString(s string) (WriteStrategy, error) {
 	}
 }
 
+// MediaType indicates what kind of physical medium a device is built on.
+type MediaType int
+
+const (
+	// RotationalMedia indicates a spinning hard disk. Non-sequential accesses incur a seek, and the
+	// device can only run one request at a time.
+	RotationalMedia MediaType = iota
+	// SolidStateMedia indicates flash storage, such as a SATA SSD or an NVMe drive. There is no
+	// seek penalty; instead every request pays a fixed latency, and up to Channels requests can be
+	// in progress at once, sharing the device's read and write bandwidth.
+	SolidStateMedia
+	// NetworkMedia indicates storage on a server, such as an NFS or SMB share or an object store.
+	// Like SolidStateMedia, up to Channels requests can be in flight at once, sharing the link's
+	// bandwidth, but every request also takes RoundTripTime, plus another for each NetworkWindow
+	// of data it transfers beyond the first.
+	NetworkMedia
+)
+
+func (m MediaType) String() string {
+	switch m {
+	case RotationalMedia:
+		return "RotationalMedia"
+	case SolidStateMedia:
+		return "SolidStateMedia"
+	case NetworkMedia:
+		return "NetworkMedia"
+	default:
+		return "unknown media type"
+	}
+}
+
+// ParseMediaTypeFromString parses a MediaType from the given string. This function is case
+// insensitive, and also accepts synonyms for each MediaType. For example, rotational and hdd both
+// map to RotationalMedia.
+func ParseMediaTypeFromString(s string) (MediaType, error) {
+	switch strings.ToLower(s) {
+	case "rotationalmedia", "rotational", "hdd":
+		return RotationalMedia, nil
+	case "solidstatemedia", "solidstate", "ssd", "flash":
+		return SolidStateMedia, nil
+	case "networkmedia", "network", "nfs", "remote":
+		return NetworkMedia, nil
+	default:
+		return 0, fmt.Errorf("unknown media type %s", s)
+	}
+}
+
+// UsesChannels returns whether media of this type can run several requests at once.
+func (m MediaType) UsesChannels() bool {
+	return m == SolidStateMedia || m == NetworkMedia
+}
+
+// SeekModel indicates how to model the time taken by a seek on rotational media.
+type SeekModel int
+
+const (
+	// FlatSeek indicates every seek takes SeekTime, no matter how far the head moves.
+	FlatSeek SeekModel = iota
+	// DistanceSeek indicates each file is placed at a simulated location on the disk, and seeks
+	// take longer the further the head has to travel, between TrackToTrackSeekTime and
+	// FullStrokeSeekTime. Seeks also pay rotational latency, derived from RPM.
+	DistanceSeek
+)
+
+func (s SeekModel) String() string {
+	switch s {
+	case FlatSeek:
+		return "FlatSeek"
+	case DistanceSeek:
+		return "DistanceSeek"
+	default:
+		return "unknown seek model"
+	}
+}
+
+// ParseSeekModelFromString parses a SeekModel from the given string. This function is case
+// insensitive, and also accepts synonyms for each SeekModel. For example, flatseek and flat both
+// map to FlatSeek.
+func ParseSeekModelFromString(s string) (SeekModel, error) {
+	switch strings.ToLower(s) {
+	case "flatseek", "flat":
+		return FlatSeek, nil
+	case "distanceseek", "distance":
+		return DistanceSeek, nil
+	default:
+		return 0, fmt.Errorf("unknown seek model %s", s)
+	}
+}
+
+// EvictionPolicy indicates how the page cache chooses which page to forget when it is full.
+type EvictionPolicy int
+
+const (
+	// LRUEviction evicts the least recently used page.
+	LRUEviction EvictionPolicy = iota
+	// TwoQueueEviction evicts using the 2Q algorithm: pages accessed once are kept in a small FIFO
+	// queue, and only promoted to an LRU list of hot pages if accessed again soon after being
+	// evicted from it. This stops large sequential scans from flushing out hot pages.
+	TwoQueueEviction
+)
+
+func (e EvictionPolicy) String() string {
+	switch e {
+	case LRUEviction:
+		return "LRUEviction"
+	case TwoQueueEviction:
+		return "TwoQueueEviction"
+	default:
+		return "unknown eviction policy"
+	}
+}
+
+// ParseEvictionPolicyFromString parses an EvictionPolicy from the given string. This function is
+// case insensitive, and also accepts synonyms for each EvictionPolicy. For example, lrueviction and
+// lru both map to LRUEviction.
+func ParseEvictionPolicyFromString(s string) (EvictionPolicy, error) {
+	switch strings.ToLower(s) {
+	case "lrueviction", "lru":
+		return LRUEviction, nil
+	case "twoqueueeviction", "twoqueue", "2q":
+		return TwoQueueEviction, nil
+	default:
+		return 0, fmt.Errorf("unknown eviction policy %s", s)
+	}
+}
+
+// IOScheduler indicates the order queued reads and writes are sent to the device in, like the
+// kernel's I/O schedulers.
+type IOScheduler int
+
+const (
+	// ReorderIOScheduler moves a request ahead of others that arrived up to RequestReorderMaxDelay
+	// before it, if it would then be sequential with the request in front of it.
+	ReorderIOScheduler IOScheduler = iota
+	// NoopIOScheduler sends requests in the order they arrive.
+	NoopIOScheduler
+	// DeadlineIOScheduler sends reads in order of their position on the disk, then writes, unless
+	// the oldest read or write has waited longer than DeadlineReadExpire or DeadlineWriteExpire.
+	DeadlineIOScheduler
+	// ElevatorIOScheduler sends requests in order of their position on the disk, sweeping in one
+	// direction and then jumping back to the start, like C-LOOK.
+	ElevatorIOScheduler
+	// FairIOScheduler shares the device between processes, next sending a request from whichever
+	// process with requests waiting has had the fewest bytes transferred, like BFQ.
+	FairIOScheduler
+)
+
+func (s IOScheduler) String() string {
+	switch s {
+	case ReorderIOScheduler:
+		return "ReorderIOScheduler"
+	case NoopIOScheduler:
+		return "NoopIOScheduler"
+	case DeadlineIOScheduler:
+		return "DeadlineIOScheduler"
+	case ElevatorIOScheduler:
+		return "ElevatorIOScheduler"
+	case FairIOScheduler:
+		return "FairIOScheduler"
+	default:
+		return "unknown I/O scheduler"
+	}
+}
+
+// ParseIOSchedulerFromString parses an IOScheduler from the given string. This function is case
+// insensitive, and also accepts synonyms for each IOScheduler. For example, noopioscheduler, noop,
+// none and fifo all map to NoopIOScheduler.
+func ParseIOSchedulerFromString(s string) (IOScheduler, error) {
+	switch strings.ToLower(s) {
+	case "reorderioscheduler", "reorder":
+		return ReorderIOScheduler, nil
+	case "noopioscheduler", "noop", "none", "fifo":
+		return NoopIOScheduler, nil
+	case "deadlineioscheduler", "deadline", "mq-deadline":
+		return DeadlineIOScheduler, nil
+	case "elevatorioscheduler", "elevator", "clook", "c-look":
+		return ElevatorIOScheduler, nil
+	case "fairioscheduler", "fair", "bfq":
+		return FairIOScheduler, nil
+	default:
+		return 0, fmt.Errorf("unknown I/O scheduler %s", s)
+	}
+}
+
+// DeviceLayout indicates whether a device is a single device, or is built from other devices, like
+// a RAID array.
+type DeviceLayout int
+
+const (
+	// SingleDevice is a device on its own, described by its own config.
+	SingleDevice DeviceLayout = iota
+	// RAID0Layout stripes data across its members, StripeSize at a time, without any redundancy.
+	RAID0Layout
+	// RAID1Layout mirrors data on every member. Reads go to whichever member can serve them first,
+	// while writes go to every member.
+	RAID1Layout
+	// RAID5Layout stripes data across its members along with one parity stripe per row, rotating
+	// between members. Writes of less than a whole row read the old data and parity first.
+	RAID5Layout
+	// RAID6Layout is like RAID5Layout, but with two parity stripes per row.
+	RAID6Layout
+	// TieredLayout puts a fast member, like an SSD, in front of a slow member, like an HDD. Chunks
+	// of StripeSize are copied to the fast member once they've been accessed TierPromoteAfter
+	// times, and written back to the slow member when evicted.
+	TieredLayout
+)
+
+func (l DeviceLayout) String() string {
+	switch l {
+	case SingleDevice:
+		return "SingleDevice"
+	case RAID0Layout:
+		return "RAID0Layout"
+	case RAID1Layout:
+		return "RAID1Layout"
+	case RAID5Layout:
+		return "RAID5Layout"
+	case RAID6Layout:
+		return "RAID6Layout"
+	case TieredLayout:
+		return "TieredLayout"
+	default:
+		return "unknown device layout"
+	}
+}
+
+// ParseDeviceLayoutFromString parses a DeviceLayout from the given string. This function is case
+// insensitive, and also accepts synonyms for each DeviceLayout. For example, raid1layout, raid1 and
+// mirror all map to RAID1Layout.
+func ParseDeviceLayoutFromString(s string) (DeviceLayout, error) {
+	switch strings.ToLower(s) {
+	case "singledevice", "single", "none":
+		return SingleDevice, nil
+	case "raid0layout", "raid0", "stripe", "striped":
+		return RAID0Layout, nil
+	case "raid1layout", "raid1", "mirror", "mirrored":
+		return RAID1Layout, nil
+	case "raid5layout", "raid5":
+		return RAID5Layout, nil
+	case "raid6layout", "raid6":
+		return RAID6Layout, nil
+	case "tieredlayout", "tiered", "tier":
+		return TieredLayout, nil
+	default:
+		return 0, fmt.Errorf("unknown device layout %s", s)
+	}
+}
+
+// minMembers returns how many members a device with this layout needs.
+func (l DeviceLayout) minMembers() int {
+	switch l {
+	case RAID5Layout:
+		return 3
+	case RAID6Layout:
+		return 4
+	case RAID0Layout, RAID1Layout, TieredLayout:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// DefaultDeadlineReadExpire and DefaultDeadlineWriteExpire are how long DeadlineIOScheduler lets
+// reads and writes wait if DeadlineReadExpire or DeadlineWriteExpire aren't set, matching Linux's
+// mq-deadline defaults.
+const (
+	DefaultDeadlineReadExpire  = 500 * time.Millisecond
+	DefaultDeadlineWriteExpire = 5 * time.Second
+)
+
+// DefaultStripeSize is how much data striped layouts put on each member before moving on to the
+// next, and the size of the chunks TieredLayout moves between tiers, if StripeSize isn't set.
+const DefaultStripeSize = 64 * units.Kibibyte
+
+// DefaultPageSize is the page size used by the page cache if PageSize isn't set.
+const DefaultPageSize = 4 * units.Kibibyte
+
+// DefaultDirtyWritebackInterval is how often the flusher wakes up if DirtyWritebackInterval isn't
+// set, matching Linux's default vm.dirty_writeback_centisecs.
+const DefaultDirtyWritebackInterval = 5 * time.Second
+
 // DeviceConfig is used to describe how a physical medium acts (e.g. rotational hard drive).
 type DeviceConfig struct {
 	// Name is the name of this configuration. This is used for selecting on the command line which
@@ -141,10 +481,235 @@ type DeviceConfig struct {
 
 	// MetadataOpTime denotes how long metadata operations (like chmod, chown, etc) should take.
 	MetadataOpTime time.Duration
+
+	// MediaType denotes what kind of medium the device is. Fields below this one are optional in
+	// JSON device configs.
+	MediaType MediaType
+
+	// Channels denotes how many requests a solid state device can work on in parallel (e.g. flash
+	// channels or queue slots), or how many requests can be in flight to network media. Zero is
+	// treated as one. Ignored for rotational media.
+	Channels int
+
+	// ReadLatency denotes the fixed time every read takes on a solid state device before data
+	// starts transferring. For solid state media, ReadBytesPerSecond is the ceiling for the device
+	// as a whole, shared between all channels.
+	ReadLatency time.Duration
+
+	// WriteLatency denotes the fixed time every write takes on a solid state device before data
+	// starts transferring. For solid state media, WriteBytesPerSecond is the ceiling for the device
+	// as a whole, shared between all channels.
+	WriteLatency time.Duration
+
+	// RoundTripTime denotes how long it takes a request to network media to reach the server and
+	// the reply to come back, on top of ReadLatency or WriteLatency. Metadata operations, like
+	// lookups and getattrs, take a round trip on top of MetadataOpTime. Ignored for other media.
+	RoundTripTime time.Duration
+
+	// RoundTripJitter denotes how much longer than RoundTripTime a request to network media can
+	// take, picked at random for each request.
+	RoundTripJitter time.Duration
+
+	// NetworkWindow denotes how much data a request to network media can have in flight before
+	// waiting for it to be acknowledged, like the TCP window, or NFS's rsize and wsize. Requests
+	// transferring more take an extra round trip for each window. Zero means no limit.
+	NetworkWindow units.NumBytes
+
+	// SeekModel denotes which algorithm to use for modeling seeks on rotational media.
+	SeekModel SeekModel
+
+	// DiskCapacity denotes the size of the simulated disk that files are placed on when using
+	// DistanceSeek.
+	DiskCapacity units.NumBytes
+
+	// TrackToTrackSeekTime denotes the time of the shortest possible seek when using DistanceSeek.
+	TrackToTrackSeekTime time.Duration
+
+	// FullStrokeSeekTime denotes the time of a seek across the whole disk when using DistanceSeek.
+	FullStrokeSeekTime time.Duration
+
+	// RPM denotes how fast the platters spin. When using DistanceSeek, every seek additionally
+	// waits half a revolution on average for the data to come under the head.
+	RPM int
+
+	// PageCacheSize denotes how much file data is cached in memory. Reads of cached data don't
+	// touch the device. Zero disables the page cache.
+	PageCacheSize units.NumBytes
+
+	// PageSize denotes the granularity of the page cache. Zero means DefaultPageSize.
+	PageSize units.NumBytes
+
+	// PageCacheEviction denotes which algorithm the page cache uses to evict pages when full.
+	PageCacheEviction EvictionPolicy
+
+	// MemoryBytesPerSecond denotes how fast reads are served from memory, i.e. from the page cache
+	// or data that has been read ahead. Zero means these reads take no time at all.
+	MemoryBytesPerSecond units.NumBytes
+
+	// ReadaheadInitialWindow denotes how much is read ahead when a file starts being read
+	// sequentially. Each time the reader catches up, the window grows up to ReadaheadMaxWindow.
+	// Reading ahead happens in the background, once the read that triggered it has finished.
+	ReadaheadInitialWindow units.NumBytes
+
+	// ReadaheadMaxWindow denotes the most that is read ahead at once. Zero disables read-ahead.
+	ReadaheadMaxWindow units.NumBytes
+
+	// StreamTableSize denotes how many files are tracked to tell whether accesses to them are
+	// sequential, e.g. by the disk's segmented cache. Accesses to other files always seek. Zero
+	// means only the most recently accessed file is tracked.
+	StreamTableSize int
+
+	// DirtyBackgroundBytes and DirtyLimitBytes denote how much data can wait in the write back cache
+	// before writes are throttled, like Linux's vm.dirty_background_bytes and vm.dirty_bytes.
+	// Writes start to be slowed down halfway between the two, and once DirtyLimitBytes is
+	// reached, can only go as fast as the device writes back. Zero DirtyLimitBytes means writes
+	// are never throttled. Only used with a write back cache.
+	DirtyBackgroundBytes units.NumBytes
+	DirtyLimitBytes      units.NumBytes
+
+	// DirtyExpireInterval denotes how long data can wait in the write back cache before the
+	// flusher writes it back, like Linux's vm.dirty_expire_centisecs. The flusher wakes up every
+	// DirtyWritebackInterval, and writes back files with expired data oldest first, keeping the
+	// device busy even if other requests are waiting. Zero means data is only written back in
+	// spare time or on fsync. Only used with a write back cache.
+	DirtyExpireInterval time.Duration
+
+	// DirtyWritebackInterval denotes how often the flusher wakes up. Zero means
+	// DefaultDirtyWritebackInterval.
+	DirtyWritebackInterval time.Duration
+
+	// JournalCommitTime denotes how long writing a journal commit takes, on top of writing back
+	// data, when using JournaledFsync.
+	JournalCommitTime time.Duration
+
+	// JournalPolicy denotes which other files' data is written back when a file is fsynced, when
+	// using JournaledFsync.
+	JournalPolicy JournalPolicy
+
+	// MetadataFsyncTime denotes how long fsyncing a file without any data to write back takes when
+	// using JournaledFsync, e.g. to commit a rename or a change of permissions.
+	MetadataFsyncTime time.Duration
+
+	// DirectIOAlignment denotes what the offset and size of reads and writes to files opened with
+	// O_DIRECT must be a multiple of, or they fail with EINVAL. Zero means they needn't be aligned.
+	DirectIOAlignment units.NumBytes
+
+	// IOScheduler denotes the order queued reads and writes are sent to the device in.
+	IOScheduler IOScheduler
+
+	// DeadlineReadExpire and DeadlineWriteExpire denote how long reads and writes can wait before
+	// DeadlineIOScheduler sends them ahead of others. Zero means DefaultDeadlineReadExpire and
+	// DefaultDeadlineWriteExpire.
+	DeadlineReadExpire  time.Duration
+	DeadlineWriteExpire time.Duration
+
+	// IOLimits denotes limits on how fast particular users, groups and processes can read and
+	// write, and their share of the device with FairIOScheduler.
+	IOLimits IOLimits
+
+	// Layout denotes whether the device is a single device, or is built from the devices named by
+	// Members. Fields a composite device's config leaves out, like SeekTime, come from its members.
+	Layout DeviceLayout
+
+	// Members names the device configs a device with a Layout other than SingleDevice is built
+	// from. For TieredLayout, the first member is the fast tier and the second the slow tier.
+	Members []string
+
+	// MemberConfigs holds the configs named by Members, once ResolveMembers has looked them up.
+	MemberConfigs []*DeviceConfig
+
+	// StripeSize denotes how much data striped layouts put on each member before moving on to the
+	// next, and the size of the chunks TieredLayout moves between tiers. Zero means
+	// DefaultStripeSize.
+	StripeSize units.NumBytes
+
+	// TierCacheSize denotes how much data the fast member of a TieredLayout device holds.
+	TierCacheSize units.NumBytes
+
+	// TierPromoteAfter denotes how many times a chunk on the slow member of a TieredLayout device
+	// is accessed before it's copied to the fast member. Zero means 1.
+	TierPromoteAfter int
+
+	// Distributions holds how duration fields set to a distribution, rather than a constant, vary,
+	// by field name. The fields themselves hold the distributions' medians, and each request picks
+	// its own value from the distribution. Only the durations requests take, listed in
+	// sampledDurations, can be distributions.
+	Distributions map[string]Distribution
+
+	// RandomSeed seeds the random choices made for each request, like picking durations from
+	// Distributions and RoundTripJitter. The same workload with the same seed takes the same time
+	// when run with a simulated clock.
+	RandomSeed int64
+}
+
+// requiredFields lists the fields that every JSON device config must specify.
+var requiredFields = []string{
+	"Name",
+	"SeekWindow",
+	"SeekTime",
+	"ReadBytesPerSecond",
+	"WriteBytesPerSecond",
+	"AllocateBytesPerSecond",
+	"RequestReorderMaxDelay",
+	"FsyncStrategy",
+	"WriteStrategy",
+	"MetadataOpTime",
+}
+
+// optionalFields lists the fields that JSON device configs may leave out, in which case they keep
+// their zero value.
+var optionalFields = []string{
+	"MediaType",
+	"Channels",
+	"ReadLatency",
+	"WriteLatency",
+	"RoundTripTime",
+	"RoundTripJitter",
+	"NetworkWindow",
+	"SeekModel",
+	"DiskCapacity",
+	"TrackToTrackSeekTime",
+	"FullStrokeSeekTime",
+	"RPM",
+	"PageCacheSize",
+	"PageSize",
+	"PageCacheEviction",
+	"MemoryBytesPerSecond",
+	"ReadaheadInitialWindow",
+	"ReadaheadMaxWindow",
+	"StreamTableSize",
+	"DirtyBackgroundBytes",
+	"DirtyLimitBytes",
+	"DirtyExpireInterval",
+	"DirtyWritebackInterval",
+	"JournalCommitTime",
+	"JournalPolicy",
+	"MetadataFsyncTime",
+	"DirectIOAlignment",
+	"IOScheduler",
+	"DeadlineReadExpire",
+	"DeadlineWriteExpire",
+	"IOLimits",
+	"Layout",
+	"Members",
+	"StripeSize",
+	"TierCacheSize",
+	"TierPromoteAfter",
+	"RandomSeed",
+}
+
+// memberFields lists the required fields that configs of composite devices may leave out, in which
+// case ResolveMembers derives them from the members.
+var memberFields = []string{
+	"SeekWindow",
+	"SeekTime",
+	"ReadBytesPerSecond",
+	"WriteBytesPerSecond",
+	"AllocateBytesPerSecond",
 }
 
 func (dc *DeviceConfig) String() string {
-	return fmt.Sprintf(`%s:
+	str := fmt.Sprintf(`%s:
   %-22s %s
   %-22s %s
   %-22s %s
@@ -158,26 +723,452 @@ func (dc *DeviceConfig) String() string {
 		"ReadBytesPerSecond", dc.ReadBytesPerSecond, "WriteBytesPerSecond", dc.WriteBytesPerSecond,
 		"AllocateBytesPerSecond", dc.AllocateBytesPerSecond, "RequestReorderMaxDelay", dc.RequestReorderMaxDelay,
 		"FsyncStrategy", dc.FsyncStrategy, "WriteStrategy", dc.WriteStrategy, "MetadataOpTime", dc.MetadataOpTime)
+
+	if dc.MediaType != RotationalMedia {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %d
+  %-22s %s
+  %-22s %s`,
+			"MediaType", dc.MediaType, "Channels", dc.Channels,
+			"ReadLatency", dc.ReadLatency, "WriteLatency", dc.WriteLatency)
+	}
+
+	if dc.MediaType == NetworkMedia {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s
+  %-22s %s`,
+			"RoundTripTime", dc.RoundTripTime, "RoundTripJitter", dc.RoundTripJitter,
+			"NetworkWindow", dc.NetworkWindow)
+	}
+
+	if dc.SeekModel != FlatSeek {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s
+  %-22s %s
+  %-22s %s
+  %-22s %d`,
+			"SeekModel", dc.SeekModel, "DiskCapacity", dc.DiskCapacity,
+			"TrackToTrackSeekTime", dc.TrackToTrackSeekTime, "FullStrokeSeekTime", dc.FullStrokeSeekTime,
+			"RPM", dc.RPM)
+	}
+
+	if dc.PageCacheSize != 0 {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s
+  %-22s %s
+  %-22s %s`,
+			"PageCacheSize", dc.PageCacheSize, "PageSize", dc.PageSize,
+			"PageCacheEviction", dc.PageCacheEviction, "MemoryBytesPerSecond", dc.MemoryBytesPerSecond)
+	}
+
+	if dc.ReadaheadMaxWindow != 0 {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s`,
+			"ReadaheadInitialWindow", dc.ReadaheadInitialWindow, "ReadaheadMaxWindow", dc.ReadaheadMaxWindow)
+	}
+
+	if dc.StreamTableSize != 0 {
+		str += fmt.Sprintf(`
+  %-22s %d`,
+			"StreamTableSize", dc.StreamTableSize)
+	}
+
+	if dc.DirtyLimitBytes != 0 {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s`,
+			"DirtyBackgroundBytes", dc.DirtyBackgroundBytes, "DirtyLimitBytes", dc.DirtyLimitBytes)
+	}
+
+	if dc.DirtyExpireInterval != 0 {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s`,
+			"DirtyExpireInterval", dc.DirtyExpireInterval, "DirtyWritebackInterval", dc.DirtyWritebackInterval)
+	}
+
+	if dc.FsyncStrategy == JournaledFsync {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s
+  %-22s %s`,
+			"JournalCommitTime", dc.JournalCommitTime, "JournalPolicy", dc.JournalPolicy,
+			"MetadataFsyncTime", dc.MetadataFsyncTime)
+	}
+
+	if dc.DirectIOAlignment != 0 {
+		str += fmt.Sprintf(`
+  %-22s %s`,
+			"DirectIOAlignment", dc.DirectIOAlignment)
+	}
+
+	if dc.IOScheduler != ReorderIOScheduler {
+		str += fmt.Sprintf(`
+  %-22s %s`,
+			"IOScheduler", dc.IOScheduler)
+	}
+
+	if dc.IOScheduler == DeadlineIOScheduler {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s`,
+			"DeadlineReadExpire", dc.ReadExpire(), "DeadlineWriteExpire", dc.WriteExpire())
+	}
+
+	if len(dc.IOLimits) != 0 {
+		str += fmt.Sprintf(`
+  %-22s %s`,
+			"IOLimits", dc.IOLimits)
+	}
+
+	if dc.Layout != SingleDevice {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %s
+  %-22s %s`,
+			"Layout", dc.Layout, "Members", strings.Join(dc.Members, ", "), "StripeSize", dc.Stripe())
+	}
+
+	if dc.Layout == TieredLayout {
+		str += fmt.Sprintf(`
+  %-22s %s
+  %-22s %d`,
+			"TierCacheSize", dc.TierCacheSize, "TierPromoteAfter", dc.PromoteAfter())
+	}
+
+	if len(dc.Distributions) != 0 {
+		names := make([]string, 0, len(dc.Distributions))
+		for name := range dc.Distributions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			d := dc.Distributions[name]
+			names[i] = name + "=" + d.String()
+		}
+		str += fmt.Sprintf(`
+  %-22s %s`,
+			"Distributions", strings.Join(names, "; "))
+	}
+
+	if dc.RandomSeed != 0 {
+		str += fmt.Sprintf(`
+  %-22s %d`,
+			"RandomSeed", dc.RandomSeed)
+	}
+
+	return str
+}
+
+// SetField sets the field with the given name from its string representation, as used in JSON
+// device configs and command line flags.
+func (dc *DeviceConfig) SetField(name, value string) error {
+	var err error
+	switch name {
+	case "Name":
+		dc.Name = value
+	case "SeekWindow":
+		dc.SeekWindow, err = units.ParseNumBytesFromString(value)
+	case "SeekTime":
+		err = dc.setDuration(name, &dc.SeekTime, value)
+	case "ReadBytesPerSecond":
+		dc.ReadBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "WriteBytesPerSecond":
+		dc.WriteBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "AllocateBytesPerSecond":
+		dc.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "RequestReorderMaxDelay":
+		err = dc.setDuration(name, &dc.RequestReorderMaxDelay, value)
+	case "FsyncStrategy":
+		dc.FsyncStrategy, err = ParseFsyncStrategyFromString(value)
+	case "WriteStrategy":
+		dc.WriteStrategy, err = ParseWriteStrategyFromString(value)
+	case "MetadataOpTime":
+		err = dc.setDuration(name, &dc.MetadataOpTime, value)
+	case "MediaType":
+		dc.MediaType, err = ParseMediaTypeFromString(value)
+	case "Channels":
+		dc.Channels, err = strconv.Atoi(value)
+	case "ReadLatency":
+		err = dc.setDuration(name, &dc.ReadLatency, value)
+	case "WriteLatency":
+		err = dc.setDuration(name, &dc.WriteLatency, value)
+	case "RoundTripTime":
+		err = dc.setDuration(name, &dc.RoundTripTime, value)
+	case "RoundTripJitter":
+		err = dc.setDuration(name, &dc.RoundTripJitter, value)
+	case "NetworkWindow":
+		dc.NetworkWindow, err = units.ParseNumBytesFromString(value)
+	case "SeekModel":
+		dc.SeekModel, err = ParseSeekModelFromString(value)
+	case "DiskCapacity":
+		dc.DiskCapacity, err = units.ParseNumBytesFromString(value)
+	case "TrackToTrackSeekTime":
+		err = dc.setDuration(name, &dc.TrackToTrackSeekTime, value)
+	case "FullStrokeSeekTime":
+		err = dc.setDuration(name, &dc.FullStrokeSeekTime, value)
+	case "RPM":
+		dc.RPM, err = strconv.Atoi(value)
+	case "PageCacheSize":
+		dc.PageCacheSize, err = units.ParseNumBytesFromString(value)
+	case "PageSize":
+		dc.PageSize, err = units.ParseNumBytesFromString(value)
+	case "PageCacheEviction":
+		dc.PageCacheEviction, err = ParseEvictionPolicyFromString(value)
+	case "MemoryBytesPerSecond":
+		dc.MemoryBytesPerSecond, err = units.ParseNumBytesFromString(value)
+	case "ReadaheadInitialWindow":
+		dc.ReadaheadInitialWindow, err = units.ParseNumBytesFromString(value)
+	case "ReadaheadMaxWindow":
+		dc.ReadaheadMaxWindow, err = units.ParseNumBytesFromString(value)
+	case "StreamTableSize":
+		dc.StreamTableSize, err = strconv.Atoi(value)
+	case "DirtyBackgroundBytes":
+		dc.DirtyBackgroundBytes, err = units.ParseNumBytesFromString(value)
+	case "DirtyLimitBytes":
+		dc.DirtyLimitBytes, err = units.ParseNumBytesFromString(value)
+	case "DirtyExpireInterval":
+		err = dc.setDuration(name, &dc.DirtyExpireInterval, value)
+	case "DirtyWritebackInterval":
+		err = dc.setDuration(name, &dc.DirtyWritebackInterval, value)
+	case "JournalCommitTime":
+		err = dc.setDuration(name, &dc.JournalCommitTime, value)
+	case "JournalPolicy":
+		dc.JournalPolicy, err = ParseJournalPolicyFromString(value)
+	case "MetadataFsyncTime":
+		err = dc.setDuration(name, &dc.MetadataFsyncTime, value)
+	case "DirectIOAlignment":
+		dc.DirectIOAlignment, err = units.ParseNumBytesFromString(value)
+	case "IOScheduler":
+		dc.IOScheduler, err = ParseIOSchedulerFromString(value)
+	case "DeadlineReadExpire":
+		err = dc.setDuration(name, &dc.DeadlineReadExpire, value)
+	case "DeadlineWriteExpire":
+		err = dc.setDuration(name, &dc.DeadlineWriteExpire, value)
+	case "IOLimits":
+		dc.IOLimits, err = ParseIOLimitsFromString(value)
+	case "Layout":
+		dc.Layout, err = ParseDeviceLayoutFromString(value)
+	case "Members":
+		dc.Members = nil
+		for _, m := range strings.Split(value, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				dc.Members = append(dc.Members, m)
+			}
+		}
+	case "StripeSize":
+		dc.StripeSize, err = units.ParseNumBytesFromString(value)
+	case "TierCacheSize":
+		dc.TierCacheSize, err = units.ParseNumBytesFromString(value)
+	case "TierPromoteAfter":
+		dc.TierPromoteAfter, err = strconv.Atoi(value)
+	case "RandomSeed":
+		dc.RandomSeed, err = strconv.ParseInt(value, 10, 64)
+	default:
+		return fmt.Errorf("unknown field %s", name)
+	}
+	return err
+}
+
+// GetField returns the string representation of the field with the given name, in a form that
+// SetField accepts.
+func (dc *DeviceConfig) GetField(name string) (string, error) {
+	switch name {
+	case "Name":
+		return dc.Name, nil
+	case "SeekWindow":
+		return formatNumBytes(dc.SeekWindow), nil
+	case "SeekTime":
+		return dc.getDuration(name, dc.SeekTime), nil
+	case "ReadBytesPerSecond":
+		return formatNumBytes(dc.ReadBytesPerSecond), nil
+	case "WriteBytesPerSecond":
+		return formatNumBytes(dc.WriteBytesPerSecond), nil
+	case "AllocateBytesPerSecond":
+		return formatNumBytes(dc.AllocateBytesPerSecond), nil
+	case "RequestReorderMaxDelay":
+		return dc.getDuration(name, dc.RequestReorderMaxDelay), nil
+	case "FsyncStrategy":
+		return dc.FsyncStrategy.String(), nil
+	case "WriteStrategy":
+		return dc.WriteStrategy.String(), nil
+	case "MetadataOpTime":
+		return dc.getDuration(name, dc.MetadataOpTime), nil
+	case "MediaType":
+		return dc.MediaType.String(), nil
+	case "Channels":
+		return strconv.Itoa(dc.Channels), nil
+	case "ReadLatency":
+		return dc.getDuration(name, dc.ReadLatency), nil
+	case "WriteLatency":
+		return dc.getDuration(name, dc.WriteLatency), nil
+	case "RoundTripTime":
+		return dc.getDuration(name, dc.RoundTripTime), nil
+	case "RoundTripJitter":
+		return dc.getDuration(name, dc.RoundTripJitter), nil
+	case "NetworkWindow":
+		return formatNumBytes(dc.NetworkWindow), nil
+	case "SeekModel":
+		return dc.SeekModel.String(), nil
+	case "DiskCapacity":
+		return formatNumBytes(dc.DiskCapacity), nil
+	case "TrackToTrackSeekTime":
+		return dc.getDuration(name, dc.TrackToTrackSeekTime), nil
+	case "FullStrokeSeekTime":
+		return dc.getDuration(name, dc.FullStrokeSeekTime), nil
+	case "RPM":
+		return strconv.Itoa(dc.RPM), nil
+	case "PageCacheSize":
+		return formatNumBytes(dc.PageCacheSize), nil
+	case "PageSize":
+		return formatNumBytes(dc.PageSize), nil
+	case "PageCacheEviction":
+		return dc.PageCacheEviction.String(), nil
+	case "MemoryBytesPerSecond":
+		return formatNumBytes(dc.MemoryBytesPerSecond), nil
+	case "ReadaheadInitialWindow":
+		return formatNumBytes(dc.ReadaheadInitialWindow), nil
+	case "ReadaheadMaxWindow":
+		return formatNumBytes(dc.ReadaheadMaxWindow), nil
+	case "StreamTableSize":
+		return strconv.Itoa(dc.StreamTableSize), nil
+	case "DirtyBackgroundBytes":
+		return formatNumBytes(dc.DirtyBackgroundBytes), nil
+	case "DirtyLimitBytes":
+		return formatNumBytes(dc.DirtyLimitBytes), nil
+	case "DirtyExpireInterval":
+		return dc.getDuration(name, dc.DirtyExpireInterval), nil
+	case "DirtyWritebackInterval":
+		return dc.getDuration(name, dc.DirtyWritebackInterval), nil
+	case "JournalCommitTime":
+		return dc.getDuration(name, dc.JournalCommitTime), nil
+	case "JournalPolicy":
+		return dc.JournalPolicy.String(), nil
+	case "MetadataFsyncTime":
+		return dc.getDuration(name, dc.MetadataFsyncTime), nil
+	case "DirectIOAlignment":
+		return formatNumBytes(dc.DirectIOAlignment), nil
+	case "IOScheduler":
+		return dc.IOScheduler.String(), nil
+	case "DeadlineReadExpire":
+		return dc.getDuration(name, dc.DeadlineReadExpire), nil
+	case "DeadlineWriteExpire":
+		return dc.getDuration(name, dc.DeadlineWriteExpire), nil
+	case "IOLimits":
+		return dc.IOLimits.String(), nil
+	case "Layout":
+		return dc.Layout.String(), nil
+	case "Members":
+		return strings.Join(dc.Members, ","), nil
+	case "StripeSize":
+		return formatNumBytes(dc.StripeSize), nil
+	case "TierCacheSize":
+		return formatNumBytes(dc.TierCacheSize), nil
+	case "TierPromoteAfter":
+		return strconv.Itoa(dc.TierPromoteAfter), nil
+	case "RandomSeed":
+		return strconv.FormatInt(dc.RandomSeed, 10), nil
+	default:
+		return "", fmt.Errorf("unknown field %s", name)
+	}
+}
+
+// sampledDurations lists the duration fields that are picked from their distribution for each
+// request. The other duration fields are settings, such as how long to wait before doing
+// something, rather than how long requests take, so must be constants.
+var sampledDurations = map[string]bool{
+	"SeekTime":             true,
+	"MetadataOpTime":       true,
+	"ReadLatency":          true,
+	"WriteLatency":         true,
+	"RoundTripTime":        true,
+	"RoundTripJitter":      true,
+	"TrackToTrackSeekTime": true,
+	"FullStrokeSeekTime":   true,
+	"JournalCommitTime":    true,
+	"MetadataFsyncTime":    true,
+}
+
+// setDuration sets the named duration field from a constant or a distribution, in the format
+// ParseDistributionFromString accepts. Distributions are recorded in Distributions, with the field
+// set to their median.
+func (dc *DeviceConfig) setDuration(name string, field *time.Duration, value string) error {
+	d, err := ParseDistributionFromString(value)
+	if err != nil {
+		return err
+	}
+	if d.Type != ConstantDistribution && !sampledDurations[name] {
+		return fmt.Errorf("%s must be a constant duration, not a distribution", name)
+	}
+	*field = d.Quantile(0.5)
+
+	// Copy the map, so that configs copied from this one aren't changed too.
+	distributions := make(map[string]Distribution, len(dc.Distributions)+1)
+	for k, v := range dc.Distributions {
+		if k != name {
+			distributions[k] = v
+		}
+	}
+	if d.Type != ConstantDistribution {
+		distributions[name] = d
+	}
+	if len(distributions) == 0 {
+		distributions = nil
+	}
+	dc.Distributions = distributions
+	return nil
+}
+
+// getDuration returns the string representation of the named duration field, which is its
+// distribution if it has one.
+func (dc *DeviceConfig) getDuration(name string, field time.Duration) string {
+	if d, ok := dc.Distributions[name]; ok {
+		return d.String()
+	}
+	return field.String()
+}
+
+func formatNumBytes(n units.NumBytes) string {
+	return fmt.Sprintf("%dB", int64(n))
+}
+
+// MarshalJSON encodes the device config in the same format ParseDeviceConfigsFromJSON reads.
+// Optional fields are left out if they have their zero value.
+func (dc *DeviceConfig) MarshalJSON() ([]byte, error) {
+	var zero DeviceConfig
+	obj := make(map[string]string, len(requiredFields)+len(optionalFields))
+	for _, k := range requiredFields {
+		obj[k], _ = dc.GetField(k)
+	}
+	for _, k := range optionalFields {
+		v, _ := dc.GetField(k)
+		if zeroV, _ := zero.GetField(k); v != zeroV {
+			obj[k] = v
+		}
+	}
+	return json.Marshal(obj)
 }
 
 func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 	var dc DeviceConfig
 
-	missingFields := map[string]struct{}{
-		"Name":                   {},
-		"SeekWindow":             {},
-		"SeekTime":               {},
-		"ReadBytesPerSecond":     {},
-		"WriteBytesPerSecond":    {},
-		"AllocateBytesPerSecond": {},
-		"RequestReorderMaxDelay": {},
-		"FsyncStrategy":          {},
-		"WriteStrategy":          {},
-		"MetadataOpTime":         {},
+	knownFields := make(map[string]struct{}, len(requiredFields)+len(optionalFields))
+	missingFields := make(map[string]struct{}, len(requiredFields))
+	for _, k := range requiredFields {
+		knownFields[k] = struct{}{}
+		missingFields[k] = struct{}{}
+	}
+	for _, k := range optionalFields {
+		knownFields[k] = struct{}{}
 	}
 
 	for k, v := range obj {
-		if _, ok := missingFields[k]; !ok {
+		if _, ok := knownFields[k]; !ok {
 			return nil, fmt.Errorf("spurious field %s", k)
 		}
 		delete(missingFields, k)
@@ -187,36 +1178,15 @@ func parseDeviceConfig(obj map[string]interface{}) (*DeviceConfig, error) {
 			return nil, fmt.Errorf("%s: want string type, got %v", k, v)
 		}
 
-		var err error
-		switch k {
-		case "Name":
-			dc.Name = strVal
-		case "SeekWindow":
-			dc.SeekWindow, err = units.ParseNumBytesFromString(strVal)
-		case "SeekTime":
-			dc.SeekTime, err = time.ParseDuration(strVal)
-		case "ReadBytesPerSecond":
-			dc.ReadBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
-		case "WriteBytesPerSecond":
-			dc.WriteBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
-		case "AllocateBytesPerSecond":
-			dc.AllocateBytesPerSecond, err = units.ParseNumBytesFromString(strVal)
-		case "RequestReorderMaxDelay":
-			dc.RequestReorderMaxDelay, err = time.ParseDuration(strVal)
-		case "FsyncStrategy":
-			dc.FsyncStrategy, err = ParseFsyncStrategyFromString(strVal)
-		case "WriteStrategy":
-			dc.WriteStrategy, err = ParseWriteStrategyFromString(strVal)
-		case "MetadataOpTime":
-			dc.MetadataOpTime, err = time.ParseDuration(strVal)
-		default:
-			panic("bug")
-		}
-
-		if err != nil {
+		if err := dc.SetField(k, strVal); err != nil {
 			return nil, fmt.Errorf("%s: %s", k, err)
 		}
+	}
 
+	if dc.Layout != SingleDevice {
+		for _, k := range memberFields {
+			delete(missingFields, k)
+		}
 	}
 
 	if len(missingFields) != 0 {
@@ -259,6 +1229,9 @@ func ParseDeviceConfigsFromJSON(data []byte) ([]*DeviceConfig, error) {
 // don't make sense (like negative delays), it will return an error. If there are field combinations
 // that /probably/ don't make sense it will print a warning message.
 func (dc *DeviceConfig) Validate() error {
+	if err := dc.validateMembers(); err != nil {
+		return err
+	}
 	if dc.SeekWindow < 0 {
 		return errors.New("SeekWindow cannot be negative.")
 	}
@@ -284,7 +1257,125 @@ func (dc *DeviceConfig) Validate() error {
 		return errors.New("MetadataOpTime cannot be negative.")
 	}
 
-	if dc.WriteStrategy == SimulateWrite && dc.FsyncStrategy == WriteBackCachedFsync {
+	if dc.Channels < 0 {
+		return errors.New("Channels cannot be negative.")
+	}
+	if dc.ReadLatency < 0 {
+		return errors.New("ReadLatency cannot be negative.")
+	}
+	if dc.WriteLatency < 0 {
+		return errors.New("WriteLatency cannot be negative.")
+	}
+	if dc.RoundTripTime < 0 {
+		return errors.New("RoundTripTime cannot be negative.")
+	}
+	if dc.RoundTripJitter < 0 {
+		return errors.New("RoundTripJitter cannot be negative.")
+	}
+	if dc.NetworkWindow < 0 {
+		return errors.New("NetworkWindow cannot be negative.")
+	}
+	if (dc.RoundTripTime != 0 || dc.RoundTripJitter != 0 || dc.NetworkWindow != 0) && dc.MediaType != NetworkMedia {
+		log.Println("RoundTripTime, RoundTripJitter and NetworkWindow are ignored without NetworkMedia")
+	}
+	if dc.DiskCapacity < 0 {
+		return errors.New("DiskCapacity cannot be negative.")
+	}
+	if dc.TrackToTrackSeekTime < 0 {
+		return errors.New("TrackToTrackSeekTime cannot be negative.")
+	}
+	if dc.FullStrokeSeekTime < dc.TrackToTrackSeekTime {
+		return errors.New("FullStrokeSeekTime cannot be less than TrackToTrackSeekTime.")
+	}
+	if dc.RPM < 0 {
+		return errors.New("RPM cannot be negative.")
+	}
+	if dc.SeekModel == DistanceSeek && dc.DiskCapacity == 0 {
+		return errors.New("DiskCapacity must be set when using DistanceSeek.")
+	}
+	if dc.PageCacheSize < 0 {
+		return errors.New("PageCacheSize cannot be negative.")
+	}
+	if dc.PageSize < 0 {
+		return errors.New("PageSize cannot be negative.")
+	}
+	if dc.PageCacheSize != 0 && dc.PageCacheSize < dc.CachePageSize() {
+		return errors.New("PageCacheSize must be at least one page.")
+	}
+	if dc.MemoryBytesPerSecond < 0 {
+		return errors.New("MemoryBytesPerSecond cannot be negative.")
+	}
+	if dc.StreamTableSize < 0 {
+		return errors.New("StreamTableSize cannot be negative.")
+	}
+	if dc.DirtyBackgroundBytes < 0 {
+		return errors.New("DirtyBackgroundBytes cannot be negative.")
+	}
+	if dc.DirtyLimitBytes < 0 {
+		return errors.New("DirtyLimitBytes cannot be negative.")
+	}
+	if dc.DirtyLimitBytes != 0 && dc.DirtyBackgroundBytes >= dc.DirtyLimitBytes {
+		return errors.New("DirtyBackgroundBytes must be less than DirtyLimitBytes.")
+	}
+	if dc.DirtyLimitBytes != 0 && !dc.FsyncStrategy.UsesWriteBackCache() {
+		log.Println("DirtyLimitBytes is ignored without a write back cache")
+	}
+	if dc.DirtyExpireInterval < 0 {
+		return errors.New("DirtyExpireInterval cannot be negative.")
+	}
+	if dc.DirtyWritebackInterval < 0 {
+		return errors.New("DirtyWritebackInterval cannot be negative.")
+	}
+	if dc.DirtyExpireInterval != 0 && !dc.FsyncStrategy.UsesWriteBackCache() {
+		log.Println("DirtyExpireInterval is ignored without a write back cache")
+	}
+	if dc.JournalCommitTime < 0 {
+		return errors.New("JournalCommitTime cannot be negative.")
+	}
+	if dc.MetadataFsyncTime < 0 {
+		return errors.New("MetadataFsyncTime cannot be negative.")
+	}
+	if (dc.JournalCommitTime != 0 || dc.MetadataFsyncTime != 0) && dc.FsyncStrategy != JournaledFsync {
+		log.Println("JournalCommitTime and MetadataFsyncTime are ignored without JournaledFsync")
+	}
+	if dc.DirectIOAlignment < 0 {
+		return errors.New("DirectIOAlignment cannot be negative.")
+	}
+	if dc.DeadlineReadExpire < 0 {
+		return errors.New("DeadlineReadExpire cannot be negative.")
+	}
+	if dc.DeadlineWriteExpire < 0 {
+		return errors.New("DeadlineWriteExpire cannot be negative.")
+	}
+	for _, l := range dc.IOLimits {
+		if l.ReadBytesPerSecond < 0 || l.WriteBytesPerSecond < 0 || l.ReadIOPS < 0 || l.WriteIOPS < 0 {
+			return errors.New("IOLimits cannot be negative.")
+		}
+		if l.Weight < 0 || l.Weight > 10000 {
+			return errors.New("IOLimits weights must be between 1 and 10000.")
+		}
+	}
+	if dc.ReadaheadInitialWindow < 0 {
+		return errors.New("ReadaheadInitialWindow cannot be negative.")
+	}
+	if dc.ReadaheadMaxWindow < 0 {
+		return errors.New("ReadaheadMaxWindow cannot be negative.")
+	}
+	if dc.ReadaheadMaxWindow != 0 && dc.ReadaheadInitialWindow == 0 {
+		return errors.New("ReadaheadInitialWindow must be set when ReadaheadMaxWindow is.")
+	}
+	if dc.ReadaheadInitialWindow > dc.ReadaheadMaxWindow {
+		if dc.ReadaheadMaxWindow == 0 {
+			log.Println("ReadaheadInitialWindow is ignored when ReadaheadMaxWindow is 0")
+		} else {
+			return errors.New("ReadaheadInitialWindow cannot be more than ReadaheadMaxWindow.")
+		}
+	}
+	if dc.MediaType == RotationalMedia && dc.Channels > 1 {
+		log.Println("Channels is ignored for rotational media, which can only run one request at a time")
+	}
+
+	if dc.WriteStrategy == SimulateWrite && dc.FsyncStrategy.UsesWriteBackCache() {
 		log.Println("setting both simulated writes and write back cache is probably not what you want. " +
 			"Write back cache is meant to simulate writes being cached in memory and taking minimal time, " +
 			"then being written back to disk later, either during spare IO time or at an fsync.")
@@ -293,6 +1384,132 @@ func (dc *DeviceConfig) Validate() error {
 	return nil
 }
 
+func (dc *DeviceConfig) validateMembers() error {
+	if dc.Layout == SingleDevice {
+		if len(dc.Members) != 0 {
+			log.Println("Members is ignored for SingleDevice")
+		}
+		return nil
+	}
+	if n := dc.Layout.minMembers(); len(dc.Members) < n {
+		return fmt.Errorf("%s needs at least %d Members.", dc.Layout, n)
+	}
+	if dc.Layout == TieredLayout && len(dc.Members) != 2 {
+		return errors.New("TieredLayout needs exactly 2 Members.")
+	}
+	if len(dc.MemberConfigs) != len(dc.Members) {
+		return errors.New("Members must be resolved before use.")
+	}
+	for _, m := range dc.MemberConfigs {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("member %s: %s", m.Name, err)
+		}
+	}
+	if dc.StripeSize < 0 {
+		return errors.New("StripeSize cannot be negative.")
+	}
+	if dc.TierPromoteAfter < 0 {
+		return errors.New("TierPromoteAfter cannot be negative.")
+	}
+	if dc.Layout == TieredLayout && dc.TierCacheSize < dc.Stripe() {
+		return errors.New("TierCacheSize must be at least StripeSize for TieredLayout.")
+	}
+	return nil
+}
+
+// ResolveMembers looks up the configs named by Members, and their own members, in configs. Any of
+// ReadBytesPerSecond, WriteBytesPerSecond and AllocateBytesPerSecond that aren't set are estimated
+// from the members' throughput.
+func (dc *DeviceConfig) ResolveMembers(configs map[string]*DeviceConfig) error {
+	return dc.resolveMembers(configs, make(map[string]bool))
+}
+
+func (dc *DeviceConfig) resolveMembers(configs map[string]*DeviceConfig, resolving map[string]bool) error {
+	if dc.Layout == SingleDevice {
+		return nil
+	}
+	if resolving[dc.Name] {
+		return fmt.Errorf("device config %s is a member of itself", dc.Name)
+	}
+	resolving[dc.Name] = true
+	defer delete(resolving, dc.Name)
+
+	dc.MemberConfigs = make([]*DeviceConfig, 0, len(dc.Members))
+	for _, name := range dc.Members {
+		m, ok := configs[name]
+		if !ok {
+			return fmt.Errorf("device config %s has unknown member %s", dc.Name, name)
+		}
+		if err := m.resolveMembers(configs, resolving); err != nil {
+			return err
+		}
+		dc.MemberConfigs = append(dc.MemberConfigs, m)
+	}
+	if len(dc.MemberConfigs) == 0 {
+		return nil
+	}
+
+	if dc.ReadBytesPerSecond == 0 {
+		dc.ReadBytesPerSecond = dc.arrayThroughput(func(m *DeviceConfig) units.NumBytes { return m.ReadBytesPerSecond }, true)
+	}
+	if dc.WriteBytesPerSecond == 0 {
+		dc.WriteBytesPerSecond = dc.arrayThroughput(func(m *DeviceConfig) units.NumBytes { return m.WriteBytesPerSecond }, false)
+	}
+	if dc.AllocateBytesPerSecond == 0 {
+		dc.AllocateBytesPerSecond = dc.arrayThroughput(func(m *DeviceConfig) units.NumBytes { return m.AllocateBytesPerSecond }, false)
+	}
+	return nil
+}
+
+// arrayThroughput estimates the throughput of a composite device from the given throughput of its
+// members, for reads or for writes.
+func (dc *DeviceConfig) arrayThroughput(throughput func(*DeviceConfig) units.NumBytes, read bool) units.NumBytes {
+	var sum, min units.NumBytes
+	for i, m := range dc.MemberConfigs {
+		t := throughput(m)
+		sum += t
+		if i == 0 || t < min {
+			min = t
+		}
+	}
+	n := units.NumBytes(len(dc.MemberConfigs))
+
+	switch dc.Layout {
+	case RAID0Layout:
+		return sum
+	case RAID1Layout:
+		if read {
+			return sum
+		}
+		return min
+	case RAID5Layout:
+		return (n - 1) * min
+	case RAID6Layout:
+		return (n - 2) * min
+	case TieredLayout:
+		return throughput(dc.MemberConfigs[0])
+	default:
+		return sum
+	}
+}
+
+// Stripe returns how much data striped layouts put on each member before moving on to the next.
+func (dc *DeviceConfig) Stripe() units.NumBytes {
+	if dc.StripeSize == 0 {
+		return DefaultStripeSize
+	}
+	return dc.StripeSize
+}
+
+// PromoteAfter returns how many times a chunk on the slow member of a TieredLayout device is
+// accessed before it's copied to the fast member.
+func (dc *DeviceConfig) PromoteAfter() int {
+	if dc.TierPromoteAfter == 0 {
+		return 1
+	}
+	return dc.TierPromoteAfter
+}
+
 // WriteTime computes how long writing numBytes will take.
 func (dc *DeviceConfig) WriteTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.WriteBytesPerSecond)
@@ -308,6 +1525,56 @@ func (dc *DeviceConfig) AllocateTime(numBytes units.NumBytes) time.Duration {
 	return computeTimeFromThroughput(numBytes, dc.AllocateBytesPerSecond)
 }
 
+// RotationalLatency computes the average time spent waiting for data to come under the head after a
+// seek, which is half a revolution of the platters.
+func (dc *DeviceConfig) RotationalLatency() time.Duration {
+	if dc.RPM <= 0 {
+		return 0
+	}
+	return time.Minute / time.Duration(2*dc.RPM)
+}
+
+// CachePageSize returns the size of the page cache's pages.
+func (dc *DeviceConfig) CachePageSize() units.NumBytes {
+	if dc.PageSize == 0 {
+		return DefaultPageSize
+	}
+	return dc.PageSize
+}
+
+// WritebackInterval returns how often the flusher wakes up to write back expired data.
+func (dc *DeviceConfig) WritebackInterval() time.Duration {
+	if dc.DirtyWritebackInterval == 0 {
+		return DefaultDirtyWritebackInterval
+	}
+	return dc.DirtyWritebackInterval
+}
+
+// ReadExpire returns how long reads can wait before DeadlineIOScheduler sends them ahead of others.
+func (dc *DeviceConfig) ReadExpire() time.Duration {
+	if dc.DeadlineReadExpire == 0 {
+		return DefaultDeadlineReadExpire
+	}
+	return dc.DeadlineReadExpire
+}
+
+// WriteExpire returns how long writes can wait before DeadlineIOScheduler sends them ahead of
+// others.
+func (dc *DeviceConfig) WriteExpire() time.Duration {
+	if dc.DeadlineWriteExpire == 0 {
+		return DefaultDeadlineWriteExpire
+	}
+	return dc.DeadlineWriteExpire
+}
+
+// MemoryTime computes how long reading numBytes from the page cache will take.
+func (dc *DeviceConfig) MemoryTime(numBytes units.NumBytes) time.Duration {
+	if dc.MemoryBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, dc.MemoryBytesPerSecond)
+}
+
 // WritableBytes computes how many bytes can be written in the given duration.
 func (dc *DeviceConfig) WritableBytes(duration time.Duration) units.NumBytes {
 	return computeBytesFromTime(duration, dc.WriteBytesPerSecond)
@@ -347,3 +1614,106 @@ var HDD7200RpmDeviceConfig = DeviceConfig{
 	WriteStrategy:          FastWrite,
 	MetadataOpTime:         10 * time.Millisecond,
 }
+
+// SSDSataDeviceConfig is a basic model of a SATA attached solid state drive.
+var SSDSataDeviceConfig = DeviceConfig{
+	Name:                   "ssd-sata",
+	SeekWindow:             0,
+	SeekTime:               0,
+	ReadBytesPerSecond:     530 * units.Mebibyte,
+	WriteBytesPerSecond:    500 * units.Mebibyte,
+	AllocateBytesPerSecond: 4096 * 500 * units.Mebibyte,
+	// Reordering requests buys nothing when there are no seeks.
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         100 * time.Microsecond,
+	MediaType:              SolidStateMedia,
+	Channels:               8,
+	ReadLatency:            100 * time.Microsecond,
+	WriteLatency:           50 * time.Microsecond,
+}
+
+// NVMeDeviceConfig is a basic model of a PCIe attached NVMe drive.
+var NVMeDeviceConfig = DeviceConfig{
+	Name:                   "nvme",
+	SeekWindow:             0,
+	SeekTime:               0,
+	ReadBytesPerSecond:     3 * units.Gibibyte,
+	WriteBytesPerSecond:    2 * units.Gibibyte,
+	AllocateBytesPerSecond: 4096 * 2 * units.Gibibyte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         20 * time.Microsecond,
+	MediaType:              SolidStateMedia,
+	Channels:               32,
+	ReadLatency:            80 * time.Microsecond,
+	WriteLatency:           20 * time.Microsecond,
+}
+
+// NFSLANDeviceConfig is a basic model of an NFS share on a server on the same gigabit LAN.
+var NFSLANDeviceConfig = DeviceConfig{
+	Name:                   "nfs-lan",
+	SeekWindow:             0,
+	SeekTime:               0,
+	ReadBytesPerSecond:     110 * units.Mebibyte,
+	WriteBytesPerSecond:    110 * units.Mebibyte,
+	AllocateBytesPerSecond: 4096 * 110 * units.Mebibyte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         50 * time.Microsecond,
+	MediaType:              NetworkMedia,
+	// The default number of RPC slots for NFS over TCP.
+	Channels:        16,
+	ReadLatency:     100 * time.Microsecond,
+	WriteLatency:    100 * time.Microsecond,
+	RoundTripTime:   200 * time.Microsecond,
+	RoundTripJitter: 100 * time.Microsecond,
+	NetworkWindow:   units.Mebibyte,
+}
+
+// NFSWANDeviceConfig is a basic model of an NFS share on a server in another region, where the
+// window limits large transfers well below the link's bandwidth.
+var NFSWANDeviceConfig = DeviceConfig{
+	Name:                   "nfs-wan",
+	SeekWindow:             0,
+	SeekTime:               0,
+	ReadBytesPerSecond:     50 * units.Mebibyte,
+	WriteBytesPerSecond:    50 * units.Mebibyte,
+	AllocateBytesPerSecond: 4096 * 50 * units.Mebibyte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         50 * time.Microsecond,
+	MediaType:              NetworkMedia,
+	Channels:               16,
+	ReadLatency:            100 * time.Microsecond,
+	WriteLatency:           100 * time.Microsecond,
+	RoundTripTime:          40 * time.Millisecond,
+	RoundTripJitter:        10 * time.Millisecond,
+	NetworkWindow:          256 * units.Kibibyte,
+}
+
+// ObjectStoreDeviceConfig is a basic model of a cloud object store, which takes a while to start
+// serving each request, but serves many requests at once.
+var ObjectStoreDeviceConfig = DeviceConfig{
+	Name:                   "object-store",
+	SeekWindow:             0,
+	SeekTime:               0,
+	ReadBytesPerSecond:     200 * units.Mebibyte,
+	WriteBytesPerSecond:    100 * units.Mebibyte,
+	AllocateBytesPerSecond: 4096 * 100 * units.Mebibyte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          WriteBackCachedFsync,
+	WriteStrategy:          FastWrite,
+	MetadataOpTime:         10 * time.Millisecond,
+	MediaType:              NetworkMedia,
+	Channels:               64,
+	ReadLatency:            15 * time.Millisecond,
+	WriteLatency:           30 * time.Millisecond,
+	RoundTripTime:          5 * time.Millisecond,
+	RoundTripJitter:        50 * time.Millisecond,
+	NetworkWindow:          8 * units.Mebibyte,
+}
@@ -15,6 +15,7 @@
 package slowfs
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -52,6 +53,190 @@ func ExampleDeviceConfig_String() {
 
 }
 
+func TestDeviceConfig_SetField(t *testing.T) {
+	cases := []struct {
+		field     string
+		value     string
+		want      DeviceConfig
+		shouldErr bool
+	}{
+		{"SeekTime", "5ms", DeviceConfig{SeekTime: 5 * time.Millisecond}, false},
+		{"ReadBytesPerSecond", "1KiB", DeviceConfig{ReadBytesPerSecond: units.Kibibyte}, false},
+		{"MediaType", "ssd", DeviceConfig{MediaType: SolidStateMedia}, false},
+		{"Channels", "4", DeviceConfig{Channels: 4}, false},
+		{"Channels", "four", DeviceConfig{}, true},
+		{"RoundTripTime", "40ms", DeviceConfig{RoundTripTime: 40 * time.Millisecond}, false},
+		{"RoundTripJitter", "10ms", DeviceConfig{RoundTripJitter: 10 * time.Millisecond}, false},
+		{"NetworkWindow", "256KiB", DeviceConfig{NetworkWindow: 256 * units.Kibibyte}, false},
+		{"NetworkWindow", "big", DeviceConfig{}, true},
+		{"SeekModel", "distance", DeviceConfig{SeekModel: DistanceSeek}, false},
+		{"DiskCapacity", "1TB", DeviceConfig{DiskCapacity: units.Terabyte}, false},
+		{"RPM", "7200", DeviceConfig{RPM: 7200}, false},
+		{"PageCacheSize", "1GiB", DeviceConfig{PageCacheSize: units.Gibibyte}, false},
+		{"PageCacheEviction", "2q", DeviceConfig{PageCacheEviction: TwoQueueEviction}, false},
+		{"PageCacheEviction", "mru", DeviceConfig{}, true},
+		{"ReadaheadInitialWindow", "16KiB", DeviceConfig{ReadaheadInitialWindow: 16 * units.Kibibyte}, false},
+		{"ReadaheadMaxWindow", "128KiB", DeviceConfig{ReadaheadMaxWindow: 128 * units.Kibibyte}, false},
+		{"StreamTableSize", "8", DeviceConfig{StreamTableSize: 8}, false},
+		{"StreamTableSize", "many", DeviceConfig{}, true},
+		{"DirtyBackgroundBytes", "64MiB", DeviceConfig{DirtyBackgroundBytes: 64 * units.Mebibyte}, false},
+		{"DirtyLimitBytes", "256MiB", DeviceConfig{DirtyLimitBytes: 256 * units.Mebibyte}, false},
+		{"DirtyExpireInterval", "30s", DeviceConfig{DirtyExpireInterval: 30 * time.Second}, false},
+		{"DirtyWritebackInterval", "5s", DeviceConfig{DirtyWritebackInterval: 5 * time.Second}, false},
+		{"DirtyWritebackInterval", "often", DeviceConfig{}, true},
+		{"JournalCommitTime", "2ms", DeviceConfig{JournalCommitTime: 2 * time.Millisecond}, false},
+		{"JournalPolicy", "older", DeviceConfig{JournalPolicy: JournalOlderFiles}, false},
+		{"JournalPolicy", "sometimes", DeviceConfig{}, true},
+		{"MetadataFsyncTime", "1ms", DeviceConfig{MetadataFsyncTime: time.Millisecond}, false},
+		{"DirectIOAlignment", "4KiB", DeviceConfig{DirectIOAlignment: 4 * units.Kibibyte}, false},
+		{"IOScheduler", "bfq", DeviceConfig{IOScheduler: FairIOScheduler}, false},
+		{"IOScheduler", "anticipatory", DeviceConfig{}, true},
+		{"DeadlineReadExpire", "100ms", DeviceConfig{DeadlineReadExpire: 100 * time.Millisecond}, false},
+		{"DeadlineWriteExpire", "1s", DeviceConfig{DeadlineWriteExpire: time.Second}, false},
+		{"IOLimits", "uid=1000 riops=10", DeviceConfig{IOLimits: IOLimits{{Match: "uid", Value: "1000", ReadIOPS: 10}}}, false},
+		{"IOLimits", "riops=10", DeviceConfig{}, true},
+		{"Layout", "mirror", DeviceConfig{Layout: RAID1Layout}, false},
+		{"Layout", "raid10", DeviceConfig{}, true},
+		{"Members", "ssd, hdd", DeviceConfig{Members: []string{"ssd", "hdd"}}, false},
+		{"Members", "", DeviceConfig{}, false},
+		{"StripeSize", "128KiB", DeviceConfig{StripeSize: 128 * units.Kibibyte}, false},
+		{"TierCacheSize", "1GiB", DeviceConfig{TierCacheSize: units.Gibibyte}, false},
+		{"TierPromoteAfter", "2", DeviceConfig{TierPromoteAfter: 2}, false},
+		{"TierPromoteAfter", "twice", DeviceConfig{}, true},
+		{"ReadLatency", "uniform(1ms,3ms)", DeviceConfig{ReadLatency: 2 * time.Millisecond,
+			Distributions: map[string]Distribution{"ReadLatency": {Type: UniformDistribution,
+				Min: time.Millisecond, Max: 3 * time.Millisecond}}}, false},
+		{"MetadataOpTime", "constant(1ms)", DeviceConfig{MetadataOpTime: time.Millisecond}, false},
+		{"SeekTime", "bell(1ms)", DeviceConfig{}, true},
+		{"RandomSeed", "-42", DeviceConfig{RandomSeed: -42}, false},
+		{"RandomSeed", "lucky", DeviceConfig{}, true},
+		{"Chicken", "4", DeviceConfig{}, true},
+	}
+
+	for _, c := range cases {
+		var got DeviceConfig
+		err := got.SetField(c.field, c.value)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("SetField(%s, %s) = %v, want error: %t", c.field, c.value, err, c.shouldErr)
+		}
+		if !c.shouldErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("SetField(%s, %s) gives %s, want %s", c.field, c.value, &got, &c.want)
+		}
+	}
+}
+
+func ExampleDeviceConfig_String_solidState() {
+	n := DeviceConfig{
+		Name:                   "example",
+		ReadBytesPerSecond:     500 * units.Mebibyte,
+		WriteBytesPerSecond:    400 * units.Mebibyte,
+		AllocateBytesPerSecond: 4096 * 400 * units.Mebibyte,
+		FsyncStrategy:          WriteBackCachedFsync,
+		WriteStrategy:          FastWrite,
+		MetadataOpTime:         100 * time.Microsecond,
+		MediaType:              SolidStateMedia,
+		Channels:               8,
+		ReadLatency:            100 * time.Microsecond,
+		WriteLatency:           50 * time.Microsecond,
+	}
+
+	fmt.Println(n.String())
+	// Output:
+	// example:
+	//   SeekWindow             0B (0)
+	//   SeekTime               0s
+	//   ReadBytesPerSecond     524.29MB (524288000)
+	//   WriteBytesPerSecond    419.43MB (419430400)
+	//   AllocateBytesPerSecond 1.72TB (1717986918400)
+	//   RequestReorderMaxDelay 0s
+	//   FsyncStrategy          WriteBackCachedFsync
+	//   WriteStrategy          FastWrite
+	//   MetadataOpTime         100µs
+	//   MediaType              SolidStateMedia
+	//   Channels               8
+	//   ReadLatency            100µs
+	//   WriteLatency           50µs
+}
+
+func TestDeviceConfig_SetField_distributions(t *testing.T) {
+	dc := NVMeDeviceConfig
+	if err := dc.SetField("WriteLatency", "p50=20µs,p99=1ms"); err != nil {
+		t.Fatalf("SetField(WriteLatency, p50=20µs,p99=1ms) error: %s", err)
+	}
+	if _, ok := NVMeDeviceConfig.Distributions["WriteLatency"]; ok {
+		t.Errorf("SetField(WriteLatency, p50=20µs,p99=1ms) changed the config it was copied from")
+	}
+	if got, want := dc.WriteLatency, 20*time.Microsecond; got != want {
+		t.Errorf("SetField(WriteLatency, p50=20µs,p99=1ms) sets WriteLatency to %s, want %s", got, want)
+	}
+	if got, _ := dc.GetField("WriteLatency"); got != "p50=20µs,p99=1ms" {
+		t.Errorf("GetField(WriteLatency) = %s, want p50=20µs,p99=1ms", got)
+	}
+
+	if err := dc.SetField("WriteLatency", "30µs"); err != nil {
+		t.Fatalf("SetField(WriteLatency, 30µs) error: %s", err)
+	}
+	if dc.Distributions != nil {
+		t.Errorf("SetField(WriteLatency, 30µs) left Distributions %v, want none", dc.Distributions)
+	}
+
+	// Durations that aren't picked for each request can't be distributions.
+	if err := dc.SetField("DirtyExpireInterval", "uniform(10s,30s)"); err == nil {
+		t.Errorf("SetField(DirtyExpireInterval, uniform(10s,30s)) succeeded, want error")
+	}
+	if err := dc.SetField("DirtyExpireInterval", "10s"); err != nil {
+		t.Errorf("SetField(DirtyExpireInterval, 10s) error: %s", err)
+	}
+}
+
+func TestDeviceConfig_MarshalJSON(t *testing.T) {
+	distributed := NFSWANDeviceConfig
+	distributed.RandomSeed = 7
+	distributed.SetField("RoundTripTime", "lognormal(40ms,0.5)")
+	distributed.SetField("MetadataOpTime", "p50=1ms,p99.9=20ms")
+	cases := []DeviceConfig{HDD7200RpmDeviceConfig, SSDSataDeviceConfig, NVMeDeviceConfig,
+		NFSLANDeviceConfig, NFSWANDeviceConfig, ObjectStoreDeviceConfig, distributed}
+
+	for _, c := range cases {
+		data, err := json.Marshal([]*DeviceConfig{&c})
+		if err != nil {
+			t.Errorf("json.Marshal(%s) error: %s", &c, err)
+			continue
+		}
+		got, err := ParseDeviceConfigsFromJSON(data)
+		if err != nil {
+			t.Errorf("ParseDeviceConfigsFromJSON(%s) error: %s", data, err)
+		} else if want := []*DeviceConfig{&c}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseDeviceConfigsFromJSON(%s) = %s, want %s", data, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_GetField(t *testing.T) {
+	cases := []struct {
+		field     string
+		want      string
+		shouldErr bool
+	}{
+		{"Name", "hdd7200rpm", false},
+		{"SeekWindow", "4096B", false},
+		{"SeekTime", "10ms", false},
+		{"FsyncStrategy", "WriteBackCachedFsync", false},
+		{"Channels", "0", false},
+		{"Chicken", "", true},
+	}
+
+	for _, c := range cases {
+		got, err := HDD7200RpmDeviceConfig.GetField(c.field)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("GetField(%s) = _, %v, want error: %t", c.field, err, c.shouldErr)
+		}
+		if got != c.want {
+			t.Errorf("GetField(%s) = %s, want %s", c.field, got, c.want)
+		}
+	}
+}
+
 func TestComputeTimeFromThroughput(t *testing.T) {
 	cases := []struct {
 		numBytes       units.NumBytes
@@ -101,6 +286,7 @@ func TestFsyncStrategy_String(t *testing.T) {
 		{NoFsync, "NoFsync"},
 		{DumbFsync, "DumbFsync"},
 		{WriteBackCachedFsync, "WriteBackCachedFsync"},
+		{JournaledFsync, "JournaledFsync"},
 		{12345, "unknown fsync strategy"},
 	}
 
@@ -124,6 +310,8 @@ func TestParseFsyncStrategyFromString(t *testing.T) {
 		{"dumb", DumbFsync, false},
 		{"WriTeBaCkCacHedFsync", WriteBackCachedFsync, false},
 		{"wbc", WriteBackCachedFsync, false},
+		{"JournaledFsync", JournaledFsync, false},
+		{"journal", JournaledFsync, false},
 		{"asdfasdf", 0, true},
 	}
 
@@ -191,195 +379,729 @@ func TestParseWriteStrategyFromString(t *testing.T) {
 	}
 }
 
-func TestParseDeviceConfigsFromJSON(t *testing.T) {
+func TestMediaType_String(t *testing.T) {
 	cases := []struct {
-		jsonDeviceConfig string
-		want             []*DeviceConfig
-		shouldErr        bool
+		mediaType MediaType
+		want      string
 	}{
-		{"", nil, true},
-		{"asdfasdf", nil, true},
-		{"{}", nil, true},
-		{`{"unrecognisedfield":"test"}`, nil, true},
-		{`[{"Name":"invalidvalue"}]`, nil, true},
-		{
-			`{
-			  "Name": "7200",
-			  "SeekWindow": "4KiB",
-			  "SeekTime": "10ms",
-			  "ReadBytesPerSecond": "100MiB",
-			  "WriteBytesPerSecond": "123KiB",
-			  "AllocateBytesPerSecond": "100B",
-			  "RequestReorderMaxDelay": "100us",
-			  "FsyncStrategy": "wbc",
-			  "WriteStrategy": "fastwrite",
-			  "MetadataOpTime": "123s"
-			}`,
-			nil,
-			true,
-		},
-		{
-			`[{
-			  "Name": "7200",
-			  "SeekWindow": "4KiB",
-			  "SeekTime": "10ms",
-			  "ReadBytesPerSecond": "100aiB",
-			  "WriteBytesPerSecond": "123KiB",
-			  "AllocateBytesPerSecond": "100B",
-			  "RequestReorderMaxDelay": "100us",
-			  "FsyncStrategy": "wbc",
-			  "WriteStrategy": "fastwrite",
-			  "MetadataOpTime": "123s"
-			}]`,
-			nil,
-			true,
-		},
-		{
-			`[{
-			  "Name": "7200",
-			  "SeekWindow": "4KiB",
-			  "SeekTime": "10ms",
-			  "ReadBytesPerSecond": "100MiB",
-			  "WriteBytesPerSecond": "123KiB",
-			  "AllocateBytesPerSecond": "100B",
-			  "RequestReorderMaxDelay": "100us",
-			  "FsyncStrategy": "wbc",
-			  "WriteStrategy": "fastwrite",
-			  "MetadataOpTime": "123s"
-			}]`,
-			[]*DeviceConfig{{
-				Name:                   "7200",
-				SeekWindow:             4 * units.Kibibyte,
-				SeekTime:               10 * time.Millisecond,
-				ReadBytesPerSecond:     100 * units.Mebibyte,
-				WriteBytesPerSecond:    123 * units.Kibibyte,
-				AllocateBytesPerSecond: 100 * units.Byte,
-				RequestReorderMaxDelay: 100 * time.Microsecond,
-				FsyncStrategy:          WriteBackCachedFsync,
-				WriteStrategy:          FastWrite,
-				MetadataOpTime:         123 * time.Second,
-			}},
-			false,
-		},
-		{
-			`[{
-			  "Name": "7200",
-			  "SeekWindow": "4KiB",
-			  "SeekTime": "10ms",
-			  "ReadBytesPerSecond": "100MiB",
-			  "WriteBytesPerSecond": "123KiB",
-			  "AllocateBytesPerSecond": "100B",
-			  "RequestReorderMaxDelay": "100us",
-			  "FsyncStrategy": "wbc",
-			  "WriteStrategy": "fastwrite",
-			  "MetadataOpTime": "123s"
-			},
-			{
-			  "Name": "chicken",
-			  "SeekWindow": "0B",
-			  "SeekTime": "1ms",
-			  "ReadBytesPerSecond": "1B",
-			  "WriteBytesPerSecond": "1B",
-			  "AllocateBytesPerSecond": "1B",
-			  "RequestReorderMaxDelay": "1us",
-			  "FsyncStrategy": "no",
-			  "WriteStrategy": "simulate",
-			  "MetadataOpTime": "0s"
-			}]`,
-			[]*DeviceConfig{
-				{
-					Name:                   "7200",
-					SeekWindow:             4 * units.Kibibyte,
-					SeekTime:               10 * time.Millisecond,
-					ReadBytesPerSecond:     100 * units.Mebibyte,
-					WriteBytesPerSecond:    123 * units.Kibibyte,
-					AllocateBytesPerSecond: 100 * units.Byte,
-					RequestReorderMaxDelay: 100 * time.Microsecond,
-					FsyncStrategy:          WriteBackCachedFsync,
-					WriteStrategy:          FastWrite,
-					MetadataOpTime:         123 * time.Second,
-				},
-				{
-					Name:                   "chicken",
-					SeekWindow:             0,
-					SeekTime:               1 * time.Millisecond,
-					ReadBytesPerSecond:     1 * units.Byte,
-					WriteBytesPerSecond:    1 * units.Byte,
-					AllocateBytesPerSecond: 1 * units.Byte,
-					RequestReorderMaxDelay: 1 * time.Microsecond,
-					FsyncStrategy:          NoFsync,
-					WriteStrategy:          SimulateWrite,
-					MetadataOpTime:         0,
-				},
-			},
-			false,
-		},
+		{RotationalMedia, "RotationalMedia"},
+		{SolidStateMedia, "SolidStateMedia"},
+		{NetworkMedia, "NetworkMedia"},
+		{12345, "unknown media type"},
 	}
 
 	for _, c := range cases {
-		got, err := ParseDeviceConfigsFromJSON([]byte(c.jsonDeviceConfig))
+		if got, want := c.mediaType.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.mediaType, got, want)
+		}
+	}
+}
 
-		if c.shouldErr && err == nil {
-			t.Errorf("ParseDeviceConfigsFromJSON(%s) = %s, should error", c.jsonDeviceConfig, got)
-		} else if !c.shouldErr {
-			if err != nil {
-				t.Errorf("ParseDeviceConfigsFromJSON(%s) error: %s, want %s", c.jsonDeviceConfig, err, c.want)
-			} else if want := c.want; !reflect.DeepEqual(got, want) {
-				t.Errorf("ParseDeviceConfigsFromJSON(%s) = %s, want %s", c.jsonDeviceConfig, got, want)
-			}
+func TestParseMediaTypeFromString(t *testing.T) {
+	cases := []struct {
+		strMediaType string
+		want         MediaType
+		shouldErr    bool
+	}{
+		{"rOtAtionalMedia", RotationalMedia, false},
+		{"rotational", RotationalMedia, false},
+		{"HDD", RotationalMedia, false},
+		{"SolidStateMedia", SolidStateMedia, false},
+		{"solidstate", SolidStateMedia, false},
+		{"ssd", SolidStateMedia, false},
+		{"flash", SolidStateMedia, false},
+		{"NetworkMedia", NetworkMedia, false},
+		{"NFS", NetworkMedia, false},
+		{"remote", NetworkMedia, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseMediaTypeFromString(c.strMediaType)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseMediaTypeFromString(%s) = %s, want %s", c.strMediaType, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseMediaTypeFromString(%s) = _, %v, want _, %v", c.strMediaType, err, expectedErr)
 		}
 	}
 }
 
-func TestDeviceConfig_Validate(t *testing.T) {
+func TestSeekModel_String(t *testing.T) {
 	cases := []struct {
-		deviceConfig *DeviceConfig
+		seekModel SeekModel
+		want      string
+	}{
+		{FlatSeek, "FlatSeek"},
+		{DistanceSeek, "DistanceSeek"},
+		{12345, "unknown seek model"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.seekModel.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.seekModel, got, want)
+		}
+	}
+}
+
+func TestParseSeekModelFromString(t *testing.T) {
+	cases := []struct {
+		strSeekModel string
+		want         SeekModel
 		shouldErr    bool
 	}{
+		{"fLatSeek", FlatSeek, false},
+		{"flat", FlatSeek, false},
+		{"DistanceSeek", DistanceSeek, false},
+		{"distance", DistanceSeek, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseSeekModelFromString(c.strSeekModel)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseSeekModelFromString(%s) = %s, want %s", c.strSeekModel, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseSeekModelFromString(%s) = _, %v, want _, %v", c.strSeekModel, err, expectedErr)
+		}
+	}
+}
+
+func TestEvictionPolicy_String(t *testing.T) {
+	cases := []struct {
+		evictionPolicy EvictionPolicy
+		want           string
+	}{
+		{LRUEviction, "LRUEviction"},
+		{TwoQueueEviction, "TwoQueueEviction"},
+		{12345, "unknown eviction policy"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.evictionPolicy.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.evictionPolicy, got, want)
+		}
+	}
+}
+
+func TestParseEvictionPolicyFromString(t *testing.T) {
+	cases := []struct {
+		strEvictionPolicy string
+		want              EvictionPolicy
+		shouldErr         bool
+	}{
+		{"lruEviction", LRUEviction, false},
+		{"LRU", LRUEviction, false},
+		{"TwoQueueEviction", TwoQueueEviction, false},
+		{"twoqueue", TwoQueueEviction, false},
+		{"2Q", TwoQueueEviction, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseEvictionPolicyFromString(c.strEvictionPolicy)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseEvictionPolicyFromString(%s) = %s, want %s", c.strEvictionPolicy, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseEvictionPolicyFromString(%s) = _, %v, want _, %v", c.strEvictionPolicy, err, expectedErr)
+		}
+	}
+}
+
+func TestJournalPolicy_String(t *testing.T) {
+	cases := []struct {
+		journalPolicy JournalPolicy
+		want          string
+	}{
+		{JournalAllFiles, "JournalAllFiles"},
+		{JournalOlderFiles, "JournalOlderFiles"},
+		{JournalFileOnly, "JournalFileOnly"},
+		{12345, "unknown journal policy"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.journalPolicy.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.journalPolicy, got, want)
+		}
+	}
+}
+
+func TestParseJournalPolicyFromString(t *testing.T) {
+	cases := []struct {
+		strJournalPolicy string
+		want             JournalPolicy
+		shouldErr        bool
+	}{
+		{"journalAllFiles", JournalAllFiles, false},
+		{"ordered", JournalAllFiles, false},
+		{"JournalOlderFiles", JournalOlderFiles, false},
+		{"older", JournalOlderFiles, false},
+		{"journalfileonly", JournalFileOnly, false},
+		{"WriteBack", JournalFileOnly, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseJournalPolicyFromString(c.strJournalPolicy)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseJournalPolicyFromString(%s) = %s, want %s", c.strJournalPolicy, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseJournalPolicyFromString(%s) = _, %v, want _, %v", c.strJournalPolicy, err, expectedErr)
+		}
+	}
+}
+
+func TestIOScheduler_String(t *testing.T) {
+	cases := []struct {
+		ioScheduler IOScheduler
+		want        string
+	}{
+		{ReorderIOScheduler, "ReorderIOScheduler"},
+		{NoopIOScheduler, "NoopIOScheduler"},
+		{DeadlineIOScheduler, "DeadlineIOScheduler"},
+		{ElevatorIOScheduler, "ElevatorIOScheduler"},
+		{FairIOScheduler, "FairIOScheduler"},
+		{12345, "unknown I/O scheduler"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.ioScheduler.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.ioScheduler, got, want)
+		}
+	}
+}
+
+func TestParseIOSchedulerFromString(t *testing.T) {
+	cases := []struct {
+		strIOScheduler string
+		want           IOScheduler
+		shouldErr      bool
+	}{
+		{"ReorderIOScheduler", ReorderIOScheduler, false},
+		{"reorder", ReorderIOScheduler, false},
+		{"NOOP", NoopIOScheduler, false},
+		{"fifo", NoopIOScheduler, false},
+		{"mq-deadline", DeadlineIOScheduler, false},
+		{"C-LOOK", ElevatorIOScheduler, false},
+		{"elevator", ElevatorIOScheduler, false},
+		{"bfq", FairIOScheduler, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseIOSchedulerFromString(c.strIOScheduler)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseIOSchedulerFromString(%s) = %s, want %s", c.strIOScheduler, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseIOSchedulerFromString(%s) = _, %v, want _, %v", c.strIOScheduler, err, expectedErr)
+		}
+	}
+}
+
+func TestDeviceLayout_String(t *testing.T) {
+	cases := []struct {
+		layout DeviceLayout
+		want   string
+	}{
+		{SingleDevice, "SingleDevice"},
+		{RAID0Layout, "RAID0Layout"},
+		{RAID1Layout, "RAID1Layout"},
+		{RAID5Layout, "RAID5Layout"},
+		{RAID6Layout, "RAID6Layout"},
+		{TieredLayout, "TieredLayout"},
+		{12345, "unknown device layout"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.layout.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.layout, got, want)
+		}
+	}
+}
+
+func TestParseDeviceLayoutFromString(t *testing.T) {
+	cases := []struct {
+		strLayout string
+		want      DeviceLayout
+		shouldErr bool
+	}{
+		{"SingleDevice", SingleDevice, false},
+		{"none", SingleDevice, false},
+		{"RAID0", RAID0Layout, false},
+		{"stripe", RAID0Layout, false},
+		{"mirror", RAID1Layout, false},
+		{"raid5", RAID5Layout, false},
+		{"RAID6Layout", RAID6Layout, false},
+		{"tiered", TieredLayout, false},
+		{"asdfasdf", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseDeviceLayoutFromString(c.strLayout)
+		var expectedErr error
+		if c.shouldErr {
+			expectedErr = errors.New("expected an error")
+		}
+
+		if got != c.want {
+			t.Errorf("ParseDeviceLayoutFromString(%s) = %s, want %s", c.strLayout, got, c.want)
+		}
+
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseDeviceLayoutFromString(%s) = _, %v, want _, %v", c.strLayout, err, expectedErr)
+		}
+	}
+}
+
+func TestDeviceConfig_ResolveMembers(t *testing.T) {
+	fast := &DeviceConfig{Name: "fast", ReadBytesPerSecond: 400, WriteBytesPerSecond: 200, AllocateBytesPerSecond: 1000}
+	slow := &DeviceConfig{Name: "slow", ReadBytesPerSecond: 100, WriteBytesPerSecond: 50, AllocateBytesPerSecond: 100}
+
+	cases := []struct {
+		desc      string
+		config    *DeviceConfig
+		wantRead  units.NumBytes
+		wantWrite units.NumBytes
+		shouldErr bool
+	}{
+		{
+			desc:      "raid0 adds up members",
+			config:    &DeviceConfig{Name: "a", Layout: RAID0Layout, Members: []string{"fast", "slow"}},
+			wantRead:  500,
+			wantWrite: 250,
+		},
+		{
+			desc:      "raid1 reads from both but writes to both",
+			config:    &DeviceConfig{Name: "a", Layout: RAID1Layout, Members: []string{"fast", "slow"}},
+			wantRead:  500,
+			wantWrite: 50,
+		},
+		{
+			desc:      "raid5 loses a member to parity",
+			config:    &DeviceConfig{Name: "a", Layout: RAID5Layout, Members: []string{"fast", "slow", "slow"}},
+			wantRead:  200,
+			wantWrite: 100,
+		},
+		{
+			desc:      "raid6 loses two members to parity",
+			config:    &DeviceConfig{Name: "a", Layout: RAID6Layout, Members: []string{"fast", "slow", "slow", "slow"}},
+			wantRead:  200,
+			wantWrite: 100,
+		},
+		{
+			desc:      "tiered runs at the fast member's speed",
+			config:    &DeviceConfig{Name: "a", Layout: TieredLayout, Members: []string{"fast", "slow"}},
+			wantRead:  400,
+			wantWrite: 200,
+		},
+		{
+			desc:      "set throughput is kept",
+			config:    &DeviceConfig{Name: "a", Layout: RAID0Layout, Members: []string{"fast", "slow"}, ReadBytesPerSecond: 1},
+			wantRead:  1,
+			wantWrite: 250,
+		},
+		{
+			desc:      "nested members",
+			config:    &DeviceConfig{Name: "a", Layout: RAID1Layout, Members: []string{"fast", "stripe"}},
+			wantRead:  900,
+			wantWrite: 200,
+		},
+		{
+			desc:      "unknown member",
+			config:    &DeviceConfig{Name: "a", Layout: RAID0Layout, Members: []string{"fast", "chicken"}},
+			shouldErr: true,
+		},
+		{
+			desc:      "member of itself",
+			config:    &DeviceConfig{Name: "a", Layout: RAID0Layout, Members: []string{"fast", "a"}},
+			shouldErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		configs := map[string]*DeviceConfig{
+			"fast":   fast,
+			"slow":   slow,
+			"stripe": {Name: "stripe", Layout: RAID0Layout, Members: []string{"fast", "slow"}},
+			"a":      c.config,
+		}
+		err := c.config.ResolveMembers(configs)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("fail (%s) ResolveMembers() = %v, want error: %t", c.desc, err, c.shouldErr)
+		}
+		if c.shouldErr {
+			continue
+		}
+		if got, want := c.config.ReadBytesPerSecond, c.wantRead; got != want {
+			t.Errorf("fail (%s) ReadBytesPerSecond = %d, want %d", c.desc, got, want)
+		}
+		if got, want := c.config.WriteBytesPerSecond, c.wantWrite; got != want {
+			t.Errorf("fail (%s) WriteBytesPerSecond = %d, want %d", c.desc, got, want)
+		}
+		if got, want := len(c.config.MemberConfigs), len(c.config.Members); got != want {
+			t.Errorf("fail (%s) resolved %d members, want %d", c.desc, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_MemoryTime(t *testing.T) {
+	cases := []struct {
+		memoryBytesPerSecond units.NumBytes
+		numBytes             units.NumBytes
+		want                 time.Duration
+	}{
+		{0, units.Gibibyte, 0},
+		{units.Gibibyte, units.Gibibyte, time.Second},
+		{4 * units.Kibibyte, units.Kibibyte, 250 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := DeviceConfig{MemoryBytesPerSecond: c.memoryBytesPerSecond}
+		if got, want := dc.MemoryTime(c.numBytes), c.want; got != want {
+			t.Errorf("MemoryTime(%s) with MemoryBytesPerSecond %s = %s, want %s", c.numBytes,
+				c.memoryBytesPerSecond, got, want)
+		}
+	}
+}
+
+func TestDeviceConfig_RotationalLatency(t *testing.T) {
+	cases := []struct {
+		rpm  int
+		want time.Duration
+	}{
+		{0, 0},
+		{7200, 4166666 * time.Nanosecond},
+		{6000, 5 * time.Millisecond},
+		{15000, 2 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		dc := DeviceConfig{RPM: c.rpm}
+		if got, want := dc.RotationalLatency(), c.want; got != want {
+			t.Errorf("RotationalLatency() with RPM %d = %s, want %s", c.rpm, got, want)
+		}
+	}
+}
+
+func TestParseDeviceConfigsFromJSON(t *testing.T) {
+	cases := []struct {
+		jsonDeviceConfig string
+		want             []*DeviceConfig
+		shouldErr        bool
+	}{
+		{"", nil, true},
+		{"asdfasdf", nil, true},
+		{"{}", nil, true},
+		{`{"unrecognisedfield":"test"}`, nil, true},
+		{`[{"Name":"invalidvalue"}]`, nil, true},
+		{
+			`{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s"
+			}`,
+			nil,
+			true,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100aiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s"
+			}]`,
+			nil,
+			true,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s"
+			}]`,
+			[]*DeviceConfig{{
+				Name:                   "7200",
+				SeekWindow:             4 * units.Kibibyte,
+				SeekTime:               10 * time.Millisecond,
+				ReadBytesPerSecond:     100 * units.Mebibyte,
+				WriteBytesPerSecond:    123 * units.Kibibyte,
+				AllocateBytesPerSecond: 100 * units.Byte,
+				RequestReorderMaxDelay: 100 * time.Microsecond,
+				FsyncStrategy:          WriteBackCachedFsync,
+				WriteStrategy:          FastWrite,
+				MetadataOpTime:         123 * time.Second,
+			}},
+			false,
+		},
+		{
+			`[{
+			  "Name": "7200",
+			  "SeekWindow": "4KiB",
+			  "SeekTime": "10ms",
+			  "ReadBytesPerSecond": "100MiB",
+			  "WriteBytesPerSecond": "123KiB",
+			  "AllocateBytesPerSecond": "100B",
+			  "RequestReorderMaxDelay": "100us",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fastwrite",
+			  "MetadataOpTime": "123s"
+			},
+			{
+			  "Name": "chicken",
+			  "SeekWindow": "0B",
+			  "SeekTime": "1ms",
+			  "ReadBytesPerSecond": "1B",
+			  "WriteBytesPerSecond": "1B",
+			  "AllocateBytesPerSecond": "1B",
+			  "RequestReorderMaxDelay": "1us",
+			  "FsyncStrategy": "no",
+			  "WriteStrategy": "simulate",
+			  "MetadataOpTime": "0s"
+			}]`,
+			[]*DeviceConfig{
+				{
+					Name:                   "7200",
+					SeekWindow:             4 * units.Kibibyte,
+					SeekTime:               10 * time.Millisecond,
+					ReadBytesPerSecond:     100 * units.Mebibyte,
+					WriteBytesPerSecond:    123 * units.Kibibyte,
+					AllocateBytesPerSecond: 100 * units.Byte,
+					RequestReorderMaxDelay: 100 * time.Microsecond,
+					FsyncStrategy:          WriteBackCachedFsync,
+					WriteStrategy:          FastWrite,
+					MetadataOpTime:         123 * time.Second,
+				},
+				{
+					Name:                   "chicken",
+					SeekWindow:             0,
+					SeekTime:               1 * time.Millisecond,
+					ReadBytesPerSecond:     1 * units.Byte,
+					WriteBytesPerSecond:    1 * units.Byte,
+					AllocateBytesPerSecond: 1 * units.Byte,
+					RequestReorderMaxDelay: 1 * time.Microsecond,
+					FsyncStrategy:          NoFsync,
+					WriteStrategy:          SimulateWrite,
+					MetadataOpTime:         0,
+				},
+			},
+			false,
+		},
+		{
+			`[{
+			  "Name": "flash",
+			  "SeekWindow": "0B",
+			  "SeekTime": "0s",
+			  "ReadBytesPerSecond": "500MiB",
+			  "WriteBytesPerSecond": "400MiB",
+			  "AllocateBytesPerSecond": "1GiB",
+			  "RequestReorderMaxDelay": "0s",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fast",
+			  "MetadataOpTime": "100us",
+			  "MediaType": "ssd",
+			  "Channels": "8",
+			  "ReadLatency": "90us",
+			  "WriteLatency": "40us"
+			}]`,
+			[]*DeviceConfig{{
+				Name:                   "flash",
+				ReadBytesPerSecond:     500 * units.Mebibyte,
+				WriteBytesPerSecond:    400 * units.Mebibyte,
+				AllocateBytesPerSecond: 1 * units.Gibibyte,
+				FsyncStrategy:          WriteBackCachedFsync,
+				WriteStrategy:          FastWrite,
+				MetadataOpTime:         100 * time.Microsecond,
+				MediaType:              SolidStateMedia,
+				Channels:               8,
+				ReadLatency:            90 * time.Microsecond,
+				WriteLatency:           40 * time.Microsecond,
+			}},
+			false,
+		},
+		{
+			`[{
+			  "Name": "mirror",
+			  "Layout": "raid1",
+			  "Members": "ssd-sata,nvme",
+			  "RequestReorderMaxDelay": "0s",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fast",
+			  "MetadataOpTime": "100us"
+			}]`,
+			[]*DeviceConfig{{
+				Name:           "mirror",
+				FsyncStrategy:  WriteBackCachedFsync,
+				WriteStrategy:  FastWrite,
+				MetadataOpTime: 100 * time.Microsecond,
+				Layout:         RAID1Layout,
+				Members:        []string{"ssd-sata", "nvme"},
+			}},
+			false,
+		},
+		{
+			`[{
+			  "Name": "flash",
+			  "SeekWindow": "0B",
+			  "SeekTime": "0s",
+			  "ReadBytesPerSecond": "500MiB",
+			  "WriteBytesPerSecond": "400MiB",
+			  "AllocateBytesPerSecond": "1GiB",
+			  "RequestReorderMaxDelay": "0s",
+			  "FsyncStrategy": "wbc",
+			  "WriteStrategy": "fast",
+			  "MetadataOpTime": "100us",
+			  "Channels": "many"
+			}]`,
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		got, err := ParseDeviceConfigsFromJSON([]byte(c.jsonDeviceConfig))
+
+		if c.shouldErr && err == nil {
+			t.Errorf("ParseDeviceConfigsFromJSON(%s) = %s, should error", c.jsonDeviceConfig, got)
+		} else if !c.shouldErr {
+			if err != nil {
+				t.Errorf("ParseDeviceConfigsFromJSON(%s) error: %s, want %s", c.jsonDeviceConfig, err, c.want)
+			} else if want := c.want; !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseDeviceConfigsFromJSON(%s) = %s, want %s", c.jsonDeviceConfig, got, want)
+			}
+		}
+	}
+}
+
+func TestDeviceConfig_Validate(t *testing.T) {
+	cases := []struct {
+		deviceConfig *DeviceConfig
+		shouldErr    bool
+	}{
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     0 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    0 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 0 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				SeekWindow:             -1 * units.Byte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				SeekTime:               -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				RequestReorderMaxDelay: -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				MetadataOpTime:         -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
 		{
 			&DeviceConfig{
-				ReadBytesPerSecond:     1 * units.Byte,
-				WriteBytesPerSecond:    1 * units.Byte,
-				AllocateBytesPerSecond: 1 * units.Byte,
-			},
-			false,
-		},
-		{
-			&DeviceConfig{
-				ReadBytesPerSecond:     0 * units.Byte,
-				WriteBytesPerSecond:    1 * units.Byte,
-				AllocateBytesPerSecond: 1 * units.Byte,
-			},
-			true,
-		},
-		{
-			&DeviceConfig{
-				ReadBytesPerSecond:     1 * units.Byte,
-				WriteBytesPerSecond:    0 * units.Byte,
-				AllocateBytesPerSecond: 1 * units.Byte,
-			},
-			true,
-		},
-		{
-			&DeviceConfig{
-				ReadBytesPerSecond:     1 * units.Byte,
-				WriteBytesPerSecond:    1 * units.Byte,
-				AllocateBytesPerSecond: 0 * units.Byte,
-			},
-			true,
-		},
-		{
-			&DeviceConfig{
-				SeekWindow:             -1 * units.Byte,
-				ReadBytesPerSecond:     1 * units.Byte,
-				WriteBytesPerSecond:    1 * units.Byte,
-				AllocateBytesPerSecond: 1 * units.Byte,
-			},
-			true,
-		},
-		{
-			&DeviceConfig{
-				SeekTime:               -1,
+				Channels:               -1,
 				ReadBytesPerSecond:     1 * units.Byte,
 				WriteBytesPerSecond:    1 * units.Byte,
 				AllocateBytesPerSecond: 1 * units.Byte,
@@ -388,7 +1110,7 @@ func TestDeviceConfig_Validate(t *testing.T) {
 		},
 		{
 			&DeviceConfig{
-				RequestReorderMaxDelay: -1,
+				ReadLatency:            -1,
 				ReadBytesPerSecond:     1 * units.Byte,
 				WriteBytesPerSecond:    1 * units.Byte,
 				AllocateBytesPerSecond: 1 * units.Byte,
@@ -397,10 +1119,320 @@ func TestDeviceConfig_Validate(t *testing.T) {
 		},
 		{
 			&DeviceConfig{
-				MetadataOpTime:         -1,
+				WriteLatency:           -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				SeekModel:              DistanceSeek,
+				DiskCapacity:           1 * units.Terabyte,
+				TrackToTrackSeekTime:   1 * time.Millisecond,
+				FullStrokeSeekTime:     20 * time.Millisecond,
+				RPM:                    7200,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				SeekModel:              DistanceSeek,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				TrackToTrackSeekTime:   2 * time.Millisecond,
+				FullStrokeSeekTime:     1 * time.Millisecond,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				RPM:                    -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				PageCacheSize:          1 * units.Gibibyte,
+				PageCacheEviction:      TwoQueueEviction,
+				MemoryBytesPerSecond:   10 * units.Gibibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				PageCacheSize:          1 * units.Kibibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				PageCacheSize:          1 * units.Kibibyte,
+				PageSize:               512 * units.Byte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				MemoryBytesPerSecond:   -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadaheadInitialWindow: 16 * units.Kibibyte,
+				ReadaheadMaxWindow:     128 * units.Kibibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadaheadMaxWindow:     128 * units.Kibibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadaheadInitialWindow: 256 * units.Kibibyte,
+				ReadaheadMaxWindow:     128 * units.Kibibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadaheadInitialWindow: 16 * units.Kibibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadaheadInitialWindow: -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				StreamTableSize:        -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				FsyncStrategy:          WriteBackCachedFsync,
+				DirtyBackgroundBytes:   64 * units.Mebibyte,
+				DirtyLimitBytes:        256 * units.Mebibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				FsyncStrategy:          WriteBackCachedFsync,
+				DirtyBackgroundBytes:   256 * units.Mebibyte,
+				DirtyLimitBytes:        256 * units.Mebibyte,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				DirtyLimitBytes:        -1,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				FsyncStrategy:          WriteBackCachedFsync,
+				DirtyExpireInterval:    30 * time.Second,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				DirtyWritebackInterval: -time.Second,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				FsyncStrategy:          JournaledFsync,
+				JournalCommitTime:      -time.Millisecond,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				FsyncStrategy:          JournaledFsync,
+				MetadataFsyncTime:      -time.Millisecond,
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MediaType:              NetworkMedia,
+				RoundTripTime:          -time.Millisecond,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				MediaType:              NetworkMedia,
+				NetworkWindow:          -units.Kibibyte,
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				IOLimits:               IOLimits{{Match: "uid", Value: "0", ReadIOPS: -1}},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				IOLimits:               IOLimits{{Match: "uid", Value: "0", Weight: 10001}},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Layout:                 RAID0Layout,
+				Members:                []string{"ssd-sata", "nvme"},
+				MemberConfigs:          []*DeviceConfig{&SSDSataDeviceConfig, &NVMeDeviceConfig},
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Layout:                 RAID0Layout,
+				Members:                []string{"ssd-sata", "nvme"},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Layout:                 RAID5Layout,
+				Members:                []string{"ssd-sata", "nvme"},
+				MemberConfigs:          []*DeviceConfig{&SSDSataDeviceConfig, &NVMeDeviceConfig},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Layout:                 TieredLayout,
+				Members:                []string{"nvme", "hdd7200rpm"},
+				MemberConfigs:          []*DeviceConfig{&NVMeDeviceConfig, &HDD7200RpmDeviceConfig},
+			},
+			true,
+		},
+		{
+			&DeviceConfig{
+				ReadBytesPerSecond:     1 * units.Byte,
+				WriteBytesPerSecond:    1 * units.Byte,
+				AllocateBytesPerSecond: 1 * units.Byte,
+				Layout:                 TieredLayout,
+				Members:                []string{"nvme", "hdd7200rpm"},
+				MemberConfigs:          []*DeviceConfig{&NVMeDeviceConfig, &HDD7200RpmDeviceConfig},
+				TierCacheSize:          units.Gibibyte,
+			},
+			false,
+		},
+		{
+			&DeviceConfig{
 				ReadBytesPerSecond:     1 * units.Byte,
 				WriteBytesPerSecond:    1 * units.Byte,
 				AllocateBytesPerSecond: 1 * units.Byte,
+				Layout:                 RAID1Layout,
+				Members:                []string{"broken", "nvme"},
+				MemberConfigs:          []*DeviceConfig{{Name: "broken"}, &NVMeDeviceConfig},
 			},
 			true,
 		},
@@ -420,7 +1452,7 @@ func TestDeviceConfig_Validate(t *testing.T) {
 }
 
 func TestDeviceConfigLiteralsValid(t *testing.T) {
-	cases := []DeviceConfig{HDD7200RpmDeviceConfig}
+	cases := []DeviceConfig{HDD7200RpmDeviceConfig, SSDSataDeviceConfig, NVMeDeviceConfig}
 
 	for _, c := range cases {
 		if c.Validate() != nil {
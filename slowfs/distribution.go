@@ -0,0 +1,299 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DistributionType indicates the shape of a Distribution.
+type DistributionType int
+
+const (
+	// ConstantDistribution always takes Value.
+	ConstantDistribution DistributionType = iota
+	// UniformDistribution is equally likely to take anything between Min and Max.
+	UniformDistribution
+	// NormalDistribution is a bell curve around Mean with standard deviation StdDev. Values below
+	// zero are taken as zero.
+	NormalDistribution
+	// LogNormalDistribution is a distribution whose logarithm is normally distributed around the
+	// logarithm of Median with standard deviation Sigma. It has a long tail, like many real
+	// latencies.
+	LogNormalDistribution
+	// ExponentialDistribution is the time between events happening at random at a constant rate,
+	// with mean Mean.
+	ExponentialDistribution
+	// EmpiricalDistribution follows a table of measured Percentiles, interpolating linearly
+	// between them, and from zero below the first.
+	EmpiricalDistribution
+)
+
+func (t DistributionType) String() string {
+	switch t {
+	case ConstantDistribution:
+		return "constant"
+	case UniformDistribution:
+		return "uniform"
+	case NormalDistribution:
+		return "normal"
+	case LogNormalDistribution:
+		return "lognormal"
+	case ExponentialDistribution:
+		return "exponential"
+	case EmpiricalDistribution:
+		return "empirical"
+	default:
+		return "unknown distribution"
+	}
+}
+
+// Percentile is a point in an EmpiricalDistribution: Percent percent of values are at most Value.
+type Percentile struct {
+	Percent float64
+	Value   time.Duration
+}
+
+// Distribution describes how a duration varies each time it's used.
+type Distribution struct {
+	Type DistributionType
+
+	// Value is the value of a ConstantDistribution.
+	Value time.Duration
+
+	// Min and Max bound a UniformDistribution.
+	Min, Max time.Duration
+
+	// Mean is the mean of a NormalDistribution or ExponentialDistribution, and StdDev the standard
+	// deviation of a NormalDistribution.
+	Mean, StdDev time.Duration
+
+	// Median is the median of a LogNormalDistribution, and Sigma the standard deviation of its
+	// logarithm.
+	Median time.Duration
+	Sigma  float64
+
+	// Percentiles lists the points of an EmpiricalDistribution, in increasing order.
+	Percentiles []Percentile
+}
+
+// Quantile returns the value p of the way through the distribution, for p between 0 and 1. Picking
+// p uniformly at random picks a value from the distribution.
+func (d *Distribution) Quantile(p float64) time.Duration {
+	switch d.Type {
+	case UniformDistribution:
+		return d.Min + time.Duration(p*float64(d.Max-d.Min))
+	case NormalDistribution:
+		return durationFromFloat(float64(d.Mean) + float64(d.StdDev)*normalQuantile(p))
+	case LogNormalDistribution:
+		return durationFromFloat(float64(d.Median) * math.Exp(d.Sigma*normalQuantile(p)))
+	case ExponentialDistribution:
+		return durationFromFloat(-float64(d.Mean) * math.Log1p(-p))
+	case EmpiricalDistribution:
+		return d.empiricalQuantile(p * 100)
+	default:
+		return d.Value
+	}
+}
+
+func (d *Distribution) empiricalQuantile(percent float64) time.Duration {
+	var prev Percentile
+	for _, next := range d.Percentiles {
+		if percent <= next.Percent {
+			fraction := (percent - prev.Percent) / (next.Percent - prev.Percent)
+			return prev.Value + time.Duration(fraction*float64(next.Value-prev.Value))
+		}
+		prev = next
+	}
+	return prev.Value
+}
+
+// normalQuantile returns the value p of the way through the standard normal distribution.
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+// durationFromFloat converts a number of nanoseconds to a duration, taking negative numbers as zero.
+func durationFromFloat(ns float64) time.Duration {
+	if ns <= 0 || math.IsNaN(ns) {
+		return 0
+	}
+	if ns >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(ns)
+}
+
+func (d *Distribution) String() string {
+	switch d.Type {
+	case ConstantDistribution:
+		return d.Value.String()
+	case UniformDistribution:
+		return fmt.Sprintf("uniform(%s,%s)", d.Min, d.Max)
+	case NormalDistribution:
+		return fmt.Sprintf("normal(%s,%s)", d.Mean, d.StdDev)
+	case LogNormalDistribution:
+		return fmt.Sprintf("lognormal(%s,%s)", d.Median, strconv.FormatFloat(d.Sigma, 'g', -1, 64))
+	case ExponentialDistribution:
+		return fmt.Sprintf("exponential(%s)", d.Mean)
+	case EmpiricalDistribution:
+		parts := make([]string, len(d.Percentiles))
+		for i, p := range d.Percentiles {
+			parts[i] = fmt.Sprintf("p%s=%s", strconv.FormatFloat(p.Percent, 'g', -1, 64), p.Value)
+		}
+		return strings.Join(parts, ",")
+	default:
+		return d.Type.String()
+	}
+}
+
+// ParseDistributionFromString parses a Distribution from the given string, which is one of:
+//
+//	10ms                    a constant, in the format time.ParseDuration accepts
+//	uniform(5ms,15ms)       a uniform distribution between a minimum and maximum
+//	normal(10ms,2ms)        a normal distribution with a mean and standard deviation
+//	lognormal(10ms,0.5)     a log-normal distribution with a median, and the standard deviation
+//	                        of its logarithm
+//	exponential(10ms)       an exponential distribution with a mean
+//	p50=1ms,p99=40ms,p999=200ms
+//	                        an empirical distribution with the given percentiles, where p999 is
+//	                        the 99.9th percentile, and p99.99 can also be written in full
+func ParseDistributionFromString(s string) (Distribution, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), "p") {
+		return parseEmpiricalDistribution(s)
+	}
+
+	open := strings.Index(s, "(")
+	if open < 0 {
+		value, err := time.ParseDuration(s)
+		return Distribution{Type: ConstantDistribution, Value: value}, err
+	}
+	if !strings.HasSuffix(s, ")") {
+		return Distribution{}, fmt.Errorf("expected closing parenthesis in distribution %s", s)
+	}
+	name := strings.ToLower(strings.TrimSpace(s[:open]))
+	args := strings.Split(s[open+1:len(s)-1], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+
+	var d Distribution
+	var err error
+	switch name {
+	case "uniform":
+		d.Type = UniformDistribution
+		err = parseDurationArgs(s, args, &d.Min, &d.Max)
+		if err == nil && (d.Min < 0 || d.Max < d.Min) {
+			err = fmt.Errorf("uniform distribution must have 0 <= min <= max, got %s", s)
+		}
+	case "normal", "gaussian":
+		d.Type = NormalDistribution
+		err = parseDurationArgs(s, args, &d.Mean, &d.StdDev)
+		if err == nil && d.StdDev < 0 {
+			err = fmt.Errorf("normal distribution cannot have a negative standard deviation, got %s", s)
+		}
+	case "lognormal", "log-normal":
+		d.Type = LogNormalDistribution
+		if len(args) != 2 {
+			return Distribution{}, fmt.Errorf("expected 2 arguments in distribution %s", s)
+		}
+		if err = parseDurationArgs(s, args[:1], &d.Median); err != nil {
+			return Distribution{}, err
+		}
+		d.Sigma, err = strconv.ParseFloat(args[1], 64)
+		if err == nil && (d.Median <= 0 || d.Sigma < 0) {
+			err = fmt.Errorf("log-normal distribution must have a positive median and non-negative sigma, got %s", s)
+		}
+	case "exponential", "exp":
+		d.Type = ExponentialDistribution
+		err = parseDurationArgs(s, args, &d.Mean)
+		if err == nil && d.Mean < 0 {
+			err = fmt.Errorf("exponential distribution cannot have a negative mean, got %s", s)
+		}
+	case "constant":
+		d.Type = ConstantDistribution
+		err = parseDurationArgs(s, args, &d.Value)
+	default:
+		return Distribution{}, fmt.Errorf("unknown distribution %s", name)
+	}
+	if err != nil {
+		return Distribution{}, err
+	}
+	return d, nil
+}
+
+func parseDurationArgs(s string, args []string, durations ...*time.Duration) error {
+	if len(args) != len(durations) {
+		return fmt.Errorf("expected %d arguments in distribution %s", len(durations), s)
+	}
+	for i, arg := range args {
+		var err error
+		if *durations[i], err = time.ParseDuration(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseEmpiricalDistribution(s string) (Distribution, error) {
+	d := Distribution{Type: EmpiricalDistribution}
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 || len(kv[0]) < 2 {
+			return Distribution{}, fmt.Errorf("expected pN=duration in distribution, got %s", field)
+		}
+		percent, err := parsePercentile(kv[0][1:])
+		if err != nil {
+			return Distribution{}, err
+		}
+		value, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return Distribution{}, err
+		}
+		d.Percentiles = append(d.Percentiles, Percentile{percent, value})
+	}
+
+	sort.Slice(d.Percentiles, func(i, j int) bool { return d.Percentiles[i].Percent < d.Percentiles[j].Percent })
+	var prev Percentile
+	for _, p := range d.Percentiles {
+		if p.Percent == prev.Percent || p.Value < prev.Value {
+			return Distribution{}, fmt.Errorf("percentiles must be distinct and increase with the percentage, got %s", s)
+		}
+		prev = p
+	}
+	return d, nil
+}
+
+// parsePercentile parses the percentage after the p in a percentile like p50, p999 or p99.99.
+// Without a decimal point, digits after the first two are decimal places, so p999 is 99.9.
+func parsePercentile(s string) (float64, error) {
+	if !strings.Contains(s, ".") && len(s) > 2 && s != "100" {
+		s = s[:2] + "." + s[2:]
+	}
+	percent, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentile p%s", s)
+	}
+	if percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("percentile must be above 0 and at most 100, got p%s", s)
+	}
+	return percent, nil
+}
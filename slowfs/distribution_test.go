@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDistributionFromString(t *testing.T) {
+	cases := []struct {
+		str       string
+		want      Distribution
+		shouldErr bool
+	}{
+		{"10ms", Distribution{Type: ConstantDistribution, Value: 10 * time.Millisecond}, false},
+		{"constant(1s)", Distribution{Type: ConstantDistribution, Value: time.Second}, false},
+		{"uniform(5ms, 15ms)", Distribution{Type: UniformDistribution, Min: 5 * time.Millisecond,
+			Max: 15 * time.Millisecond}, false},
+		{"Normal(10ms,2ms)", Distribution{Type: NormalDistribution, Mean: 10 * time.Millisecond,
+			StdDev: 2 * time.Millisecond}, false},
+		{"lognormal(10ms,0.5)", Distribution{Type: LogNormalDistribution, Median: 10 * time.Millisecond,
+			Sigma: 0.5}, false},
+		{"exp(3ms)", Distribution{Type: ExponentialDistribution, Mean: 3 * time.Millisecond}, false},
+		{"p99=40ms, p50=1ms, p999=200ms", Distribution{Type: EmpiricalDistribution, Percentiles: []Percentile{
+			{50, time.Millisecond}, {99, 40 * time.Millisecond}, {99.9, 200 * time.Millisecond}}}, false},
+		{"p99.99=1s,p100=2s", Distribution{Type: EmpiricalDistribution, Percentiles: []Percentile{
+			{99.99, time.Second}, {100, 2 * time.Second}}}, false},
+		{"ten", Distribution{}, true},
+		{"uniform(15ms,5ms)", Distribution{}, true},
+		{"uniform(5ms)", Distribution{}, true},
+		{"normal(10ms,-2ms)", Distribution{}, true},
+		{"lognormal(0s,0.5)", Distribution{}, true},
+		{"lognormal(10ms,wide)", Distribution{}, true},
+		{"exponential(3ms", Distribution{}, true},
+		{"poisson(3ms)", Distribution{}, true},
+		{"p50=10ms,p99=1ms", Distribution{}, true},
+		{"p50=1ms,p50=2ms", Distribution{}, true},
+		{"p0=1ms", Distribution{}, true},
+		{"p100.5=1ms", Distribution{}, true},
+		{"pxx=1ms", Distribution{}, true},
+		{"p50", Distribution{}, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseDistributionFromString(c.str)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseDistributionFromString(%s) = _, %v, want error: %t", c.str, err, c.shouldErr)
+		}
+		if !c.shouldErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseDistributionFromString(%s) = %s, want %s", c.str, &got, &c.want)
+		}
+	}
+}
+
+func TestDistribution_String(t *testing.T) {
+	cases := []string{
+		"10ms",
+		"uniform(5ms,15ms)",
+		"normal(10ms,2ms)",
+		"lognormal(10ms,0.5)",
+		"exponential(3ms)",
+		"p50=1ms,p99=40ms,p99.9=200ms",
+	}
+
+	for _, c := range cases {
+		d, err := ParseDistributionFromString(c)
+		if err != nil {
+			t.Errorf("ParseDistributionFromString(%s) error: %s", c, err)
+			continue
+		}
+		if got := d.String(); got != c {
+			t.Errorf("ParseDistributionFromString(%s).String() = %s, want %s", c, got, c)
+		}
+	}
+}
+
+func TestDistribution_Quantile(t *testing.T) {
+	cases := []struct {
+		dist string
+		p    float64
+		want time.Duration
+	}{
+		{"10ms", 0.9, 10 * time.Millisecond},
+		{"uniform(5ms,15ms)", 0, 5 * time.Millisecond},
+		{"uniform(5ms,15ms)", 0.25, 7500 * time.Microsecond},
+		{"normal(10ms,2ms)", 0.5, 10 * time.Millisecond},
+		{"normal(10ms,2ms)", 0.8413447460685429, 12 * time.Millisecond},
+		{"normal(1ms,2ms)", 0.01, 0},
+		{"lognormal(10ms,0.5)", 0.5, 10 * time.Millisecond},
+		{"exponential(10ms)", 0, 0},
+		{"exponential(10ms)", 1 - 1/2.718281828459045, 10 * time.Millisecond},
+		{"p50=10ms,p90=50ms", 0.25, 5 * time.Millisecond},
+		{"p50=10ms,p90=50ms", 0.7, 30 * time.Millisecond},
+		{"p50=10ms,p90=50ms", 0.99, 50 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		d, err := ParseDistributionFromString(c.dist)
+		if err != nil {
+			t.Errorf("ParseDistributionFromString(%s) error: %s", c.dist, err)
+			continue
+		}
+		// Allow for rounding in the floating point maths.
+		if got := d.Quantile(c.p); got < c.want-time.Microsecond || got > c.want+time.Microsecond {
+			t.Errorf("%s.Quantile(%g) = %s, want %s", c.dist, c.p, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fault decides which filesystem operations should fail, so that programs using slowfs
+// can have their error handling tested.
+package fault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slowfs/slowfs/units"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Effect is what happens to an operation that a rule applies to.
+type Effect int
+
+// Effect options.
+const (
+	// IOError fails the operation with EIO.
+	IOError Effect = iota
+	// NoSpace fails the operation with ENOSPC.
+	NoSpace
+	// ReadOnly fails the operation with EROFS.
+	ReadOnly
+	// Interrupted fails the operation with EINTR.
+	Interrupted
+	// ShortTransfer makes a read or write transfer only half of the bytes asked for.
+	ShortTransfer
+)
+
+func (e Effect) String() string {
+	switch e {
+	case IOError:
+		return "EIO"
+	case NoSpace:
+		return "ENOSPC"
+	case ReadOnly:
+		return "EROFS"
+	case Interrupted:
+		return "EINTR"
+	case ShortTransfer:
+		return "ShortTransfer"
+	}
+	return "UnknownEffect"
+}
+
+// ParseEffectFromString parses a string into an Effect. Case insensitive.
+func ParseEffectFromString(s string) (Effect, error) {
+	switch strings.ToLower(s) {
+	case "eio":
+		return IOError, nil
+	case "enospc":
+		return NoSpace, nil
+	case "erofs":
+		return ReadOnly, nil
+	case "eintr":
+		return Interrupted, nil
+	case "shorttransfer", "short":
+		return ShortTransfer, nil
+	}
+	return IOError, fmt.Errorf("unknown effect %s", s)
+}
+
+// Errno returns the error an operation fails with, or 0 if the effect isn't an error.
+func (e Effect) Errno() syscall.Errno {
+	switch e {
+	case IOError:
+		return syscall.EIO
+	case NoSpace:
+		return syscall.ENOSPC
+	case ReadOnly:
+		return syscall.EROFS
+	case Interrupted:
+		return syscall.EINTR
+	}
+	return 0
+}
+
+// Ops lists the names of the operations that faults can be injected into. They are the lower case
+// names of the corresponding FUSE operations.
+var Ops = []string{
+	"read", "write", "fsync", "truncate", "getattr", "chown", "chmod", "utimens", "allocate",
+	"flush", "getlk", "setlk", "setlkw", "open", "create", "access", "link", "mkdir", "mknod", "rename", "rmdir", "unlink", "getxattr",
+	"listxattr", "removexattr", "setxattr", "opendir", "fsyncdir", "symlink", "readlink",
+}
+
+// transferOps are the operations that ShortTransfer can apply to.
+var transferOps = []string{"read", "write"}
+
+// Rule describes a set of operations, and how they should fail.
+type Rule struct {
+	// Path is a pattern, as accepted by filepath.Match, that the path of the file being operated
+	// on, relative to the mount directory, must match. Empty matches every path.
+	Path string
+	// Ops restricts the rule to operations with these names (see Ops). Empty matches every
+	// operation.
+	Ops []string
+	// Start and End restrict the rule to reads, writes and allocations that touch bytes in
+	// [Start, End). If End is zero, the range is unbounded. If both are zero, the rule also
+	// applies to operations that don't have a byte range.
+	Start units.NumBytes
+	End   units.NumBytes
+	// Probability is the chance that a matching operation fails.
+	Probability float64
+	// If Nth is non-zero, only the Nth matching operation fails.
+	Nth int
+	// Effect is how matching operations fail.
+	Effect Effect
+	// Delay is how long a failing operation takes. ShortTransfer operations instead take as long
+	// as the transfer that did happen.
+	Delay time.Duration
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("Rule{Path: %q, Ops: %s, Start: %s, End: %s, Probability: %g, Nth: %d, Effect: %s, Delay: %s}",
+		r.Path, strings.Join(r.Ops, ","), r.Start, r.End, r.Probability, r.Nth, r.Effect, r.Delay)
+}
+
+var ruleFields = []string{"Path", "Ops", "Start", "End", "Probability", "Nth", "Effect", "Delay"}
+
+// SetField sets the rule field with the given name by parsing value, in the same format as rule
+// files.
+func (r *Rule) SetField(name, value string) error {
+	var err error
+	switch name {
+	case "Path":
+		r.Path = value
+	case "Ops":
+		r.Ops = nil
+		for _, op := range strings.Split(value, ",") {
+			if op = strings.ToLower(strings.TrimSpace(op)); op != "" {
+				r.Ops = append(r.Ops, op)
+			}
+		}
+	case "Start":
+		r.Start, err = units.ParseNumBytesFromString(value)
+	case "End":
+		r.End, err = units.ParseNumBytesFromString(value)
+	case "Probability":
+		r.Probability, err = strconv.ParseFloat(value, 64)
+	case "Nth":
+		r.Nth, err = strconv.Atoi(value)
+	case "Effect":
+		r.Effect, err = ParseEffectFromString(value)
+	case "Delay":
+		r.Delay, err = time.ParseDuration(value)
+	default:
+		err = fmt.Errorf("unknown field %s", name)
+	}
+	return err
+}
+
+// Validate sanity checks the rule.
+func (r *Rule) Validate() error {
+	if _, err := filepath.Match(r.Path, ""); err != nil {
+		return fmt.Errorf("bad path pattern %q: %s", r.Path, err)
+	}
+	for _, op := range r.Ops {
+		if !contains(Ops, op) {
+			return fmt.Errorf("unknown op %s", op)
+		}
+	}
+	if r.Start < 0 || r.End < 0 {
+		return errors.New("byte range cannot be negative.")
+	}
+	if r.End != 0 && r.End <= r.Start {
+		return errors.New("End must be after Start.")
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return errors.New("Probability must be between 0 and 1.")
+	}
+	if r.Nth < 0 {
+		return errors.New("Nth cannot be negative.")
+	}
+	if r.Delay < 0 {
+		return errors.New("Delay cannot be negative.")
+	}
+	if r.Effect == ShortTransfer {
+		if len(r.Ops) == 0 {
+			return errors.New("ShortTransfer rules must list their Ops.")
+		}
+		for _, op := range r.Ops {
+			if !contains(transferOps, op) {
+				return fmt.Errorf("ShortTransfer cannot apply to op %s.", op)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the rule applies to an operation, ignoring Probability and Nth.
+func (r *Rule) matches(op, path string, off, size units.NumBytes) bool {
+	if len(r.Ops) != 0 && !contains(r.Ops, op) {
+		return false
+	}
+	if r.Path != "" {
+		if ok, _ := filepath.Match(r.Path, path); !ok {
+			return false
+		}
+	}
+	if r.Start == 0 && r.End == 0 {
+		return true
+	}
+	if size <= 0 || off+size <= r.Start {
+		return false
+	}
+	return r.End == 0 || off < r.End
+}
+
+// ParseRulesFromJSON parses json containing an array of rules. Like device configs, every value
+// is a string, and every field except Effect may be left out. Probability defaults to 1.
+func ParseRulesFromJSON(data []byte) ([]*Rule, error) {
+	var ruleObjs []map[string]interface{}
+	err := json.Unmarshal(data, &ruleObjs)
+	if _, ok := err.(*json.UnmarshalTypeError); ok {
+		return nil, fmt.Errorf("expected array containing fault rules")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]*Rule, 0, len(ruleObjs))
+	for _, ruleObj := range ruleObjs {
+		rule, err := parseRule(ruleObj)
+		if err != nil {
+			return nil, fmt.Errorf("error validating fault rule %v: %s", ruleObj, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseRule(obj map[string]interface{}) (*Rule, error) {
+	r := &Rule{Probability: 1}
+	if _, ok := obj["Effect"]; !ok {
+		return nil, fmt.Errorf("missing fields: Effect")
+	}
+
+	for k, v := range obj {
+		if !contains(ruleFields, k) {
+			return nil, fmt.Errorf("spurious field %s", k)
+		}
+
+		strVal, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: want string type, got %v", k, v)
+		}
+
+		if err := r.SetField(k, strVal); err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err)
+		}
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Injector decides which operations fail according to a list of rules. A nil *Injector never
+// injects any faults. It is safe for concurrent use.
+type Injector struct {
+	mu sync.Mutex
+
+	rules []*Rule
+	// Number of operations each rule has matched so far, for Nth.
+	matched []int
+	rand    *rand.Rand
+}
+
+// NewInjector creates an Injector using the given rules. Random failures are drawn from a source
+// seeded with seed, so that runs can be repeated.
+func NewInjector(rules []*Rule, seed int64) *Injector {
+	inj := &Injector{
+		rand: rand.New(rand.NewSource(seed)),
+	}
+	inj.SetRules(rules)
+	return inj
+}
+
+// SetRules replaces the rules in use, and resets the count of operations seen for Nth.
+func (inj *Injector) SetRules(rules []*Rule) {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	inj.rules = rules
+	inj.matched = make([]int, len(rules))
+}
+
+// Rules returns the rules in use.
+func (inj *Injector) Rules() []*Rule {
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	return inj.rules
+}
+
+// Check returns the first rule that makes the given operation fail, or nil if it should go ahead
+// as normal. off and size give the bytes the operation touches, and are zero if it doesn't have
+// a byte range. Rules after the one returned don't see the operation.
+func (inj *Injector) Check(op, path string, off, size units.NumBytes) *Rule {
+	if inj == nil {
+		return nil
+	}
+
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+
+	for i, r := range inj.rules {
+		if !r.matches(op, path, off, size) {
+			continue
+		}
+		inj.matched[i]++
+		if r.Nth != 0 && inj.matched[i] != r.Nth {
+			continue
+		}
+		if r.Probability < 1 && inj.rand.Float64() >= r.Probability {
+			continue
+		}
+		return r
+	}
+	return nil
+}
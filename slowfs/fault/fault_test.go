@@ -0,0 +1,219 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestEffect_String(t *testing.T) {
+	cases := []struct {
+		effect Effect
+		want   string
+	}{
+		{IOError, "EIO"},
+		{NoSpace, "ENOSPC"},
+		{ReadOnly, "EROFS"},
+		{Interrupted, "EINTR"},
+		{ShortTransfer, "ShortTransfer"},
+		{12345, "UnknownEffect"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.effect.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.effect, got, want)
+		}
+	}
+}
+
+func TestParseEffectFromString(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    Effect
+		wantErr bool
+	}{
+		{"EIO", IOError, false},
+		{"enospc", NoSpace, false},
+		{"EROFS", ReadOnly, false},
+		{"eintr", Interrupted, false},
+		{"short", ShortTransfer, false},
+		{"ShortTransfer", ShortTransfer, false},
+		{"chicken", IOError, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseEffectFromString(c.s)
+		if c.wantErr != (err != nil) {
+			t.Errorf("ParseEffectFromString(%s) error = %v, want error: %t", c.s, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("ParseEffectFromString(%s) = %s, want %s", c.s, got, c.want)
+		}
+	}
+}
+
+func TestParseRulesFromJSON(t *testing.T) {
+	cases := []struct {
+		desc    string
+		json    string
+		want    []*Rule
+		wantErr bool
+	}{
+		{
+			desc: "all fields",
+			json: `[{"Path": "data/*", "Ops": "read, Write", "Start": "4KiB", "End": "8KiB",
+				"Probability": "0.5", "Nth": "3", "Effect": "short", "Delay": "10ms"}]`,
+			want: []*Rule{{
+				Path:        "data/*",
+				Ops:         []string{"read", "write"},
+				Start:       4 * units.Kibibyte,
+				End:         8 * units.Kibibyte,
+				Probability: 0.5,
+				Nth:         3,
+				Effect:      ShortTransfer,
+				Delay:       10 * time.Millisecond,
+			}},
+		},
+		{
+			desc: "defaults",
+			json: `[{"Effect": "EIO"}]`,
+			want: []*Rule{{Probability: 1, Effect: IOError}},
+		},
+		{desc: "missing effect", json: `[{"Path": "a"}]`, wantErr: true},
+		{desc: "spurious field", json: `[{"Effect": "EIO", "Chicken": "yes"}]`, wantErr: true},
+		{desc: "non-string value", json: `[{"Effect": "EIO", "Nth": 3}]`, wantErr: true},
+		{desc: "not an array", json: `{"Effect": "EIO"}`, wantErr: true},
+		{desc: "unknown op", json: `[{"Effect": "EIO", "Ops": "chicken"}]`, wantErr: true},
+		{desc: "bad pattern", json: `[{"Effect": "EIO", "Path": "["}]`, wantErr: true},
+		{desc: "empty range", json: `[{"Effect": "EIO", "Start": "5B", "End": "5B"}]`, wantErr: true},
+		{desc: "probability too high", json: `[{"Effect": "EIO", "Probability": "1.5"}]`, wantErr: true},
+		{desc: "negative delay", json: `[{"Effect": "EIO", "Delay": "-1s"}]`, wantErr: true},
+		{desc: "short without ops", json: `[{"Effect": "short"}]`, wantErr: true},
+		{desc: "short fsync", json: `[{"Effect": "short", "Ops": "write,fsync"}]`, wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRulesFromJSON([]byte(c.json))
+		if c.wantErr != (err != nil) {
+			t.Errorf("fail (%s) ParseRulesFromJSON error = %v, want error: %t", c.desc, err, c.wantErr)
+			continue
+		}
+		if !c.wantErr && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("fail (%s) ParseRulesFromJSON = %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+type operation struct {
+	op, path  string
+	off, size units.NumBytes
+}
+
+func TestInjector_Check(t *testing.T) {
+	cases := []struct {
+		desc string
+		rule Rule
+		ops  []operation
+		// Whether each operation in ops should fail.
+		want []bool
+	}{
+		{
+			desc: "ops",
+			rule: Rule{Ops: []string{"write", "fsync"}, Probability: 1},
+			ops:  []operation{{"read", "a", 0, 1}, {"write", "a", 0, 1}, {"fsync", "a", 0, 0}},
+			want: []bool{false, true, true},
+		},
+		{
+			desc: "path",
+			rule: Rule{Path: "logs/*.log", Probability: 1},
+			ops:  []operation{{"open", "logs/a.log", 0, 0}, {"open", "logs/a.txt", 0, 0}, {"open", "a.log", 0, 0}},
+			want: []bool{true, false, false},
+		},
+		{
+			desc: "byte range",
+			rule: Rule{Start: 10, End: 20, Probability: 1},
+			ops: []operation{
+				{"read", "a", 0, 10}, {"read", "a", 5, 6}, {"read", "a", 19, 5}, {"read", "a", 20, 5},
+				{"fsync", "a", 0, 0},
+			},
+			want: []bool{false, true, true, false, false},
+		},
+		{
+			desc: "unbounded byte range",
+			rule: Rule{Start: 10, Probability: 1},
+			ops:  []operation{{"write", "a", 0, 10}, {"write", "a", 1000, 1}},
+			want: []bool{false, true},
+		},
+		{
+			desc: "nth",
+			rule: Rule{Ops: []string{"write"}, Nth: 2, Probability: 1},
+			ops:  []operation{{"write", "a", 0, 1}, {"read", "a", 0, 1}, {"write", "a", 0, 1}, {"write", "a", 0, 1}},
+			want: []bool{false, false, true, false},
+		},
+		{
+			desc: "never",
+			rule: Rule{Probability: 0},
+			ops:  []operation{{"write", "a", 0, 1}, {"read", "a", 0, 1}},
+			want: []bool{false, false},
+		},
+	}
+
+	for _, c := range cases {
+		rule := c.rule
+		inj := NewInjector([]*Rule{&rule}, 1)
+		for i, o := range c.ops {
+			got := inj.Check(o.op, o.path, o.off, o.size) != nil
+			if got != c.want[i] {
+				t.Errorf("fail (%s) Check(%+v) fails = %t, want %t", c.desc, o, got, c.want[i])
+			}
+		}
+	}
+}
+
+func TestInjector_CheckProbability(t *testing.T) {
+	const numOps = 10000
+	inj := NewInjector([]*Rule{{Probability: 0.25}}, 1)
+
+	failed := 0
+	for i := 0; i < numOps; i++ {
+		if inj.Check("read", "a", 0, 1) != nil {
+			failed++
+		}
+	}
+	if failed < numOps/5 || failed > numOps*3/10 {
+		t.Errorf("%d of %d operations failed with probability 0.25", failed, numOps)
+	}
+}
+
+func TestInjector_CheckFirstRuleWins(t *testing.T) {
+	first := &Rule{Ops: []string{"read"}, Probability: 1, Effect: NoSpace}
+	second := &Rule{Probability: 1, Effect: IOError}
+	inj := NewInjector([]*Rule{first, second}, 1)
+
+	if got, want := inj.Check("read", "a", 0, 1), first; got != want {
+		t.Errorf("Check(read) = %v, want %v", got, want)
+	}
+	if got, want := inj.Check("write", "a", 0, 1), second; got != want {
+		t.Errorf("Check(write) = %v, want %v", got, want)
+	}
+
+	var nilInjector *Injector
+	if got := nilInjector.Check("read", "a", 0, 1); got != nil {
+		t.Errorf("nil Injector Check(read) = %v, want nil", got)
+	}
+}
@@ -16,8 +16,15 @@
 package fuselayer
 
 import (
+	"os"
+	"path/filepath"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/crash"
+	"slowfs/slowfs/fault"
 	"slowfs/slowfs/scheduler"
 	"slowfs/slowfs/units"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -30,11 +37,58 @@ type slowFile struct {
 
 	path string
 	sfs  *SlowFs
+
+	// Set on reads and writes, according to the flags the file was opened with.
+	flags scheduler.RequestFlags
+	// The process that opened the file, which operations on it are attributed to, since FUSE
+	// doesn't say which process makes them.
+	caller scheduler.Caller
+}
+
+// requestFlags returns the flags for reads and writes to a file opened with the given flags.
+func requestFlags(openFlags uint32) scheduler.RequestFlags {
+	var flags scheduler.RequestFlags
+	// O_SYNC includes O_DSYNC on Linux, so check for it first.
+	if openFlags&syscall.O_SYNC == syscall.O_SYNC {
+		flags |= scheduler.SyncFlag
+	} else if openFlags&dsyncFlag != 0 {
+		flags |= scheduler.DataSyncFlag
+	}
+	if openFlags&directFlag != 0 {
+		flags |= scheduler.DirectFlag
+	}
+	return flags
+}
+
+// checkAlignment fails reads and writes to files opened with O_DIRECT that aren't aligned the way
+// the device requires, like a real block device would.
+func (sf *slowFile) checkAlignment(off int64, size int) fuse.Status {
+	if sf.flags&scheduler.DirectFlag == 0 {
+		return fuse.OK
+	}
+	s := sf.sfs.router.Scheduler(sf.path)
+	if s == nil {
+		return fuse.OK
+	}
+	alignment := int64(s.Config().DirectIOAlignment)
+	if alignment != 0 && (off%alignment != 0 || int64(size)%alignment != 0) {
+		return fuse.EINVAL
+	}
+	return fuse.OK
 }
 
 // Read performs a read, and then waits until the scheduled time.
 func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if status := sf.checkAlignment(off, len(dest)); status != fuse.OK {
+		return nil, status
+	}
+	if rule := sf.sfs.faults.Check("read", sf.path, units.NumBytes(off), units.NumBytes(len(dest))); rule != nil {
+		if rule.Effect != fault.ShortTransfer {
+			return nil, sf.sfs.fail(start, rule)
+		}
+		dest = dest[:len(dest)/2]
+	}
 	r, status := sf.File.Read(dest, off)
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
@@ -51,232 +105,500 @@ func (sf *slowFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status)
 	}
 	r = fuse.ReadResultData(buf)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.ReadRequest,
 		Timestamp: start,
 		Path:      sf.path,
 		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(r.Size()),
+		Flags:     sf.flags,
+		Caller:    sf.caller,
 	})
 
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r, status
 }
 
 // Write performs a write, and then waits until the scheduled time.
 func (sf *slowFile) Write(data []byte, off int64) (uint32, fuse.Status) {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if status := sf.checkAlignment(off, len(data)); status != fuse.OK {
+		return 0, status
+	}
+	if rule := sf.sfs.faults.Check("write", sf.path, units.NumBytes(off), units.NumBytes(len(data))); rule != nil {
+		if rule.Effect != fault.ShortTransfer {
+			return 0, sf.sfs.fail(start, rule)
+		}
+		data = data[:len(data)/2]
+	}
 	// Unlike Read, Write will immediately execute the syscall.
-	r, status := sf.File.Write(data, off)
+	var r uint32
+	var status fuse.Status
+	err := sf.sfs.journal.Write(sf.path, off, data, sf.flags.WritesThrough(), func() int {
+		r, status = sf.File.Write(data, off)
+		if status != fuse.OK {
+			return 0
+		}
+		return int(r)
+	})
+	if err != nil {
+		return 0, fuse.ToStatus(err)
+	}
 
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
 		return r, status
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.WriteRequest,
 		Timestamp: start,
 		Path:      sf.path,
 		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(r),
+		Flags:     sf.flags,
+		Caller:    sf.caller,
 	})
 
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r, status
 }
 
 // Release calls Release on the underlying file, and then waits until the scheduled time.
 func (sf *slowFile) Release() {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
 	sf.File.Release()
+	sf.sfs.journal.Close(sf.path)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.CloseRequest,
 		Timestamp: start,
 		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 }
 
+// fdatasyncFlag is set in Fsync's flags for fdatasync, as FUSE_FSYNC_FDATASYNC.
+const fdatasyncFlag = 1
+
+// Fsync performs an fsync or fdatasync, and then waits until the scheduled time.
 func (sf *slowFile) Fsync(flags int) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("fsync", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.Fsync(flags)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
+	sf.sfs.journal.Sync(sf.path)
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
-		Type:      scheduler.FsyncRequest,
+	reqType := scheduler.FsyncRequest
+	if flags&fdatasyncFlag != 0 {
+		reqType = scheduler.FdatasyncRequest
+	}
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
+		Type:      reqType,
 		Timestamp: start,
 		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Truncate(size uint64) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("truncate", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.Truncate(size)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) GetAttr(out *fuse.Attr) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("getattr", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.GetAttr(out)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Chown(uid uint32, gid uint32) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("chown", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.Chown(uid, gid)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Chmod(perms uint32) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("chmod", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.Chmod(perms)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("utimens", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.Utimens(atime, mtime)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
 func (sf *slowFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
-	start := time.Now()
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("allocate", sf.path, units.NumBytes(off), units.NumBytes(size)); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
 	r := sf.File.Allocate(off, size, mode)
 	// TODO(edcourtney): How long should this take?
 	if r != fuse.OK {
 		return r
 	}
 
-	opTime := sf.sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.AllocateRequest,
 		Timestamp: start,
+		Path:      sf.path,
+		Start:     units.NumBytes(off),
 		Size:      units.NumBytes(size),
+		Caller:    sf.caller,
+	})
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
+
+	return r
+}
+
+// Flush calls Flush on the underlying file, which happens every time a file descriptor for it is
+// closed, and then waits until the scheduled time.
+func (sf *slowFile) Flush() fuse.Status {
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("flush", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
+	r := sf.File.Flush()
+	if r != fuse.OK {
+		return r
+	}
+
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
+		Type:      scheduler.MetadataRequest,
+		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
+	})
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
+
+	return r
+}
+
+func (sf *slowFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) fuse.Status {
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("getlk", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
+	r := sf.File.GetLk(owner, lk, flags, out)
+	if r != fuse.OK {
+		return r
+	}
+
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
+		Type:      scheduler.MetadataRequest,
+		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
+	})
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
+
+	return r
+}
+
+func (sf *slowFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Status {
+	start := sf.sfs.clock.Now()
+	if rule := sf.sfs.faults.Check("setlk", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(start, rule)
+	}
+	r := sf.File.SetLk(owner, lk, flags)
+	if r != fuse.OK {
+		return r
+	}
+
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
+		Type:      scheduler.MetadataRequest,
+		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
+	})
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
+
+	return r
+}
+
+// SetLkw waits for the lock like SetLk, and is only scheduled once it has been taken.
+func (sf *slowFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Status {
+	if rule := sf.sfs.faults.Check("setlkw", sf.path, 0, 0); rule != nil {
+		return sf.sfs.fail(sf.sfs.clock.Now(), rule)
+	}
+	r := sf.File.SetLkw(owner, lk, flags)
+	if r != fuse.OK {
+		return r
+	}
+
+	start := sf.sfs.clock.Now()
+	opTime := sf.sfs.router.Schedule(&scheduler.Request{
+		Type:      scheduler.MetadataRequest,
+		Timestamp: start,
+		Path:      sf.path,
+		Caller:    sf.caller,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sf.sfs.clock.Sleep(opTime - sf.sfs.clock.Since(start))
 
 	return r
 }
 
-// SlowFs is a FileSystem whose operations take amounts of time determined by an associated
-// Scheduler.
+// SlowFs is a FileSystem whose operations take amounts of time determined by the Scheduler for
+// the device each file is on.
 type SlowFs struct {
 	pathfs.FileSystem
 
-	scheduler *scheduler.Scheduler
+	dir       string
+	router    *scheduler.Router
+	clock     clock.Clock
+	faults    *fault.Injector
+	journal   *crash.Journal
+	processes *processCache
 }
 
 // NewSlowFs creates a new SlowFs using the specified scheduler at the given directory. The
-// directory must be empty.
-func NewSlowFs(directory string, scheduler *scheduler.Scheduler) *SlowFs {
+// directory must be empty. Operations wait using the scheduler's clock, and fail when faults
+// says so. If journal is given, writes are recorded in it so that power cuts can be simulated.
+// faults and journal may be nil.
+func NewSlowFs(directory string, s *scheduler.Scheduler, faults *fault.Injector, journal *crash.Journal) *SlowFs {
+	// A router without routes can't fail to be created.
+	router, _ := scheduler.NewRouter(s.Clock(), nil, s)
+	return NewRoutedSlowFs(directory, router, faults, journal)
+}
+
+// NewRoutedSlowFs creates a new SlowFs like NewSlowFs, but where operations on each file take as
+// long as the scheduler the router picks for it says, and operations on files it doesn't pick a
+// scheduler for aren't slowed down.
+func NewRoutedSlowFs(directory string, router *scheduler.Router, faults *fault.Injector, journal *crash.Journal) *SlowFs {
 	return &SlowFs{
 		FileSystem: pathfs.NewLoopbackFileSystem(directory),
-		scheduler:  scheduler,
+		dir:        directory,
+		router:     router,
+		clock:      router.Clock(),
+		faults:     faults,
+		journal:    journal,
+		processes:  newProcessCache(clock.RealClock{}, processName),
 	}
 }
 
+// fail waits until rule's delay has passed since start, and returns the error it fails operations
+// with.
+func (sfs *SlowFs) fail(start time.Time, rule *fault.Rule) fuse.Status {
+	sfs.clock.Sleep(rule.Delay - sfs.clock.Since(start))
+	return fuse.Status(rule.Effect.Errno())
+}
+
 // Open opens a file, and then waits until the scheduled time.
 func (sfs *SlowFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("open", name, 0, 0); rule != nil {
+		return nil, sfs.fail(start, rule)
+	}
 	file, status := sfs.FileSystem.Open(name, flags, context)
 	// TODO(edcourtney): How long should it take in the case of an error?
 	if status != fuse.OK {
 		return file, status
 	}
 
-	slowFile := &slowFile{
-		File: file,
-		sfs:  sfs,
-		path: name,
-	}
-
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
+
+	return sfs.newSlowFile(name, file, flags, context), status
+}
+
+// newSlowFile wraps a file opened or created with the given flags, so that operations on it are
+// slowed down too.
+func (sfs *SlowFs) newSlowFile(name string, file nodefs.File, flags uint32, context *fuse.Context) *slowFile {
+	return &slowFile{
+		File:   file,
+		sfs:    sfs,
+		path:   name,
+		flags:  requestFlags(flags),
+		caller: sfs.callerOf(context),
+	}
+}
+
+// callerOf returns who made a request, from the context FUSE gave it.
+func (sfs *SlowFs) callerOf(context *fuse.Context) scheduler.Caller {
+	if context == nil {
+		return scheduler.Caller{}
+	}
+	return scheduler.Caller{
+		Pid:     context.Pid,
+		Uid:     context.Uid,
+		Gid:     context.Gid,
+		Process: sfs.processes.name(context.Pid),
+	}
+}
+
+// processCacheTTL is how long the name of a process is remembered, so that it isn't read from /proc
+// on every operation. PIDs are rarely reused that quickly.
+const processCacheTTL = time.Second
+
+// maxCachedProcesses is how many process names are remembered before expired ones are forgotten.
+const maxCachedProcesses = 1024
+
+// processCache remembers the names of the processes making requests. It is safe for concurrent
+// use.
+type processCache struct {
+	mu sync.Mutex
+	// Processes live in real time, even when operations take simulated time.
+	clock  clock.Clock
+	lookup func(pid uint32) string
+	names  map[uint32]cachedProcess
+}
 
-	return slowFile, status
+type cachedProcess struct {
+	name    string
+	expires time.Time
+}
+
+func newProcessCache(clk clock.Clock, lookup func(pid uint32) string) *processCache {
+	return &processCache{
+		clock:  clk,
+		lookup: lookup,
+		names:  make(map[uint32]cachedProcess),
+	}
+}
+
+// name returns the name of the process with the given PID, looking it up if it isn't remembered or
+// was looked up too long ago.
+func (pc *processCache) name(pid uint32) string {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	now := pc.clock.Now()
+	if p, ok := pc.names[pid]; ok && now.Before(p.expires) {
+		return p.name
+	}
+	if len(pc.names) >= maxCachedProcesses {
+		for pid, p := range pc.names {
+			if !now.Before(p.expires) {
+				delete(pc.names, pid)
+			}
+		}
+	}
+	name := pc.lookup(pid)
+	if len(pc.names) < maxCachedProcesses {
+		pc.names[pid] = cachedProcess{name: name, expires: now.Add(processCacheTTL)}
+	}
+	return name
 }
 
 // GetAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("getattr", name, 0, 0); rule != nil {
+		return nil, sfs.fail(start, rule)
+	}
 	attr, status := sfs.FileSystem.GetAttr(name, context)
 	if status != fuse.OK {
 		return attr, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return attr, status
 }
@@ -284,17 +606,22 @@ func (sfs *SlowFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 // Chmod calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("chmod", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Chmod(name, mode, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -302,17 +629,22 @@ func (sfs *SlowFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.S
 // Chown calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("chown", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Chown(name, uid, gid, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -320,17 +652,22 @@ func (sfs *SlowFs) Chown(name string, uid uint32, gid uint32, context *fuse.Cont
 // Utimens calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("utimens", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Utimens(name, Atime, Mtime, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -338,17 +675,22 @@ func (sfs *SlowFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, cont
 // Truncate calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("truncate", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Truncate(name, size, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -356,17 +698,22 @@ func (sfs *SlowFs) Truncate(name string, size uint64, context *fuse.Context) fus
 // Access calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("access", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Access(name, mode, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -374,17 +721,22 @@ func (sfs *SlowFs) Access(name string, mode uint32, context *fuse.Context) fuse.
 // Link calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("link", newName, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Link(oldName, newName, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      newName,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -392,17 +744,22 @@ func (sfs *SlowFs) Link(oldName string, newName string, context *fuse.Context) f
 // Mkdir calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("mkdir", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Mkdir(name, mode, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -410,17 +767,22 @@ func (sfs *SlowFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 // Mknod calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("mknod", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Mknod(name, mode, dev, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -428,17 +790,22 @@ func (sfs *SlowFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Con
 // Rename calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("rename", oldName, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Rename(oldName, newName, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      oldName,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -446,17 +813,22 @@ func (sfs *SlowFs) Rename(oldName string, newName string, context *fuse.Context)
 // Rmdir calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Rmdir(name string, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("rmdir", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Rmdir(name, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -464,17 +836,22 @@ func (sfs *SlowFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 // Unlink calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Unlink(name string, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("unlink", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Unlink(name, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -482,17 +859,22 @@ func (sfs *SlowFs) Unlink(name string, context *fuse.Context) fuse.Status {
 // GetXAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("getxattr", name, 0, 0); rule != nil {
+		return nil, sfs.fail(start, rule)
+	}
 	data, status := sfs.FileSystem.GetXAttr(name, attribute, context)
 	if status != fuse.OK {
 		return data, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return data, status
 }
@@ -500,17 +882,22 @@ func (sfs *SlowFs) GetXAttr(name string, attribute string, context *fuse.Context
 // ListXAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("listxattr", name, 0, 0); rule != nil {
+		return nil, sfs.fail(start, rule)
+	}
 	attributes, status := sfs.FileSystem.ListXAttr(name, context)
 	if status != fuse.OK {
 		return attributes, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return attributes, status
 }
@@ -518,17 +905,22 @@ func (sfs *SlowFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse
 // RemoveXAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("removexattr", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.RemoveXAttr(name, attr, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -536,53 +928,97 @@ func (sfs *SlowFs) RemoveXAttr(name string, attr string, context *fuse.Context)
 // SetXAttr calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("setxattr", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.SetXAttr(name, attr, data, flags, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
 
 // Create calls the underlying filesystem then sends a MetadataRequest and
-// waits how long it is told to.
+// waits how long it is told to. The created file is slowed down like those returned by Open.
 func (sfs *SlowFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("create", name, 0, 0); rule != nil {
+		return nil, sfs.fail(start, rule)
+	}
 	file, status := sfs.FileSystem.Create(name, flags, mode, context)
 	if status != fuse.OK {
 		return file, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
-	return file, status
+	return sfs.newSlowFile(name, file, flags, context), status
+}
+
+// FsyncDir fsyncs the directory at name, which persists its entries, and then waits until the
+// scheduled time. pathfs doesn't pass fsyncs of directories on, so they reach it through the raw
+// filesystem NewRawFileSystem returns.
+func (sfs *SlowFs) FsyncDir(name string, context *fuse.Context) fuse.Status {
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("fsyncdir", name, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
+	dir, err := os.Open(filepath.Join(sfs.dir, name))
+	if err != nil {
+		return fuse.ToStatus(err)
+	}
+	err = dir.Sync()
+	dir.Close()
+	if err != nil {
+		return fuse.ToStatus(err)
+	}
+
+	opTime := sfs.router.Schedule(&scheduler.Request{
+		Type:      scheduler.DirFsyncRequest,
+		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
+	})
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
+
+	return fuse.OK
 }
 
 // OpenDir calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("opendir", name, 0, 0); rule != nil {
+		return nil, sfs.fail(start, rule)
+	}
 	stream, status := sfs.FileSystem.OpenDir(name, context)
 	if status != fuse.OK {
 		return stream, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return stream, status
 }
@@ -590,17 +1026,22 @@ func (sfs *SlowFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 // Symlink calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("symlink", linkName, 0, 0); rule != nil {
+		return sfs.fail(start, rule)
+	}
 	status := sfs.FileSystem.Symlink(value, linkName, context)
 	if status != fuse.OK {
 		return status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      linkName,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return status
 }
@@ -608,17 +1049,22 @@ func (sfs *SlowFs) Symlink(value string, linkName string, context *fuse.Context)
 // Readlink calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
-	start := time.Now()
+	start := sfs.clock.Now()
+	if rule := sfs.faults.Check("readlink", name, 0, 0); rule != nil {
+		return "", sfs.fail(start, rule)
+	}
 	f, status := sfs.FileSystem.Readlink(name, context)
 	if status != fuse.OK {
 		return f, status
 	}
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
+		Caller:    sfs.callerOf(context),
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return f, status
 }
@@ -626,14 +1072,15 @@ func (sfs *SlowFs) Readlink(name string, context *fuse.Context) (string, fuse.St
 // StatFs calls the underlying filesystem then sends a MetadataRequest and
 // waits how long it is told to.
 func (sfs *SlowFs) StatFs(name string) *fuse.StatfsOut {
-	start := time.Now()
+	start := sfs.clock.Now()
 	out := sfs.FileSystem.StatFs(name)
 
-	opTime := sfs.scheduler.Schedule(&scheduler.Request{
+	opTime := sfs.router.Schedule(&scheduler.Request{
 		Type:      scheduler.MetadataRequest,
 		Timestamp: start,
+		Path:      name,
 	})
-	time.Sleep(opTime - time.Since(start))
+	sfs.clock.Sleep(opTime - sfs.clock.Since(start))
 
 	return out
 }
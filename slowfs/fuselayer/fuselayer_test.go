@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+var basicDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+}
+
+func TestSlowFs_CreatedFilesAreThrottled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fuselayer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clk := clock.NewSimulatedClock(time.Time{})
+	sfs := NewSlowFs(dir, scheduler.NewWithClock(basicDeviceConfig, clk), nil, nil)
+
+	var file nodefs.File
+	cases := []struct {
+		desc string
+		op   func() fuse.Status
+		want time.Duration
+	}{
+		{
+			desc: "create",
+			op: func() fuse.Status {
+				var status fuse.Status
+				file, status = sfs.Create("a", uint32(os.O_RDWR), 0644, &fuse.Context{})
+				return status
+			},
+			want: 80 * time.Millisecond,
+		},
+		{
+			desc: "first write seeks",
+			op: func() fuse.Status {
+				_, status := file.Write(make([]byte, 10), 0)
+				return status
+			},
+			want: 110 * time.Millisecond,
+		},
+		{
+			desc: "sequential write",
+			op: func() fuse.Status {
+				_, status := file.Write(make([]byte, 10), 10)
+				return status
+			},
+			want: 100 * time.Millisecond,
+		},
+		{
+			desc: "fsync",
+			op: func() fuse.Status {
+				return file.Fsync(0)
+			},
+			want: 100 * time.Millisecond,
+		},
+		{
+			desc: "read seeks back",
+			op: func() fuse.Status {
+				_, status := file.Read(make([]byte, 20), 0)
+				return status
+			},
+			want: 210 * time.Millisecond,
+		},
+		{
+			desc: "allocate",
+			op: func() fuse.Status {
+				return file.Allocate(20, 100, 0)
+			},
+			want: 100 * time.Millisecond,
+		},
+		{
+			desc: "flush",
+			op: func() fuse.Status {
+				return file.Flush()
+			},
+			want: 80 * time.Millisecond,
+		},
+	}
+
+	for _, c := range cases {
+		start := clk.Now()
+		if status := c.op(); status != fuse.OK {
+			t.Fatalf("fail (%s) status = %s, want OK", c.desc, status)
+		}
+		if got, want := clk.Since(start), c.want; got != want {
+			t.Errorf("fail (%s) took %s, want %s", c.desc, got, want)
+		}
+	}
+}
+
+func TestRoutedSlowFs_FileMetadataOps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fuselayer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clk := clock.NewSimulatedClock(time.Time{})
+	router, err := scheduler.NewRouter(clk, []scheduler.Route{
+		{Pattern: "slow", Scheduler: scheduler.NewWithClock(basicDeviceConfig, clk)},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewRouter() error: %s", err)
+	}
+	sfs := NewRoutedSlowFs(dir, router, nil, nil)
+	if status := sfs.Mkdir("slow", 0755, &fuse.Context{}); status != fuse.OK {
+		t.Fatalf("Mkdir(slow) status = %s, want OK", status)
+	}
+	file, status := sfs.Create("slow/a", uint32(os.O_RDWR), 0644, &fuse.Context{})
+	if status != fuse.OK {
+		t.Fatalf("Create(slow/a) status = %s, want OK", status)
+	}
+
+	now := time.Now()
+	cases := []struct {
+		desc string
+		op   func() fuse.Status
+	}{
+		{"ftruncate", func() fuse.Status { return file.Truncate(0) }},
+		{"fstat", func() fuse.Status { return file.GetAttr(&fuse.Attr{}) }},
+		{"fchown", func() fuse.Status { return file.Chown(uint32(os.Getuid()), uint32(os.Getgid())) }},
+		{"fchmod", func() fuse.Status { return file.Chmod(0600) }},
+		{"futimens", func() fuse.Status { return file.Utimens(&now, &now) }},
+	}
+
+	for _, c := range cases {
+		start := clk.Now()
+		if status := c.op(); status != fuse.OK {
+			t.Fatalf("fail (%s) status = %s, want OK", c.desc, status)
+		}
+		if got, want := clk.Since(start), 80*time.Millisecond; got != want {
+			t.Errorf("fail (%s) took %s, want %s", c.desc, got, want)
+		}
+	}
+}
+
+func TestProcessCache(t *testing.T) {
+	clk := clock.NewSimulatedClock(time.Time{})
+	lookups := 0
+	pc := newProcessCache(clk, func(pid uint32) string {
+		lookups++
+		return fmt.Sprintf("process%d", pid)
+	})
+
+	cases := []struct {
+		desc        string
+		advance     time.Duration
+		pid         uint32
+		wantLookups int
+	}{
+		{"first lookup", 0, 1, 1},
+		{"remembered", processCacheTTL / 2, 1, 1},
+		{"another process", 0, 2, 2},
+		{"expired", processCacheTTL, 1, 3},
+	}
+
+	for _, c := range cases {
+		clk.Advance(c.advance)
+		if got, want := pc.name(c.pid), fmt.Sprintf("process%d", c.pid); got != want {
+			t.Errorf("fail (%s) name(%d) = %s, want %s", c.desc, c.pid, got, want)
+		}
+		if lookups != c.wantLookups {
+			t.Errorf("fail (%s) looked up %d times, want %d", c.desc, lookups, c.wantLookups)
+		}
+	}
+}
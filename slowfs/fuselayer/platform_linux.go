@@ -0,0 +1,39 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"syscall"
+)
+
+// Open flags for bypassing the page cache, and for persisting data but not necessarily metadata
+// on every write.
+const (
+	directFlag = syscall.O_DIRECT
+	dsyncFlag  = syscall.O_DSYNC
+)
+
+// processName returns the name of the executable of the process with the given PID, or an empty
+// string if it can't be found, e.g. because the process has exited.
+func processName(pid uint32) string {
+	comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
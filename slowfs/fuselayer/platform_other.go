@@ -0,0 +1,30 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package fuselayer
+
+// O_DIRECT and O_DSYNC aren't portable, so files opened with them are treated like any other.
+const (
+	directFlag = 0
+	dsyncFlag  = 0
+)
+
+// processName would return the name of the executable of the process with the given PID, but
+// without /proc, this always returns an empty string.
+func processName(pid uint32) string {
+	return ""
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// dirSyncFileSystem passes fsyncs of directories on to a SlowFs. go-fuse's nodefs answers them
+// with ENOSYS without asking the filesystem, and only tells the raw filesystem the directory's
+// node ID, so dirSyncFileSystem learns the path of each directory from the lookups that give the
+// kernel its node IDs.
+type dirSyncFileSystem struct {
+	fuse.RawFileSystem
+	sfs *SlowFs
+
+	mu   sync.Mutex
+	dirs map[uint64]*dirNode
+}
+
+// dirNode is where a directory the kernel knows about is, and how many lookups of it the kernel
+// hasn't forgotten.
+type dirNode struct {
+	parent  uint64
+	name    string
+	lookups uint64
+}
+
+// NewRawFileSystem wraps the raw filesystem serving sfs, e.g. from a
+// nodefs.FileSystemConnector's RawFS, so that fsyncs of directories are slowed down too.
+func NewRawFileSystem(raw fuse.RawFileSystem, sfs *SlowFs) fuse.RawFileSystem {
+	return &dirSyncFileSystem{
+		RawFileSystem: raw,
+		sfs:           sfs,
+		dirs:          make(map[uint64]*dirNode),
+	}
+}
+
+func (fs *dirSyncFileSystem) Lookup(header *fuse.InHeader, name string, out *fuse.EntryOut) fuse.Status {
+	status := fs.RawFileSystem.Lookup(header, name, out)
+	if status == fuse.OK && out.IsDir() {
+		fs.addLookup(header.NodeId, name, out.NodeId)
+	}
+	return status
+}
+
+func (fs *dirSyncFileSystem) Mkdir(input *fuse.MkdirIn, name string, out *fuse.EntryOut) fuse.Status {
+	status := fs.RawFileSystem.Mkdir(input, name, out)
+	if status == fuse.OK {
+		fs.addLookup(input.NodeId, name, out.NodeId)
+	}
+	return status
+}
+
+// addLookup records that the kernel looked up the directory name in parent, which has the node ID
+// node.
+func (fs *dirSyncFileSystem) addLookup(parent uint64, name string, node uint64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	dir := fs.dirs[node]
+	if dir == nil {
+		dir = &dirNode{}
+		fs.dirs[node] = dir
+	}
+	dir.parent, dir.name = parent, name
+	dir.lookups++
+}
+
+func (fs *dirSyncFileSystem) Forget(node, lookups uint64) {
+	fs.RawFileSystem.Forget(node, lookups)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if dir := fs.dirs[node]; dir != nil {
+		if dir.lookups <= lookups {
+			delete(fs.dirs, node)
+		} else {
+			dir.lookups -= lookups
+		}
+	}
+}
+
+func (fs *dirSyncFileSystem) Rename(input *fuse.RenameIn, oldName string, newName string) fuse.Status {
+	status := fs.RawFileSystem.Rename(input, oldName, newName)
+	if status != fuse.OK {
+		return status
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, dir := range fs.dirs {
+		if dir.parent == input.NodeId && dir.name == oldName {
+			dir.parent, dir.name = input.Newdir, newName
+		}
+	}
+	return status
+}
+
+// path returns the path of the directory with the given node ID, relative to the root of the
+// mount, and whether it is known.
+func (fs *dirSyncFileSystem) path(node uint64) (string, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var names []string
+	for node != fuse.FUSE_ROOT_ID {
+		dir := fs.dirs[node]
+		if dir == nil {
+			return "", false
+		}
+		names = append([]string{dir.name}, names...)
+		node = dir.parent
+	}
+	return filepath.Join(names...), true
+}
+
+func (fs *dirSyncFileSystem) FsyncDir(input *fuse.FsyncIn) fuse.Status {
+	path, ok := fs.path(input.NodeId)
+	if !ok {
+		return fs.RawFileSystem.FsyncDir(input)
+	}
+	return fs.sfs.FsyncDir(path, &input.Context)
+}
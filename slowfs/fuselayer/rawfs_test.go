@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuselayer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+func TestRawFileSystem_FsyncDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fuselayer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clk := clock.NewSimulatedClock(time.Time{})
+	router, err := scheduler.NewRouter(clk, []scheduler.Route{
+		{Pattern: "slow", Scheduler: scheduler.NewWithClock(basicDeviceConfig, clk)},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewRouter() error: %s", err)
+	}
+	sfs := NewRoutedSlowFs(dir, router, nil, nil)
+	for _, name := range []string{"slow", "slow/sub"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn := nodefs.NewFileSystemConnector(pathfs.NewPathNodeFs(sfs, nil).Root(), nil)
+	raw := NewRawFileSystem(conn.RawFS(), sfs)
+
+	lookup := func(parent uint64, name string) uint64 {
+		var out fuse.EntryOut
+		if status := raw.Lookup(&fuse.InHeader{NodeId: parent}, name, &out); status != fuse.OK {
+			t.Fatalf("Lookup(%d, %s) status = %s, want OK", parent, name, status)
+		}
+		return out.NodeId
+	}
+	fsyncDir := func(desc string, node uint64, wantStatus fuse.Status, want time.Duration) {
+		start := clk.Now()
+		if status := raw.FsyncDir(&fuse.FsyncIn{InHeader: fuse.InHeader{NodeId: node}}); status != wantStatus {
+			t.Errorf("fail (%s) status = %s, want %s", desc, status, wantStatus)
+		}
+		if got := clk.Since(start); got != want {
+			t.Errorf("fail (%s) took %s, want %s", desc, got, want)
+		}
+	}
+
+	slow := lookup(fuse.FUSE_ROOT_ID, "slow")
+	sub := lookup(slow, "sub")
+	fsyncDir("directory on a routed device", sub, fuse.OK, 100*time.Millisecond)
+	fsyncDir("root isn't routed", fuse.FUSE_ROOT_ID, fuse.OK, 0)
+
+	in := &fuse.RenameIn{InHeader: fuse.InHeader{NodeId: slow}, Newdir: fuse.FUSE_ROOT_ID}
+	if status := raw.Rename(in, "sub", "moved"); status != fuse.OK {
+		t.Fatalf("Rename(sub, moved) status = %s, want OK", status)
+	}
+	fsyncDir("renamed off the routed device", sub, fuse.OK, 0)
+
+	raw.Forget(sub, 1)
+	fsyncDir("forgotten directory", sub, fuse.ENOSYS, 0)
+}
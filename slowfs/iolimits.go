@@ -0,0 +1,209 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"fmt"
+	"slowfs/slowfs/units"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultIOWeight is the weight of processes that no IOLimit gives a weight to.
+const DefaultIOWeight = 100
+
+// IOLimit limits the reads and writes of the processes it matches, like a blkio cgroup. All the
+// processes it matches share the same limits.
+type IOLimit struct {
+	// Match is which processes the limit applies to: "uid", "gid" or "process". Value is the UID,
+	// GID or process name they must have.
+	Match string
+	Value string
+
+	// How many bytes can be read and written per second, and how many read and write requests can
+	// be made per second. Zero means unlimited.
+	ReadBytesPerSecond  units.NumBytes
+	WriteBytesPerSecond units.NumBytes
+	ReadIOPS            int
+	WriteIOPS           int
+
+	// Weight is the share of the device the matched processes get relative to others with the
+	// fair I/O scheduler, between 1 and 10000. Zero means DefaultIOWeight.
+	Weight int
+}
+
+// Matches returns whether the limit applies to a process with the given UID, GID and name.
+func (l *IOLimit) Matches(uid, gid uint32, process string) bool {
+	switch l.Match {
+	case "uid":
+		return l.Value == strconv.FormatUint(uint64(uid), 10)
+	case "gid":
+		return l.Value == strconv.FormatUint(uint64(gid), 10)
+	case "process":
+		return l.Value == process
+	default:
+		return false
+	}
+}
+
+// IOWeight returns the limit's weight, or DefaultIOWeight if it doesn't set one.
+func (l *IOLimit) IOWeight() int {
+	if l.Weight == 0 {
+		return DefaultIOWeight
+	}
+	return l.Weight
+}
+
+// ReadTime returns how much of the bandwidth the limit allows it takes to read the given number of
+// bytes, or zero if reads are unlimited.
+func (l *IOLimit) ReadTime(numBytes units.NumBytes) time.Duration {
+	if l.ReadBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, l.ReadBytesPerSecond)
+}
+
+// WriteTime returns how much of the bandwidth the limit allows it takes to write the given number
+// of bytes, or zero if writes are unlimited.
+func (l *IOLimit) WriteTime(numBytes units.NumBytes) time.Duration {
+	if l.WriteBytesPerSecond == 0 {
+		return 0
+	}
+	return computeTimeFromThroughput(numBytes, l.WriteBytesPerSecond)
+}
+
+func (l *IOLimit) String() string {
+	parts := []string{l.Match + "=" + l.Value}
+	if l.ReadBytesPerSecond != 0 {
+		parts = append(parts, "rbps="+formatNumBytes(l.ReadBytesPerSecond))
+	}
+	if l.WriteBytesPerSecond != 0 {
+		parts = append(parts, "wbps="+formatNumBytes(l.WriteBytesPerSecond))
+	}
+	if l.ReadIOPS != 0 {
+		parts = append(parts, "riops="+strconv.Itoa(l.ReadIOPS))
+	}
+	if l.WriteIOPS != 0 {
+		parts = append(parts, "wiops="+strconv.Itoa(l.WriteIOPS))
+	}
+	if l.Weight != 0 {
+		parts = append(parts, "weight="+strconv.Itoa(l.Weight))
+	}
+	return strings.Join(parts, " ")
+}
+
+// IOLimits is a list of IOLimits. Each process is limited by the first one that matches it.
+type IOLimits []IOLimit
+
+// Match returns the first limit that applies to a process with the given UID, GID and name, and
+// its index, or nil and -1 if none do.
+func (ls IOLimits) Match(uid, gid uint32, process string) (*IOLimit, int) {
+	for i := range ls {
+		if ls[i].Matches(uid, gid, process) {
+			return &ls[i], i
+		}
+	}
+	return nil, -1
+}
+
+func (ls IOLimits) String() string {
+	parts := make([]string, len(ls))
+	for i := range ls {
+		parts[i] = ls[i].String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ParseIOLimitsFromString parses IOLimits from the given string, in a format like cgroup v2's
+// io.max: limits separated by semicolons, each of which starts with what it matches, followed by
+// the limits to apply. For example:
+//
+//	uid=1000 rbps=1MiB wiops=100; process=backup wbps=10MiB weight=50
+//
+// A value of max means unlimited.
+func ParseIOLimitsFromString(s string) (IOLimits, error) {
+	var limits IOLimits
+	for _, entry := range strings.Split(s, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		var l IOLimit
+		for i, field := range fields {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[1] == "" {
+				return nil, fmt.Errorf("expected key=value in I/O limit, got %s", field)
+			}
+			key, value := strings.ToLower(kv[0]), kv[1]
+			if i == 0 {
+				if key != "uid" && key != "gid" && key != "process" {
+					return nil, fmt.Errorf("I/O limit must start with uid, gid or process, got %s", field)
+				}
+				l.Match, l.Value = key, value
+				continue
+			}
+			if err := l.setField(key, value); err != nil {
+				return nil, err
+			}
+		}
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+func (l *IOLimit) setField(key, value string) error {
+	var err error
+	switch key {
+	case "rbps":
+		l.ReadBytesPerSecond, err = parseBytesLimit(value)
+	case "wbps":
+		l.WriteBytesPerSecond, err = parseBytesLimit(value)
+	case "riops":
+		l.ReadIOPS, err = parseIOPSLimit(value)
+	case "wiops":
+		l.WriteIOPS, err = parseIOPSLimit(value)
+	case "weight":
+		l.Weight, err = strconv.Atoi(value)
+		if err == nil && (l.Weight < 1 || l.Weight > 10000) {
+			err = fmt.Errorf("I/O weight must be between 1 and 10000, got %d", l.Weight)
+		}
+	default:
+		return fmt.Errorf("unknown I/O limit %s", key)
+	}
+	return err
+}
+
+func parseBytesLimit(value string) (units.NumBytes, error) {
+	if value == "max" {
+		return 0, nil
+	}
+	n, err := units.ParseNumBytesFromString(value)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("I/O limit cannot be negative, got %s", value)
+	}
+	return n, err
+}
+
+func parseIOPSLimit(value string) (int, error) {
+	if value == "max" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("I/O limit cannot be negative, got %s", value)
+	}
+	return n, err
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowfs
+
+import (
+	"reflect"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestParseIOLimitsFromString(t *testing.T) {
+	cases := []struct {
+		s         string
+		want      IOLimits
+		shouldErr bool
+	}{
+		{"", nil, false},
+		{
+			"uid=1000 rbps=1MiB wiops=100; process=backup wbps=10MiB riops=max weight=50;",
+			IOLimits{
+				{Match: "uid", Value: "1000", ReadBytesPerSecond: units.Mebibyte, WriteIOPS: 100},
+				{Match: "process", Value: "backup", WriteBytesPerSecond: 10 * units.Mebibyte, Weight: 50},
+			},
+			false,
+		},
+		{"GID=10 RBPS=max", IOLimits{{Match: "gid", Value: "10"}}, false},
+		{"rbps=1MiB", nil, true},
+		{"uid=1000 rbps", nil, true},
+		{"uid=1000 rbps=-1B", nil, true},
+		{"uid=1000 weight=0", nil, true},
+		{"uid=1000 chicken=4", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseIOLimitsFromString(c.s)
+		if c.shouldErr != (err != nil) {
+			t.Errorf("ParseIOLimitsFromString(%q) = _, %v, want error: %t", c.s, err, c.shouldErr)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseIOLimitsFromString(%q) = %v, want %v", c.s, got, c.want)
+		}
+	}
+}
+
+func TestIOLimits_String(t *testing.T) {
+	s := "uid=1000 rbps=1MiB wiops=100; process=backup wbps=10MiB weight=50"
+	limits, err := ParseIOLimitsFromString(s)
+	if err != nil {
+		t.Fatalf("ParseIOLimitsFromString(%q) error: %s", s, err)
+	}
+	want := "uid=1000 rbps=1048576B wiops=100; process=backup wbps=10485760B weight=50"
+	if got := limits.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestIOLimits_Match(t *testing.T) {
+	limits := IOLimits{
+		{Match: "process", Value: "backup", Weight: 50},
+		{Match: "uid", Value: "1000"},
+		{Match: "gid", Value: "20"},
+	}
+
+	cases := []struct {
+		uid, gid  uint32
+		process   string
+		wantIndex int
+	}{
+		{1000, 20, "backup", 0},
+		{1000, 20, "db", 1},
+		{0, 20, "db", 2},
+		{0, 0, "db", -1},
+	}
+
+	for _, c := range cases {
+		got, idx := limits.Match(c.uid, c.gid, c.process)
+		if idx != c.wantIndex {
+			t.Errorf("Match(%d, %d, %s) = _, %d, want %d", c.uid, c.gid, c.process, idx, c.wantIndex)
+		}
+		if (got == nil) != (c.wantIndex == -1) || (got != nil && got != &limits[idx]) {
+			t.Errorf("Match(%d, %d, %s) = %v, want limit %d", c.uid, c.gid, c.process, got, c.wantIndex)
+		}
+	}
+}
+
+func TestIOLimit_ReadWriteTime(t *testing.T) {
+	l := IOLimit{Match: "uid", Value: "0", ReadBytesPerSecond: 100 * units.Byte}
+	if got, want := l.ReadTime(50*units.Byte), 500*time.Millisecond; got != want {
+		t.Errorf("ReadTime(50B) = %s, want %s", got, want)
+	}
+	if got, want := l.WriteTime(50*units.Byte), time.Duration(0); got != want {
+		t.Errorf("WriteTime(50B) = %s, want %s", got, want)
+	}
+}
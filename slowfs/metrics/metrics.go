@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exports statistics about what the scheduler is doing to Prometheus.
+package metrics
+
+import (
+	"slowfs/slowfs/scheduler"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector for a Scheduler. Per request metrics are recorded as the
+// scheduler handles requests, and the rest are read from the scheduler when collected.
+type Collector struct {
+	scheduler *scheduler.Scheduler
+
+	requests  *prometheus.CounterVec
+	bytes     *prometheus.CounterVec
+	delay     *prometheus.HistogramVec
+	seeks     *prometheus.CounterVec
+	reorders  *prometheus.CounterVec
+	hits      *prometheus.CounterVec
+	uidBytes  *prometheus.CounterVec
+	throttled *prometheus.CounterVec
+
+	queueLength            *prometheus.Desc
+	unwrittenBytes         *prometheus.Desc
+	orphanedUnwrittenBytes *prometheus.Desc
+	busySeconds            *prometheus.Desc
+	busyRatio              *prometheus.Desc
+}
+
+// New creates a Collector, and registers it to observe the given Scheduler.
+func New(s *scheduler.Scheduler) *Collector {
+	c := &Collector{
+		scheduler: s,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_requests_total",
+			Help: "Number of requests scheduled.",
+		}, []string{"type"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_request_bytes_total",
+			Help: "Number of bytes covered by requests scheduled.",
+		}, []string{"type"}),
+		delay: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slowfs_request_delay_seconds",
+			Help:    "How long requests were made to take.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"type"}),
+		seeks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_seeks_total",
+			Help: "Number of requests that had to seek.",
+		}, []string{"type"}),
+		reorders: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_reorders_total",
+			Help: "Number of requests reordered ahead of requests that arrived before them.",
+		}, []string{"type"}),
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_page_cache_hits_total",
+			Help: "Number of requests served entirely from the page cache.",
+		}, []string{"type"}),
+		uidBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_uid_request_bytes_total",
+			Help: "Number of bytes covered by requests scheduled for each user.",
+		}, []string{"uid", "type"}),
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slowfs_uid_throttled_seconds_total",
+			Help: "Time requests from each user were held back by I/O limits.",
+		}, []string{"uid"}),
+		queueLength: prometheus.NewDesc("slowfs_queue_length",
+			"Number of read and write requests waiting to be reordered.", nil, nil),
+		unwrittenBytes: prometheus.NewDesc("slowfs_writeback_dirty_bytes",
+			"Number of bytes in the write back cache for open files.", nil, nil),
+		orphanedUnwrittenBytes: prometheus.NewDesc("slowfs_writeback_orphaned_dirty_bytes",
+			"Number of bytes in the write back cache for closed files.", nil, nil),
+		busySeconds: prometheus.NewDesc("slowfs_device_busy_seconds_total",
+			"Time the device has spent working on requests.", nil, nil),
+		busyRatio: prometheus.NewDesc("slowfs_device_busy_ratio",
+			"Fraction of time the device has spent working on requests since starting.", nil, nil),
+	}
+	s.AddObserver(c)
+	return c
+}
+
+// Observe records metrics for a request the scheduler has handled.
+func (c *Collector) Observe(e *scheduler.Event) {
+	reqType := e.Request.Type.String()
+	c.requests.WithLabelValues(reqType).Inc()
+	c.bytes.WithLabelValues(reqType).Add(float64(e.Request.Size))
+	c.delay.WithLabelValues(reqType).Observe(e.Duration.Seconds())
+	if e.Seek {
+		c.seeks.WithLabelValues(reqType).Inc()
+	}
+	if e.Reordered {
+		c.reorders.WithLabelValues(reqType).Inc()
+	}
+	if e.CacheHit {
+		c.hits.WithLabelValues(reqType).Inc()
+	}
+	uid := strconv.FormatUint(uint64(e.Request.Uid), 10)
+	c.uidBytes.WithLabelValues(uid, reqType).Add(float64(e.Request.Size))
+	if e.Throttled > 0 {
+		c.throttled.WithLabelValues(uid).Add(e.Throttled.Seconds())
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.requests.Describe(ch)
+	c.bytes.Describe(ch)
+	c.delay.Describe(ch)
+	c.seeks.Describe(ch)
+	c.reorders.Describe(ch)
+	c.hits.Describe(ch)
+	c.uidBytes.Describe(ch)
+	c.throttled.Describe(ch)
+	ch <- c.queueLength
+	ch <- c.unwrittenBytes
+	ch <- c.orphanedUnwrittenBytes
+	ch <- c.busySeconds
+	ch <- c.busyRatio
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.requests.Collect(ch)
+	c.bytes.Collect(ch)
+	c.delay.Collect(ch)
+	c.seeks.Collect(ch)
+	c.reorders.Collect(ch)
+	c.hits.Collect(ch)
+	c.uidBytes.Collect(ch)
+	c.throttled.Collect(ch)
+
+	stats := c.scheduler.Stats()
+	var busyRatio float64
+	if stats.Elapsed > 0 {
+		busyRatio = float64(stats.BusyTime) / float64(stats.Elapsed)
+	}
+	ch <- prometheus.MustNewConstMetric(c.queueLength, prometheus.GaugeValue, float64(stats.QueueLength))
+	ch <- prometheus.MustNewConstMetric(c.unwrittenBytes, prometheus.GaugeValue, float64(stats.UnwrittenBytes))
+	ch <- prometheus.MustNewConstMetric(c.orphanedUnwrittenBytes, prometheus.GaugeValue,
+		float64(stats.OrphanedUnwrittenBytes))
+	ch <- prometheus.MustNewConstMetric(c.busySeconds, prometheus.CounterValue, stats.BusyTime.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.busyRatio, prometheus.GaugeValue, busyRatio)
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	clk := clock.NewSimulatedClock(time.Time{})
+	s := scheduler.NewWithClock(&config, clk)
+	c := New(s)
+
+	reqs := []*scheduler.Request{
+		{Type: scheduler.ReadRequest, Path: "a", Start: 0, Size: 4 * units.Kibibyte},
+		{Type: scheduler.ReadRequest, Path: "a", Start: 4 * units.Kibibyte, Size: 4 * units.Kibibyte},
+		{Type: scheduler.WriteRequest, Path: "a", Start: 0, Size: 100, Caller: scheduler.Caller{Uid: 1000}},
+		{Type: scheduler.MetadataRequest},
+	}
+	for _, req := range reqs {
+		req.Timestamp = clk.Now()
+		opTime := s.Schedule(req)
+		clk.Sleep(opTime - clk.Since(req.Timestamp))
+	}
+
+	want := `
+# HELP slowfs_requests_total Number of requests scheduled.
+# TYPE slowfs_requests_total counter
+slowfs_requests_total{type="metadata"} 1
+slowfs_requests_total{type="read"} 2
+slowfs_requests_total{type="write"} 1
+# HELP slowfs_request_bytes_total Number of bytes covered by requests scheduled.
+# TYPE slowfs_request_bytes_total counter
+slowfs_request_bytes_total{type="metadata"} 0
+slowfs_request_bytes_total{type="read"} 8192
+slowfs_request_bytes_total{type="write"} 100
+# HELP slowfs_seeks_total Number of requests that had to seek.
+# TYPE slowfs_seeks_total counter
+slowfs_seeks_total{type="read"} 1
+# HELP slowfs_uid_request_bytes_total Number of bytes covered by requests scheduled for each user.
+# TYPE slowfs_uid_request_bytes_total counter
+slowfs_uid_request_bytes_total{type="metadata",uid="0"} 0
+slowfs_uid_request_bytes_total{type="read",uid="0"} 8192
+slowfs_uid_request_bytes_total{type="write",uid="1000"} 100
+# HELP slowfs_writeback_dirty_bytes Number of bytes in the write back cache for open files.
+# TYPE slowfs_writeback_dirty_bytes gauge
+slowfs_writeback_dirty_bytes 100
+`
+	names := []string{"slowfs_requests_total", "slowfs_request_bytes_total", "slowfs_seeks_total",
+		"slowfs_uid_request_bytes_total", "slowfs_writeback_dirty_bytes"}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "slowfs_device_busy_ratio" {
+			continue
+		}
+		if got := family.GetMetric()[0].GetGauge().GetValue(); got <= 0 || got > 1 {
+			t.Errorf("slowfs_device_busy_ratio = %f, want in (0, 1]", got)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"hash/fnv"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// array fans requests out to the member devices of a composite device, like a RAID array, and
+// tracks which data lives on which member.
+type array struct {
+	layout  slowfs.DeviceLayout
+	stripe  units.NumBytes
+	members []*deviceContext
+
+	// For TieredLayout, the chunks copied to the fast member, from most to least recently used, and
+	// which of them have been written to since.
+	hot         *pageList
+	hotCapacity int
+	dirty       map[pageKey]bool
+
+	// For TieredLayout, how often recently accessed chunks still on the slow member have been
+	// accessed, from most to least recently accessed, and how many accesses promote them.
+	seen         *pageList
+	accesses     map[pageKey]int
+	promoteAfter int
+}
+
+// memberOp is the part of a request sent to one member.
+type memberOp struct {
+	member int
+	req    *Request
+	kind   transferKind
+	// Whether the old data and parity have to be read before being overwritten.
+	readModifyWrite bool
+}
+
+// newArray creates the members of the composite device described by config, or returns nil if
+// config describes a single device.
+func newArray(config *slowfs.DeviceConfig) *array {
+	if config.Layout == slowfs.SingleDevice {
+		return nil
+	}
+	a := &array{
+		layout: config.Layout,
+		stripe: config.Stripe(),
+	}
+	for _, m := range config.MemberConfigs {
+		a.members = append(a.members, newDeviceContext(m))
+	}
+	if config.Layout == slowfs.TieredLayout {
+		a.hot = newPageList()
+		a.dirty = make(map[pageKey]bool)
+		a.seen = newPageList()
+		a.accesses = make(map[pageKey]int)
+	}
+	a.setConfig(config)
+	return a
+}
+
+// sameLayout returns whether config lays data out on the same members in the same way, so the
+// array can carry on with the data where it is.
+func (a *array) sameLayout(config *slowfs.DeviceConfig) bool {
+	if config.Layout != a.layout || config.Stripe() != a.stripe || len(config.MemberConfigs) != len(a.members) {
+		return false
+	}
+	for i, m := range config.MemberConfigs {
+		if m.Name != a.members[i].deviceConfig.Name {
+			return false
+		}
+	}
+	return true
+}
+
+// setConfig switches the members over to their configs in config, and applies its tiering
+// settings. Chunks that no longer fit on the fast member are dropped from it.
+func (a *array) setConfig(config *slowfs.DeviceConfig) {
+	for i, m := range a.members {
+		if m.deviceConfig != config.MemberConfigs[i] {
+			m.setConfig(config.MemberConfigs[i])
+		}
+	}
+	if a.layout != slowfs.TieredLayout {
+		return
+	}
+	a.hotCapacity = maxInt(int(config.TierCacheSize/a.stripe), 1)
+	a.promoteAfter = config.PromoteAfter()
+	for a.hot.len() > a.hotCapacity {
+		delete(a.dirty, a.hot.popBack())
+	}
+}
+
+// run computes when a request with the given cost finishes, once each member it's fanned out to
+// has done its part. If commit is set, it also records the members being busy with it.
+func (a *array) run(req *Request, cost requestCost, commit bool) time.Time {
+	end := req.Timestamp.Add(cost.access)
+	for _, op := range a.plan(req, cost.kind, cost.bytes) {
+		m := a.members[op.member]
+		memberCost := a.memberCost(m, op, cost.access)
+		var opEnd time.Time
+		if commit {
+			opEnd = m.occupy(op.req, memberCost)
+			if op.kind != noTransfer {
+				m.streams.access(op.req.Path, op.req.Start+op.req.Size)
+				m.moveHead(op.req)
+			}
+		} else {
+			opEnd, _ = m.schedule(op.req, memberCost)
+		}
+		end = latestTime(end, opEnd)
+	}
+	if commit && a.layout == slowfs.TieredLayout {
+		a.updateTiers(req, cost.kind, cost.bytes, end)
+	}
+	return end
+}
+
+// memberCost computes how long a member is occupied by its part of a request, on top of the given
+// fixed access time shared by every member.
+func (a *array) memberCost(m *deviceContext, op memberOp, access time.Duration) requestCost {
+	cost := requestCost{access: access, kind: op.kind, bytes: op.req.Size}
+	switch op.kind {
+	case noTransfer:
+		return cost
+	case readTransfer:
+		cost.transfer = m.deviceConfig.ReadTime(op.req.Size)
+	case writeTransfer:
+		cost.transfer = m.deviceConfig.WriteTime(op.req.Size)
+		if op.readModifyWrite {
+			cost.transfer += m.deviceConfig.ReadTime(op.req.Size) + rewriteLatency(m, op.req)
+		}
+	case allocateTransfer:
+		cost.transfer = m.deviceConfig.AllocateTime(op.req.Size)
+	}
+	cost.access += m.computeSeekTime(op.req)
+	return cost
+}
+
+// rewriteLatency returns how long a member waits between reading data and overwriting it in place:
+// a full revolution of the platters for rotational media, or the write latency for solid state
+// media.
+func rewriteLatency(m *deviceContext, req *Request) time.Duration {
+	switch {
+	case m.array != nil || m.deviceConfig.MediaType == slowfs.NetworkMedia:
+		return m.flushLatency(req)
+	case m.deviceConfig.MediaType == slowfs.SolidStateMedia:
+		return m.duration(req, "WriteLatency", m.deviceConfig.WriteLatency)
+	case m.deviceConfig.RPM > 0:
+		return 2 * m.deviceConfig.RotationalLatency()
+	default:
+		return m.duration(req, "SeekTime", m.deviceConfig.SeekTime)
+	}
+}
+
+// plan splits the given bytes of a request into the parts each member does. Each member does at
+// most one part, covering everything it's sent, so that members work in parallel. Requests without
+// any data to transfer, like metadata requests and flushes, go to every member.
+func (a *array) plan(req *Request, kind transferKind, bytes units.NumBytes) []memberOp {
+	ops := make([]*memberOp, len(a.members))
+	add := func(member int, start, size units.NumBytes, kind transferKind, readModifyWrite bool) {
+		if op := ops[member]; op != nil {
+			op.req.Size += size
+			op.readModifyWrite = op.readModifyWrite || readModifyWrite
+			return
+		}
+		reqType := WriteRequest
+		switch kind {
+		case readTransfer:
+			reqType = ReadRequest
+		case allocateTransfer:
+			reqType = AllocateRequest
+		}
+		ops[member] = &memberOp{
+			member:          member,
+			req:             &Request{Type: reqType, Timestamp: req.Timestamp, Path: req.Path, Start: start, Size: size},
+			kind:            kind,
+			readModifyWrite: readModifyWrite,
+		}
+	}
+
+	n := int64(len(a.members))
+	rotation := int64(pathHash(req.Path) % uint64(n))
+	switch {
+	case kind == noTransfer || bytes == 0:
+		for i := range a.members {
+			add(i, req.Start, 0, noTransfer, false)
+		}
+	case a.layout == slowfs.RAID0Layout:
+		a.chunks(req.Start, bytes, func(chunk int64, offset, size units.NumBytes) {
+			add(int((rotation+chunk)%n), units.NumBytes(chunk/n)*a.stripe+offset, size, kind, false)
+		})
+	case a.layout == slowfs.RAID1Layout && kind == readTransfer:
+		// Read from whichever member would finish first.
+		best, bestEnd := 0, time.Time{}
+		for i, m := range a.members {
+			op := memberOp{member: i, req: &Request{Type: ReadRequest, Timestamp: req.Timestamp, Path: req.Path, Start: req.Start, Size: bytes}, kind: kind}
+			if end, _ := m.schedule(op.req, a.memberCost(m, op, 0)); i == 0 || end.Before(bestEnd) {
+				best, bestEnd = i, end
+			}
+		}
+		add(best, req.Start, bytes, kind, false)
+	case a.layout == slowfs.RAID1Layout:
+		for i := range a.members {
+			add(i, req.Start, bytes, kind, false)
+		}
+	case a.layout == slowfs.RAID5Layout || a.layout == slowfs.RAID6Layout:
+		a.planParity(req.Start, bytes, kind, rotation, add)
+	case a.layout == slowfs.TieredLayout:
+		a.chunks(req.Start, bytes, func(chunk int64, offset, size units.NumBytes) {
+			member := 1
+			if a.hot.contains(pageKey{req.Path, chunk}) {
+				member = 0
+			}
+			add(member, units.NumBytes(chunk)*a.stripe+offset, size, kind, false)
+		})
+	}
+
+	var planned []memberOp
+	for _, op := range ops {
+		if op != nil {
+			planned = append(planned, *op)
+		}
+	}
+	return planned
+}
+
+// planParity splits the size bytes at start between the members of a RAID5Layout or RAID6Layout
+// device. Each row of stripes has one or two parity stripes, which move along a member each row.
+// Writes covering whole rows compute the parity from the new data, but other writes have to read
+// the old data and parity first.
+func (a *array) planParity(start, size units.NumBytes, kind transferKind, rotation int64,
+	add func(member int, start, size units.NumBytes, kind transferKind, readModifyWrite bool)) {
+	n := int64(len(a.members))
+	parity := int64(1)
+	if a.layout == slowfs.RAID6Layout {
+		parity = 2
+	}
+	data := n - parity
+	rowSize := units.NumBytes(data) * a.stripe
+	end := start + size
+	firstMember := func(row int64) int64 {
+		return (rotation + row) % n
+	}
+
+	partial := func(row int64) bool {
+		rowStart := units.NumBytes(row) * rowSize
+		return kind == writeTransfer && (rowStart < start || rowStart+rowSize > end)
+	}
+
+	if kind != readTransfer {
+		for row := int64(start / rowSize); units.NumBytes(row)*rowSize < end; row++ {
+			// Parity covers the same part of each stripe as the data written to the row.
+			lo := units.NumBytesMax(start, units.NumBytes(row)*rowSize)
+			hi := units.NumBytesMin(end, units.NumBytes(row+1)*rowSize)
+			offset, length := units.NumBytes(0), a.stripe
+			if lo/a.stripe == (hi-1)/a.stripe {
+				offset, length = lo%a.stripe, hi-lo
+			}
+			for p := int64(0); p < parity; p++ {
+				add(int((firstMember(row)+p)%n), units.NumBytes(row)*a.stripe+offset, length, kind, partial(row))
+			}
+		}
+	}
+
+	a.chunks(start, size, func(chunk int64, offset, size units.NumBytes) {
+		row := chunk / data
+		member := (firstMember(row) + parity + chunk%data) % n
+		add(int(member), units.NumBytes(row)*a.stripe+offset, size, kind, kind != readTransfer && partial(row))
+	})
+}
+
+// chunks calls f for each stripe sized chunk the size bytes at start touch, with the chunk's index
+// and the part of it touched.
+func (a *array) chunks(start, size units.NumBytes, f func(chunk int64, offset, size units.NumBytes)) {
+	for end := start + size; start < end; {
+		offset := start % a.stripe
+		length := units.NumBytesMin(a.stripe-offset, end-start)
+		f(int64(start/a.stripe), offset, length)
+		start += length
+	}
+}
+
+// updateTiers records which chunks of a TieredLayout device a request touched, and copies chunks
+// accessed often enough to the fast member once the request finishes.
+func (a *array) updateTiers(req *Request, kind transferKind, bytes units.NumBytes, end time.Time) {
+	if kind == noTransfer {
+		return
+	}
+	a.chunks(req.Start, bytes, func(chunk int64, _, _ units.NumBytes) {
+		key := pageKey{req.Path, chunk}
+		if a.hot.contains(key) {
+			a.hot.pushFront(key)
+			if kind == writeTransfer {
+				a.dirty[key] = true
+			}
+			return
+		}
+
+		a.accesses[key]++
+		a.seen.pushFront(key)
+		if a.accesses[key] < a.promoteAfter {
+			if a.seen.len() > a.hotCapacity {
+				delete(a.accesses, a.seen.popBack())
+			}
+			return
+		}
+		a.seen.remove(key)
+		delete(a.accesses, key)
+		a.promote(key, end)
+	})
+}
+
+// promote copies a chunk from the slow member to the fast member in the background, starting at the
+// given time. If the fast member is full, the least recently used chunk is evicted first, being
+// copied back to the slow member if it has been written to.
+func (a *array) promote(key pageKey, at time.Time) {
+	if a.hot.len() >= a.hotCapacity {
+		evicted := a.hot.popBack()
+		if a.dirty[evicted] {
+			delete(a.dirty, evicted)
+			a.copyChunk(evicted, 0, 1, at)
+		}
+	}
+	a.copyChunk(key, 1, 0, at)
+	a.hot.pushFront(key)
+}
+
+// copyChunk reads a chunk from one member, then writes it to another. It keeps both members busy,
+// but nothing waits for it.
+func (a *array) copyChunk(key pageKey, from, to int, at time.Time) {
+	start := units.NumBytes(key.page) * a.stripe
+	read := memberOp{
+		member: from,
+		req:    &Request{Type: ReadRequest, Timestamp: at, Path: key.path, Start: start, Size: a.stripe},
+		kind:   readTransfer,
+	}
+	readEnd := a.members[from].occupy(read.req, a.memberCost(a.members[from], read, 0))
+	write := memberOp{
+		member: to,
+		req:    &Request{Type: WriteRequest, Timestamp: readEnd, Path: key.path, Start: start, Size: a.stripe},
+		kind:   writeTransfer,
+	}
+	a.members[to].occupy(write.req, a.memberCost(a.members[to], write, 0))
+}
+
+// needsSeek returns whether any member the request would be sent to has to seek.
+func (a *array) needsSeek(req *Request) bool {
+	kind := writeTransfer
+	switch req.Type {
+	case ReadRequest:
+		kind = readTransfer
+	case AllocateRequest:
+		kind = allocateTransfer
+	}
+	for _, op := range a.plan(req, kind, req.Size) {
+		m := a.members[op.member]
+		if (m.array != nil || m.deviceConfig.MediaType == slowfs.RotationalMedia) && m.needsSeek(op.req) {
+			return true
+		}
+	}
+	return false
+}
+
+// flushLatency returns the fixed cost of starting to flush data to the slowest member.
+func (a *array) flushLatency(req *Request) time.Duration {
+	var latency time.Duration
+	for _, m := range a.members {
+		if l := m.flushLatency(req); l > latency {
+			latency = l
+		}
+	}
+	return latency
+}
+
+// pathHash spreads files across the members, so that they don't all start on the same one.
+func pathHash(path string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	return h.Sum64()
+}
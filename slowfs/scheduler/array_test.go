@@ -0,0 +1,131 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"testing"
+	"time"
+)
+
+func TestArray_ComputeTimeAndExecute(t *testing.T) {
+	type requestInvocation struct {
+		at   time.Duration
+		req  *Request
+		want time.Duration
+	}
+
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		requests     []requestInvocation
+	}{
+		{
+			desc:         "raid0 reads stripes in parallel",
+			deviceConfig: compositeDeviceConfig(slowfs.RAID0Layout, basicDeviceConfig, basicDeviceConfig),
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 4}, want: 30 * time.Millisecond},
+				// Each member carries on sequentially from its first stripe.
+				{at: 30 * time.Millisecond, req: &Request{Type: ReadRequest, Path: "a", Start: 4, Size: 4}, want: 20 * time.Millisecond},
+			},
+		},
+		{
+			desc:         "raid1 reads from the idle member and writes to both",
+			deviceConfig: compositeDeviceConfig(slowfs.RAID1Layout, basicDeviceConfig, basicDeviceConfig),
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 30 * time.Millisecond},
+				{at: 0, req: &Request{Type: ReadRequest, Path: "b", Start: 0, Size: 2}, want: 30 * time.Millisecond},
+				{at: 0, req: &Request{Type: WriteRequest, Path: "c", Start: 0, Size: 2}, want: 60 * time.Millisecond},
+			},
+		},
+		{
+			desc: "raid5 reads old data and parity for partial writes",
+			deviceConfig: compositeDeviceConfig(slowfs.RAID5Layout,
+				basicDeviceConfig, basicDeviceConfig, basicDeviceConfig),
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: WriteRequest, Path: "a", Start: 0, Size: 4}, want: 30 * time.Millisecond},
+				// Seek, read, wait for the rewrite, then write.
+				{at: time.Second, req: &Request{Type: WriteRequest, Path: "b", Start: 0, Size: 2}, want: 60 * time.Millisecond},
+				{at: 2 * time.Second, req: &Request{Type: ReadRequest, Path: "b", Start: 0, Size: 4}, want: 30 * time.Millisecond},
+			},
+		},
+		{
+			desc: "raid6 updates both parity stripes",
+			deviceConfig: compositeDeviceConfig(slowfs.RAID6Layout,
+				basicDeviceConfig, basicDeviceConfig, basicDeviceConfig, basicDeviceConfig),
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: WriteRequest, Path: "a", Start: 0, Size: 4}, want: 30 * time.Millisecond},
+				// Every member carries on from the first row, so only reads, waits and writes.
+				{at: time.Second, req: &Request{Type: WriteRequest, Path: "a", Start: 4, Size: 2}, want: 50 * time.Millisecond},
+			},
+		},
+		{
+			desc:         "tiered promotes chunks to the fast member",
+			deviceConfig: compositeDeviceConfig(slowfs.TieredLayout, fastTierDeviceConfig, basicDeviceConfig),
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 30 * time.Millisecond},
+				{at: time.Second, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 3 * time.Millisecond},
+				{at: 2 * time.Second, req: &Request{Type: WriteRequest, Path: "a", Start: 0, Size: 2}, want: 3 * time.Millisecond},
+				// Evicts a, which has to be written back to the slow member.
+				{at: 3 * time.Second, req: &Request{Type: ReadRequest, Path: "b", Start: 0, Size: 2}, want: 30 * time.Millisecond},
+				{at: 3*time.Second + 30*time.Millisecond, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 93 * time.Millisecond},
+			},
+		},
+		{
+			desc:         "metadata goes to every member",
+			deviceConfig: compositeDeviceConfig(slowfs.RAID0Layout, basicDeviceConfig, basicDeviceConfig),
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 30 * time.Millisecond},
+				{at: 0, req: &Request{Type: MetadataRequest}, want: 110 * time.Millisecond},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(c.deviceConfig)
+		for _, req := range c.requests {
+			req.req.Timestamp = startTime.Add(req.at)
+			if got, want := dc.computeTime(req.req), req.want; got != want {
+				t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req.req, got, want)
+			}
+			dc.execute(req.req)
+		}
+	}
+}
+
+func TestArray_SetConfig(t *testing.T) {
+	config := compositeDeviceConfig(slowfs.TieredLayout, fastTierDeviceConfig, basicDeviceConfig)
+	dc := newDeviceContext(config)
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 2})
+	if !dc.array.hot.contains(pageKey{"a", 0}) {
+		t.Fatalf("chunk wasn't promoted")
+	}
+
+	// Tiering settings keep the chunks where they are.
+	bigger := *config
+	bigger.TierCacheSize *= 2
+	dc.setConfig(&bigger)
+	if !dc.array.hot.contains(pageKey{"a", 0}) {
+		t.Errorf("setConfig(%s) dropped the promoted chunk", &bigger)
+	}
+
+	// Changing the members starts afresh.
+	mirror := *config
+	mirror.Layout = slowfs.RAID1Layout
+	dc.setConfig(&mirror)
+	if got, want := dc.array.layout, slowfs.RAID1Layout; got != want {
+		t.Errorf("setConfig(%s) left layout %s, want %s", &mirror, got, want)
+	}
+}
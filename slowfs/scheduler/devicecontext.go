@@ -25,133 +25,654 @@ import (
 // DeviceContext holds the state of the device to determine how long a request should take, taking
 // into account things like seeking and sequentiality. This is after any re-ordering has been
 // applied. Conceptually this is the actual physical medium -- executing a request here affects
-// the state of the device. In this model, we assume that the underlying medium can only run one
-// request at a time.
+// the state of the device. For rotational media, we assume that the underlying medium can only run
+// one request at a time. Solid state and network media can run one request per channel at a time.
 type deviceContext struct {
 	// Describes the physical media.
 	deviceConfig *slowfs.DeviceConfig
 
-	// For the last accessed file, record the offset of the first byte we have not accessed.
-	// This is used to determine if reads are sequential or not.
-	firstUnseenByte units.NumBytes
+	// For recently accessed files, record the offset of the first byte we have not accessed.
+	// This is used to determine if accesses are sequential or not. Accesses to other files are
+	// assumed to be non-sequential.
+	streams *streamTable
 
-	// Accesses to different files are assumed to be non-sequential reads.
-	lastAccessedFile string
+	// Where the head was left on the simulated disk by the last access. Only used by DistanceSeek.
+	headPosition units.NumBytes
 
-	// The device can only execute one request at a time, so record when it is busy until.
+	// Total time the device has spent working on at least one request.
+	busyTime time.Duration
+
+	// The device can only execute one request at a time, so record when it is busy until. For
+	// solid state and network media, this is when the last channel becomes free.
 	busyUntil time.Time
 
+	// For solid state and network media, record when each channel is busy until.
+	channelBusyUntil []time.Time
+
+	// For solid state and network media, the read and write bandwidth is shared between channels,
+	// so record when each is next free for transferring data.
+	readBusyUntil  time.Time
+	writeBusyUntil time.Time
+
 	logger *log.Logger
 
 	// Holds information about data not yet written back to disk.
 	writeBackCache *writeBackCache
+
+	// When the flusher next wakes up to write back expired data.
+	nextFlush time.Time
+
+	// Holds which file data is cached in memory, or nil if the device has no page cache.
+	pageCache *pageCache
+
+	// Tracks sequential reads to read ahead of, or nil if the device doesn't read ahead.
+	readahead *readahead
+
+	// The member devices requests are fanned out to, or nil if this is a single device.
+	array *array
 }
 
 // NewDeviceContext creates a new context given a DeviceConfig. DeviceContext will use that
 // configuration to compute how long requests take.
 func newDeviceContext(config *slowfs.DeviceConfig) *deviceContext {
 	var writeBackCache *writeBackCache
-	if config.FsyncStrategy == slowfs.WriteBackCachedFsync {
+	if config.FsyncStrategy.UsesWriteBackCache() {
 		writeBackCache = newWriteBackCache(config)
 	}
+	var channelBusyUntil []time.Time
+	if config.MediaType.UsesChannels() {
+		channelBusyUntil = make([]time.Time, maxInt(config.Channels, 1))
+	}
 	return &deviceContext{
-		deviceConfig:   config,
-		logger:         log.New(os.Stderr, "DeviceContext: ", log.Ldate|log.Ltime|log.Lshortfile),
-		writeBackCache: writeBackCache,
+		deviceConfig:     config,
+		logger:           log.New(os.Stderr, "DeviceContext: ", log.Ldate|log.Ltime|log.Lshortfile),
+		writeBackCache:   writeBackCache,
+		streams:          newStreamTable(config.StreamTableSize),
+		pageCache:        newPageCache(config),
+		readahead:        newReadahead(config),
+		channelBusyUntil: channelBusyUntil,
+		array:            newArray(config),
+	}
+}
+
+// SetConfig switches the device over to a new configuration, keeping whatever state still applies.
+func (dc *deviceContext) setConfig(config *slowfs.DeviceConfig) {
+	oldConfig := dc.deviceConfig
+	dc.deviceConfig = config
+
+	// The cached pages only still make sense if the pages are the same.
+	if config.PageCacheSize != oldConfig.PageCacheSize || config.CachePageSize() != oldConfig.CachePageSize() ||
+		config.PageCacheEviction != oldConfig.PageCacheEviction {
+		dc.pageCache = newPageCache(config)
+	}
+
+	dc.streams.resize(config.StreamTableSize)
+
+	if config.ReadaheadMaxWindow == 0 {
+		dc.readahead = nil
+	} else if dc.readahead == nil {
+		dc.readahead = newReadahead(config)
+	} else {
+		dc.readahead.initialWindow = config.ReadaheadInitialWindow
+		dc.readahead.maxWindow = config.ReadaheadMaxWindow
+	}
+
+	if !config.FsyncStrategy.UsesWriteBackCache() {
+		dc.writeBackCache = nil
+	} else if dc.writeBackCache == nil {
+		dc.writeBackCache = newWriteBackCache(config)
+	} else {
+		dc.writeBackCache.deviceConfig = config
+	}
+
+	if dc.array == nil || !dc.array.sameLayout(config) {
+		dc.array = newArray(config)
+	} else {
+		dc.array.setConfig(config)
+	}
+
+	if !config.MediaType.UsesChannels() {
+		dc.channelBusyUntil = nil
+		return
+	}
+	channelBusyUntil := make([]time.Time, maxInt(config.Channels, 1))
+	copy(channelBusyUntil, dc.channelBusyUntil)
+	for i := len(dc.channelBusyUntil); i < len(channelBusyUntil); i++ {
+		channelBusyUntil[i] = dc.busyUntil
 	}
+	dc.channelBusyUntil = channelBusyUntil
+}
+
+// transferKind denotes which of the device's bandwidths a request uses.
+type transferKind int
+
+const (
+	noTransfer transferKind = iota
+	readTransfer
+	writeTransfer
+	allocateTransfer
+)
+
+// requestCost breaks down how long a request occupies the device: a fixed access time (e.g. a seek
+// or per-request latency), followed by a transfer of bytes of data. Reads served entirely from memory don't
+// occupy the device at all, and just take the transfer time, after waiting for any data still
+// being read ahead.
+type requestCost struct {
+	access   time.Duration
+	transfer time.Duration
+	kind     transferKind
+	bytes    units.NumBytes
+	cached   bool
 }
 
 // ComputeTime computes how long a request should take given the current state of the device.
 // It does not update the context.
 func (dc *deviceContext) computeTime(req *Request) time.Duration {
-	requestDuration := time.Duration(0)
+	end, _ := dc.schedule(req, dc.computeCost(req))
+	return end.Sub(req.Timestamp)
+}
+
+// computeCost computes how long a request will occupy the device, not taking into account waiting
+// for the device to become free.
+func (dc *deviceContext) computeCost(req *Request) requestCost {
+	var cost requestCost
 
 	switch req.Type {
 	// Handle metadata requests, plus metadata requests that have been factored out because we
 	// need separate handling for them.
 	case MetadataRequest, CloseRequest:
-		requestDuration = dc.deviceConfig.MetadataOpTime
+		if dc.deviceConfig.MediaType == slowfs.NetworkMedia {
+			cost = dc.computeNetworkMetadataCost(req)
+			break
+		}
+		cost.access = dc.duration(req, "MetadataOpTime", dc.deviceConfig.MetadataOpTime)
 	case AllocateRequest:
-		requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.AllocateTime(req.Size)
+		cost.access = dc.computeSeekTime(req)
+		cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.AllocateTime(req.Size), allocateTransfer, req.Size
 	case ReadRequest:
-		requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.ReadTime(req.Size)
+		if dc.cacheHit(req) {
+			if dc.readahead != nil {
+				cost.access = dc.readahead.wait(req)
+			}
+			cost.transfer, cost.cached = dc.deviceConfig.MemoryTime(req.Size), true
+			break
+		}
+		// Only data that isn't already in memory needs to be read from the device.
+		unread, missing := dc.unread(req)
+		cost.access = dc.computeSeekTime(unread)
+		cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.ReadTime(missing), readTransfer, missing
 	case WriteRequest:
+		if req.writesThrough() {
+			cost.access = dc.computeSeekTime(req) + dc.syncWriteLatency(req)
+			cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.WriteTime(req.Size), writeTransfer, req.Size
+			break
+		}
 		switch dc.deviceConfig.WriteStrategy {
 		case slowfs.FastWrite:
 			// Leave at 0 seconds.
 		case slowfs.SimulateWrite:
-			requestDuration = dc.computeSeekTime(req) + dc.deviceConfig.WriteTime(req.Size)
+			cost.access = dc.computeSeekTime(req)
+			cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.WriteTime(req.Size), writeTransfer, req.Size
 		}
-	case FsyncRequest:
-		switch dc.deviceConfig.FsyncStrategy {
-		case slowfs.DumbFsync:
-			requestDuration = dc.deviceConfig.SeekTime * 10
-		case slowfs.WriteBackCachedFsync:
-			requestDuration = dc.deviceConfig.SeekTime + dc.deviceConfig.WriteTime(dc.writeBackCache.getUnwrittenBytes(req.Path))
+		// Once too much data is waiting to be written back, writers wait while some of it is.
+		if dc.writeBackCache != nil {
+			if throttled := dc.writeBackCache.throttledBytes(req.Size); throttled > 0 {
+				cost.transfer += dc.deviceConfig.WriteTime(throttled)
+				cost.kind = writeTransfer
+				cost.bytes += throttled
+			}
+		}
+	case FsyncRequest, FdatasyncRequest, SyncfsRequest, DirFsyncRequest:
+		cost = dc.computeSyncCost(req)
+	case SyncFileRangeRequest:
+		// Without a write back cache, the data is already on the device.
+		if dc.writeBackCache == nil {
+			break
+		}
+		if bytes := units.NumBytesMin(dc.writeBackCache.getUnwrittenBytes(req.Path), req.Size); bytes > 0 {
+			cost.access = dc.computeSeekTime(req)
+			cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.WriteTime(bytes), writeTransfer, bytes
 		}
 	default:
 		dc.logger.Printf("unknown request type for %+v\n", req)
 	}
 
-	return latestTime(dc.busyUntil, req.Timestamp).Add(requestDuration).Sub(req.Timestamp)
+	return cost
+}
+
+// computeSyncCost computes how long an fsync, fdatasync, syncfs or directory fsync occupies the
+// device. Only JournaledFsync models metadata, so with the other strategies, fdatasync costs the
+// same as fsync, and a directory fsync just flushes the device's cache.
+func (dc *deviceContext) computeSyncCost(req *Request) requestCost {
+	var cost requestCost
+	strategy := dc.deviceConfig.FsyncStrategy
+	switch strategy {
+	case slowfs.NoFsync:
+		return cost
+	case slowfs.DumbFsync:
+		cost.access = dc.flushLatency(req) * 10
+		return cost
+	}
+
+	wbc := dc.writeBackCache
+	var bytes units.NumBytes
+	switch req.Type {
+	case FsyncRequest:
+		if strategy != slowfs.JournaledFsync {
+			bytes = wbc.getUnwrittenBytes(req.Path)
+			break
+		}
+		// Without any data to write back, only the file's metadata has to be committed.
+		if wbc.getUnwrittenBytes(req.Path) == 0 {
+			cost.access = dc.duration(req, "MetadataFsyncTime", dc.deviceConfig.MetadataFsyncTime)
+			return cost
+		}
+		bytes = wbc.entangledBytes(req.Path)
+		cost.access = dc.duration(req, "JournalCommitTime", dc.deviceConfig.JournalCommitTime)
+	case FdatasyncRequest:
+		// Skips committing the journal, so nothing else is written back either.
+		bytes = wbc.getUnwrittenBytes(req.Path)
+	case SyncfsRequest:
+		bytes = wbc.dirtyBytes()
+		if strategy == slowfs.JournaledFsync {
+			cost.access = dc.duration(req, "JournalCommitTime", dc.deviceConfig.JournalCommitTime)
+		}
+	case DirFsyncRequest:
+		if strategy == slowfs.JournaledFsync {
+			cost.access = dc.duration(req, "MetadataFsyncTime", dc.deviceConfig.MetadataFsyncTime)
+			return cost
+		}
+	}
+	cost.access += dc.flushLatency(req)
+	cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.WriteTime(bytes), writeTransfer, bytes
+	return cost
+}
+
+// syncWriteLatency returns how much longer a write to a file opened with O_SYNC or O_DSYNC takes
+// than just writing its data to the device: flushing the device's cache, and with O_SYNC and
+// JournaledFsync, committing the journal.
+func (dc *deviceContext) syncWriteLatency(req *Request) time.Duration {
+	if req.Flags&(SyncFlag|DataSyncFlag) == 0 {
+		return 0
+	}
+	switch dc.deviceConfig.FsyncStrategy {
+	case slowfs.NoFsync:
+		return 0
+	case slowfs.DumbFsync:
+		return dc.flushLatency(req) * 10
+	case slowfs.JournaledFsync:
+		if req.Flags&SyncFlag != 0 {
+			return dc.flushLatency(req) + dc.duration(req, "JournalCommitTime", dc.deviceConfig.JournalCommitTime)
+		}
+	}
+	return dc.flushLatency(req)
+}
+
+// schedule computes when a request with the given cost would finish given the current state of the
+// device, and for solid state and network media, which channel it would run on.
+func (dc *deviceContext) schedule(req *Request, cost requestCost) (time.Time, int) {
+	if cost.cached {
+		return req.Timestamp.Add(cost.access + cost.transfer), 0
+	}
+	if dc.array != nil {
+		return dc.array.run(req, cost, false), 0
+	}
+	if !dc.deviceConfig.MediaType.UsesChannels() {
+		return latestTime(dc.busyUntil, req.Timestamp).Add(cost.access + cost.transfer), 0
+	}
+
+	// Run on whichever channel frees up first, then wait for bandwidth to be available once the
+	// fixed latency has passed.
+	channel := 0
+	for i, busyUntil := range dc.channelBusyUntil {
+		if busyUntil.Before(dc.channelBusyUntil[channel]) {
+			channel = i
+		}
+	}
+	transferStart := latestTime(dc.channelBusyUntil[channel], req.Timestamp).Add(cost.access)
+	switch cost.kind {
+	case readTransfer:
+		transferStart = latestTime(dc.readBusyUntil, transferStart)
+	case writeTransfer:
+		transferStart = latestTime(dc.writeBusyUntil, transferStart)
+	}
+	return transferStart.Add(cost.transfer), channel
 }
 
 // Execute executes a given request, applying changes to the device context.
 func (dc *deviceContext) execute(req *Request) {
-	spareTime := req.Timestamp.Sub(dc.busyUntil)
+	dc.flushExpired(req.Timestamp)
+	end := dc.executeRequest(req)
 
-	// Devote spare time to writing back cache.
-	if spareTime > 0 && dc.writeBackCache != nil {
-		dc.writeBackCache.writeBack(spareTime)
+	if req.Type == ReadRequest && req.Flags&DirectFlag == 0 && dc.readahead != nil {
+		if start, size := dc.readahead.read(req.Path, req.Start, req.Size); size > 0 {
+			window := &Request{Type: ReadRequest, Timestamp: end, Path: req.Path, Start: start, Size: size}
+			dc.readahead.files[req.Path].ready = dc.readAhead(window)
+		}
+	}
+}
+
+// executeRequest applies the changes a request makes to the device context, and returns when it
+// finishes.
+func (dc *deviceContext) executeRequest(req *Request) time.Time {
+	// Cache hits don't touch the device, so leave its state, and any spare time, alone.
+	if dc.cacheHit(req) {
+		end, _ := dc.schedule(req, dc.computeCost(req))
+		if dc.pageCache != nil {
+			dc.pageCache.access(req.Path, req.Start, req.Size)
+		}
+		return end
 	}
 
-	dc.busyUntil = req.Timestamp.Add(dc.computeTime(req))
+	dc.writeBackSpareTime(req.Timestamp)
+	end := dc.occupy(req, dc.computeCost(req))
 
 	switch req.Type {
-	case MetadataRequest, AllocateRequest:
+	case MetadataRequest:
 		// Do nothing.
+	case AllocateRequest:
+		dc.moveHead(req)
 	case CloseRequest:
 		if dc.writeBackCache != nil {
+			if dc.deviceConfig.MediaType == slowfs.NetworkMedia {
+				dc.writeBackCache.writeBackFile(req.Path)
+			}
 			dc.writeBackCache.close(req.Path)
 		}
-		if dc.lastAccessedFile == req.Path {
-			dc.lastAccessedFile = ""
-			dc.firstUnseenByte = 0
+		if dc.readahead != nil {
+			dc.readahead.close(req.Path)
 		}
+		dc.streams.remove(req.Path)
 	case ReadRequest:
-		dc.lastAccessedFile = req.Path
-		dc.firstUnseenByte = req.Start + req.Size
+		dc.streams.access(req.Path, req.Start+req.Size)
+		dc.moveHead(req)
+		if dc.pageCache != nil && req.Flags&DirectFlag == 0 {
+			dc.pageCache.access(req.Path, req.Start, req.Size)
+		}
 	case WriteRequest:
-		switch dc.deviceConfig.WriteStrategy {
-		case slowfs.FastWrite:
-			// Fast writes don't affect things here.
-		case slowfs.SimulateWrite:
-			dc.lastAccessedFile = req.Path
-			dc.firstUnseenByte = req.Start + req.Size
+		if req.writesThrough() {
+			dc.streams.access(req.Path, req.Start+req.Size)
+			dc.moveHead(req)
+		} else {
+			switch dc.deviceConfig.WriteStrategy {
+			case slowfs.FastWrite:
+				// Fast writes don't affect things here.
+			case slowfs.SimulateWrite:
+				dc.streams.access(req.Path, req.Start+req.Size)
+				dc.moveHead(req)
+			}
 		}
 
-		if dc.writeBackCache != nil {
-			dc.writeBackCache.write(req.Path, req.Size)
+		if dc.writeBackCache != nil && !req.writesThrough() {
+			dc.writeBackCache.writeBackBytes(dc.writeBackCache.throttledBytes(req.Size))
+			dc.writeBackCache.write(req.Path, req.Size, req.Timestamp)
+		}
+		if dc.pageCache != nil && req.Flags&DirectFlag == 0 {
+			dc.pageCache.access(req.Path, req.Start, req.Size)
 		}
 	case FsyncRequest:
+		if dc.deviceConfig.FsyncStrategy == slowfs.JournaledFsync {
+			dc.writeBackCache.writeBackEntangled(req.Path)
+		} else if dc.writeBackCache != nil {
+			dc.writeBackCache.writeBackFile(req.Path)
+		}
+	case FdatasyncRequest:
 		if dc.writeBackCache != nil {
 			dc.writeBackCache.writeBackFile(req.Path)
 		}
+	case SyncFileRangeRequest:
+		if dc.writeBackCache != nil {
+			dc.writeBackCache.writeBackFileBytes(req.Path, req.Size)
+		}
+	case SyncfsRequest:
+		if dc.writeBackCache != nil {
+			dc.writeBackCache.writeBackAll()
+		}
+	case DirFsyncRequest:
+		// Directory entries aren't tracked, so there's nothing to write back.
 	default:
 		dc.logger.Printf("unknown request type for %+v\n", req)
 	}
+	return end
+}
+
+// readAhead reads the given window into memory in the background. It keeps the device busy, but
+// nothing waits for it. Returns when the window will have been read.
+func (dc *deviceContext) readAhead(window *Request) time.Time {
+	dc.writeBackSpareTime(window.Timestamp)
+	end := dc.occupy(window, requestCost{
+		access:   dc.computeSeekTime(window),
+		transfer: dc.deviceConfig.ReadTime(window.Size),
+		kind:     readTransfer,
+		bytes:    window.Size,
+	})
+	dc.streams.access(window.Path, window.Start+window.Size)
+	dc.moveHead(window)
+	if dc.pageCache != nil {
+		dc.pageCache.access(window.Path, window.Start, window.Size)
+	}
+	return end
+}
+
+// flushExpired runs the flusher for each time it would have woken up by the given time. Each time,
+// it writes back all data older than DirtyExpireInterval, oldest first.
+func (dc *deviceContext) flushExpired(t time.Time) {
+	wbc, expire := dc.writeBackCache, dc.deviceConfig.DirtyExpireInterval
+	if wbc == nil || expire == 0 {
+		return
+	}
+	interval := dc.deviceConfig.WritebackInterval()
+	if dc.nextFlush.IsZero() {
+		dc.nextFlush = t.Add(interval)
+	}
+
+	for !dc.nextFlush.After(t) {
+		oldest, ok := wbc.oldestDirtiedAt()
+		if !ok {
+			dc.nextFlush = nextWakeup(dc.nextFlush, t.Add(1), interval)
+			break
+		}
+		if due := oldest.Add(expire); dc.nextFlush.Before(due) {
+			// Skip straight to the first time there is anything to do.
+			dc.nextFlush = nextWakeup(dc.nextFlush, due, interval)
+			continue
+		}
+		dc.flush(dc.nextFlush, dc.nextFlush.Add(-expire))
+		dc.nextFlush = dc.nextFlush.Add(interval)
+	}
+}
+
+// flush writes back all data written before the given time, oldest first, with the device starting
+// on it at time at.
+func (dc *deviceContext) flush(at, before time.Time) {
+	dc.writeBackSpareTime(at)
+	wbc := dc.writeBackCache
+	writeBack := func(path string, numBytes units.NumBytes) {
+		req := &Request{Type: WriteRequest, Timestamp: at, Path: path, Size: numBytes}
+		dc.occupy(req, requestCost{
+			access:   dc.flushLatency(req),
+			transfer: dc.deviceConfig.WriteTime(numBytes),
+			kind:     writeTransfer,
+			bytes:    numBytes,
+		})
+	}
+	flushOrphaned := func(olderThan time.Time) {
+		if wbc.orphanedUnwrittenBytes > 0 && wbc.orphanedDirtiedAt.Before(olderThan) {
+			writeBack("", wbc.orphanedUnwrittenBytes)
+			wbc.orphanedUnwrittenBytes = 0
+		}
+	}
+
+	for _, path := range wbc.expired(before) {
+		flushOrphaned(wbc.dirtiedAt[path])
+		writeBack(path, wbc.getUnwrittenBytes(path))
+		wbc.writeBackFile(path)
+	}
+	flushOrphaned(before.Add(1))
+}
+
+// writeBackSpareTime devotes the time the device has been idle for until the given time to
+// writing back cache.
+func (dc *deviceContext) writeBackSpareTime(t time.Time) {
+	if spareTime := t.Sub(dc.busyUntil); spareTime > 0 && dc.writeBackCache != nil {
+		dc.writeBackCache.writeBack(spareTime)
+	}
+}
+
+// occupy records the device being busy with a request of the given cost, and returns when the
+// request finishes.
+func (dc *deviceContext) occupy(req *Request, cost requestCost) time.Time {
+	if dc.array != nil {
+		end := dc.array.run(req, cost, true)
+		if end.After(dc.busyUntil) {
+			dc.busyTime += end.Sub(latestTime(req.Timestamp, dc.busyUntil))
+			dc.busyUntil = end
+		}
+		return end
+	}
+
+	end, channel := dc.schedule(req, cost)
+	if start := end.Add(-cost.access - cost.transfer); end.After(dc.busyUntil) {
+		dc.busyTime += end.Sub(latestTime(start, dc.busyUntil))
+	}
+	if dc.deviceConfig.MediaType.UsesChannels() {
+		dc.channelBusyUntil[channel] = end
+		switch cost.kind {
+		case readTransfer:
+			dc.readBusyUntil = end
+		case writeTransfer:
+			dc.writeBusyUntil = end
+		}
+		dc.busyUntil = latestTime(dc.busyUntil, end)
+	} else {
+		dc.busyUntil = end
+	}
+	return end
 }
 
 func (dc *deviceContext) computeSeekTime(req *Request) time.Duration {
+	// Composite devices leave seeking to their members.
+	if dc.array != nil {
+		return 0
+	}
+
+	if dc.deviceConfig.MediaType == slowfs.NetworkMedia {
+		return dc.networkLatency(req)
+	}
+
+	// Solid state media don't seek, but pay a fixed latency for every request instead.
+	if dc.deviceConfig.MediaType == slowfs.SolidStateMedia {
+		if req.Type == ReadRequest {
+			return dc.duration(req, "ReadLatency", dc.deviceConfig.ReadLatency)
+		}
+		return dc.duration(req, "WriteLatency", dc.deviceConfig.WriteLatency)
+	}
+
+	if dc.needsSeek(req) {
+		if dc.deviceConfig.SeekModel == slowfs.DistanceSeek {
+			return distanceSeekTime(dc.deviceConfig,
+				dc.duration(req, "TrackToTrackSeekTime", dc.deviceConfig.TrackToTrackSeekTime),
+				dc.duration(req, "FullStrokeSeekTime", dc.deviceConfig.FullStrokeSeekTime),
+				dc.headPosition, diskPosition(dc.deviceConfig.DiskCapacity, req.Path, req.Start))
+		}
+		return dc.duration(req, "SeekTime", dc.deviceConfig.SeekTime)
+	}
+	return time.Duration(0)
+}
+
+func (dc *deviceContext) needsSeek(req *Request) bool {
 	// Seek if:
-	//   1. We're accessing a different file or an unseen one.
+	//   1. We're accessing a file we aren't tracking a stream through.
 	//   2. We're looking very far ahead compared to last access.
 	//   3. We're going backwards.
-	if dc.lastAccessedFile != req.Path || dc.firstUnseenByte > req.Start ||
-		req.Start-dc.firstUnseenByte >= dc.deviceConfig.SeekWindow {
-		return dc.deviceConfig.SeekTime
+	// Composite devices seek if any of the members they'd send the request to do.
+	if dc.array != nil {
+		return dc.array.needsSeek(req)
 	}
-	return time.Duration(0)
+	firstUnseenByte, ok := dc.streams.get(req.Path)
+	return !ok || firstUnseenByte > req.Start || req.Start-firstUnseenByte >= dc.deviceConfig.SeekWindow
+}
+
+// Seeks returns whether executing the given request would move the head of a rotational disk.
+func (dc *deviceContext) seeks(req *Request) bool {
+	if (dc.deviceConfig.MediaType.UsesChannels() && dc.array == nil) || dc.cacheHit(req) {
+		return false
+	}
+	switch req.Type {
+	case ReadRequest:
+		unread, _ := dc.unread(req)
+		return dc.needsSeek(unread)
+	case AllocateRequest:
+		return dc.needsSeek(req)
+	case WriteRequest:
+		return (dc.deviceConfig.WriteStrategy == slowfs.SimulateWrite || req.writesThrough()) && dc.needsSeek(req)
+	default:
+		return false
+	}
+}
+
+// cacheHit returns whether the given request is a read served entirely from memory, either from
+// the page cache or data that has been read ahead.
+func (dc *deviceContext) cacheHit(req *Request) bool {
+	if req.Type != ReadRequest || (dc.pageCache == nil && dc.readahead == nil) {
+		return false
+	}
+	_, missing := dc.unread(req)
+	return missing == 0
+}
+
+// unread returns the part of a read request that hasn't been read ahead, and how many of its
+// bytes aren't in the page cache either, so have to be read from the device.
+func (dc *deviceContext) unread(req *Request) (*Request, units.NumBytes) {
+	if req.Flags&DirectFlag != 0 {
+		return req, req.Size
+	}
+	if dc.readahead != nil {
+		req = dc.readahead.unread(req)
+	}
+	if dc.pageCache != nil {
+		return req, dc.pageCache.missingBytes(req.Path, req.Start, req.Size)
+	}
+	return req, req.Size
+}
+
+// dropCaches forgets everything in the page cache, along with anything read ahead.
+func (dc *deviceContext) dropCaches() {
+	dc.pageCache = newPageCache(dc.deviceConfig)
+	dc.readahead = newReadahead(dc.deviceConfig)
+}
+
+// moveHead records that the head is left at the end of the given request.
+func (dc *deviceContext) moveHead(req *Request) {
+	if dc.deviceConfig.SeekModel == slowfs.DistanceSeek {
+		dc.headPosition = diskPosition(dc.deviceConfig.DiskCapacity, req.Path, req.Start+req.Size)
+	}
+}
+
+// flushLatency returns the fixed cost of starting to flush data to the device: a seek for rotational
+// media, or the write latency for solid state media. Network media take a round trip to have the
+// server commit the data. Composite devices wait for their slowest member.
+func (dc *deviceContext) flushLatency(req *Request) time.Duration {
+	if dc.array != nil {
+		return dc.array.flushLatency(req)
+	}
+	switch dc.deviceConfig.MediaType {
+	case slowfs.SolidStateMedia:
+		return dc.duration(req, "WriteLatency", dc.deviceConfig.WriteLatency)
+	case slowfs.NetworkMedia:
+		return dc.duration(req, "RoundTripTime", dc.deviceConfig.RoundTripTime) +
+			dc.duration(req, "WriteLatency", dc.deviceConfig.WriteLatency)
+	}
+	return dc.duration(req, "SeekTime", dc.deviceConfig.SeekTime)
+}
+
+// nextWakeup returns the first time at or after until that is a whole number of intervals after
+// from.
+func nextWakeup(from, until time.Time, interval time.Duration) time.Time {
+	if !from.Before(until) {
+		return from
+	}
+	return from.Add((until.Sub(from) + interval - 1) / interval * interval)
 }
 
 func latestTime(a, b time.Time) time.Time {
@@ -160,3 +681,10 @@ func latestTime(a, b time.Time) time.Time {
 	}
 	return b
 }
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
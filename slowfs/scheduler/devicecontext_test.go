@@ -417,6 +417,596 @@ func TestDeviceContext_ComputeTimeAndExecute(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:         "solid state parallel reads",
+			deviceConfig: solidStateDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+					},
+					want: 30 * time.Millisecond, // Latency overlaps, but waits for read bandwidth.
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "c",
+						Start:     0,
+						Size:      1,
+					},
+					want: 40 * time.Millisecond, // Waits for the first channel to be free.
+				},
+			},
+		},
+		{
+			desc:         "solid state no seeks",
+			deviceConfig: solidStateDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     100,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(20 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "solid state separate read and write bandwidth",
+			deviceConfig: solidStateDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      10,
+					},
+					want: 110 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+					},
+					want: 15 * time.Millisecond,
+				},
+			},
+		},
+		{
+			// Paths are chosen so that "f14398" starts a quarter of the way into the disk,
+			// "f12842" at the start, and "f430" 900 bytes in.
+			desc:         "distance seek",
+			deviceConfig: distanceSeekDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "f14398",
+						Start:     0,
+						Size:      1,
+					},
+					want: 21 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(21 * time.Millisecond),
+						Path:      "f14398",
+						Start:     1,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(31 * time.Millisecond),
+						Path:      "f12842",
+						Start:     2,
+						Size:      1,
+					},
+					want: 21 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(52 * time.Millisecond),
+						Path:      "f430",
+						Start:     3,
+						Size:      1,
+					},
+					want: 19 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "page cache",
+			deviceConfig: pageCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      4,
+					},
+					want: 50 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      4,
+					},
+					want: 4 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(54 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      4,
+					},
+					want: 30 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(84 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(114 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      2,
+					},
+					want: 2 * time.Millisecond,
+				},
+				// Evicts the least recently used page, a's first.
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(116 * time.Millisecond),
+						Path:      "c",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(146 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "interleaved sequential reads with read-ahead",
+			deviceConfig: readaheadDeviceConfig,
+			requests: []requestInvocation{
+				// Reads ahead 4 bytes once finished, until 70ms.
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(200 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+				// Served from memory, and reads ahead 8 more bytes with a seek, until 492ms.
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(400 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      2,
+					},
+					want: 2 * time.Millisecond,
+				},
+				// Waits for the read-ahead to finish.
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(410 * time.Millisecond),
+						Path:      "a",
+						Start:     6,
+						Size:      2,
+					},
+					want: 84 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(600 * time.Millisecond),
+						Path:      "b",
+						Start:     2,
+						Size:      2,
+					},
+					want: 2 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "interleaved sequential reads with stream table",
+			deviceConfig: streamTableDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(20 * time.Millisecond),
+						Path:      "b",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(40 * time.Millisecond),
+						Path:      "a",
+						Start:     1,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(50 * time.Millisecond),
+						Path:      "b",
+						Start:     1,
+						Size:      1,
+					},
+					want: 10 * time.Millisecond,
+				},
+				// Forgets the stream through a.
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(60 * time.Millisecond),
+						Path:      "c",
+						Start:     0,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(80 * time.Millisecond),
+						Path:      "a",
+						Start:     2,
+						Size:      1,
+					},
+					want: 20 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "dirty throttling",
+			deviceConfig: dirtyThrottleDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     0,
+						Size:      10,
+					},
+					want: 0 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     10,
+						Size:      10,
+					},
+					want: 0 * time.Millisecond,
+				},
+				// Over the limit, so waits for 10 bytes to be written back.
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(0 * time.Millisecond),
+						Path:      "a",
+						Start:     20,
+						Size:      10,
+					},
+					want: 100 * time.Millisecond,
+				},
+				// Halfway to the limit, so waits for 2 bytes to be written back.
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime.Add(100 * time.Millisecond),
+						Path:      "a",
+						Start:     30,
+						Size:      5,
+					},
+					want: 20 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "journaled fsync",
+			deviceConfig: journaledDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "b",
+						Start:     0,
+						Size:      50,
+					},
+					want: 0,
+				},
+				// Writes back b's data too, then commits the journal.
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime,
+						Path:      "a",
+					},
+					want: 1*time.Second + 515*time.Millisecond,
+				},
+				// Nothing left to write back for b, so only its metadata is committed.
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime.Add(2 * time.Second),
+						Path:      "b",
+					},
+					want: 3 * time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "journaled syncs",
+			deviceConfig: journaledDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+					},
+					want: 0,
+				},
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "b",
+						Start:     0,
+						Size:      50,
+					},
+					want: 0,
+				},
+				// Doesn't commit the journal, so only writes back a.
+				{
+					req: &Request{
+						Type:      FdatasyncRequest,
+						Timestamp: startTime,
+						Path:      "a",
+					},
+					want: 1*time.Second + 10*time.Millisecond,
+				},
+				// Writes back 20 bytes of b, without flushing.
+				{
+					req: &Request{
+						Type:      SyncFileRangeRequest,
+						Timestamp: startTime,
+						Path:      "b",
+						Start:     0,
+						Size:      20,
+					},
+					want: 1*time.Second + 220*time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      DirFsyncRequest,
+						Timestamp: startTime,
+					},
+					want: 1*time.Second + 223*time.Millisecond,
+				},
+				// Writes back the rest of b and commits the journal.
+				{
+					req: &Request{
+						Type:      SyncfsRequest,
+						Timestamp: startTime,
+					},
+					want: 1*time.Second + 538*time.Millisecond,
+				},
+				// Nothing is left to write back.
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime,
+						Path:      "a",
+					},
+					want: 1*time.Second + 541*time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "O_SYNC and O_DSYNC writes",
+			deviceConfig: journaledDeviceConfig,
+			requests: []requestInvocation{
+				// Seeks, writes, flushes and commits the journal.
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      100,
+						Flags:     SyncFlag,
+					},
+					want: 1*time.Second + 25*time.Millisecond,
+				},
+				// Sequential, and doesn't commit the journal.
+				{
+					req: &Request{
+						Type:      WriteRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     100,
+						Size:      50,
+						Flags:     DataSyncFlag,
+					},
+					want: 1*time.Second + 535*time.Millisecond,
+				},
+				// Nothing went into the write back cache.
+				{
+					req: &Request{
+						Type:      FsyncRequest,
+						Timestamp: startTime,
+						Path:      "a",
+					},
+					want: 1*time.Second + 538*time.Millisecond,
+				},
+			},
+		},
+		{
+			desc:         "O_DIRECT reads",
+			deviceConfig: pageCacheDeviceConfig,
+			requests: []requestInvocation{
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime,
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+						Flags:     DirectFlag,
+					},
+					want: 30 * time.Millisecond,
+				},
+				// Bypasses the page cache.
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(1 * time.Second),
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+						Flags:     DirectFlag,
+					},
+					want: 30 * time.Millisecond,
+				},
+				// Direct reads didn't fill the page cache.
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(2 * time.Second),
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+					},
+					want: 30 * time.Millisecond,
+				},
+				{
+					req: &Request{
+						Type:      ReadRequest,
+						Timestamp: startTime.Add(3 * time.Second),
+						Path:      "a",
+						Start:     0,
+						Size:      2,
+					},
+					want: 2 * time.Millisecond,
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -429,3 +1019,23 @@ func TestDeviceContext_ComputeTimeAndExecute(t *testing.T) {
 		}
 	}
 }
+
+func TestNextWakeup(t *testing.T) {
+	cases := []struct {
+		from, until time.Duration
+		want        time.Duration
+	}{
+		{10, 5, 10},
+		{10, 10, 10},
+		{10, 11, 15},
+		{10, 15, 15},
+		{10, 16, 20},
+	}
+
+	for _, c := range cases {
+		got := nextWakeup(startTime.Add(c.from), startTime.Add(c.until), 5)
+		if want := startTime.Add(c.want); !got.Equal(want) {
+			t.Errorf("nextWakeup(%s, %s, 5ns) = %s, want %s", c.from, c.until, got.Sub(startTime), c.want)
+		}
+	}
+}
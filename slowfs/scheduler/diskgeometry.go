@@ -0,0 +1,73 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"hash/fnv"
+	"math"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// diskPosition maps an offset in a file to a simulated location on a disk of the given capacity.
+// Each file starts at a fixed location derived from its path, and is laid out contiguously from
+// there, wrapping around at the end of the disk.
+func diskPosition(capacity units.NumBytes, path string, offset units.NumBytes) units.NumBytes {
+	if capacity <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	base := units.NumBytes(h.Sum64() % uint64(capacity))
+	return (base + offset%capacity) % capacity
+}
+
+// notionalDiskCapacity is the size of the disk files are laid out on to order requests by position
+// when the device has no DiskCapacity. It is large enough that files practically never wrap.
+const notionalDiskCapacity = 1024 * units.Tebibyte
+
+// position returns where the given offset in a file is on the disk, for ordering requests by.
+func (dc *deviceContext) position(path string, offset units.NumBytes) units.NumBytes {
+	capacity := dc.deviceConfig.DiskCapacity
+	if capacity == 0 {
+		capacity = notionalDiskCapacity
+	}
+	return diskPosition(capacity, path, offset)
+}
+
+// distanceSeekTime computes how long it takes to move the head between two locations on the disk,
+// plus the rotational latency before the data comes under the head. Seek time grows with the
+// square root of the distance travelled, since the head accelerates for the first half of a seek
+// and decelerates for the second. trackToTrack and fullStroke are the shortest and longest seeks,
+// which may have been picked from the config's distributions.
+func distanceSeekTime(config *slowfs.DeviceConfig, trackToTrack, fullStroke time.Duration,
+	from, to units.NumBytes) time.Duration {
+	distance := to - from
+	if distance < 0 {
+		distance = -distance
+	}
+	if fullStroke < trackToTrack {
+		fullStroke = trackToTrack
+	}
+
+	var seekTime time.Duration
+	if distance > 0 && config.DiskCapacity > 0 {
+		fraction := math.Sqrt(float64(distance) / float64(config.DiskCapacity))
+		seekTime = trackToTrack + time.Duration(fraction*float64(fullStroke-trackToTrack))
+	}
+
+	return seekTime + config.RotationalLatency()
+}
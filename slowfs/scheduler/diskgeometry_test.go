@@ -0,0 +1,65 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestDiskPosition(t *testing.T) {
+	cases := []struct {
+		capacity units.NumBytes
+		path     string
+		offset   units.NumBytes
+		want     units.NumBytes
+	}{
+		{0, "f12842", 0, 0},
+		{10000, "f12842", 0, 0},
+		{10000, "f12842", 5, 5},
+		{10000, "f14398", 0, 2500},
+		{10000, "f14398", 10000, 2500},
+		{10000, "f14001", 0, 9999},
+		{10000, "f14001", 1, 0},
+	}
+
+	for _, c := range cases {
+		if got, want := diskPosition(c.capacity, c.path, c.offset), c.want; got != want {
+			t.Errorf("diskPosition(%d, %s, %d) = %d, want %d", c.capacity, c.path, c.offset, got, want)
+		}
+	}
+}
+
+func TestDistanceSeekTime(t *testing.T) {
+	cases := []struct {
+		from units.NumBytes
+		to   units.NumBytes
+		want time.Duration
+	}{
+		{0, 0, 5 * time.Millisecond},
+		{0, 10000, 16 * time.Millisecond},
+		{0, 2500, 11 * time.Millisecond},
+		{2500, 0, 11 * time.Millisecond},
+		{1000, 1900, 9 * time.Millisecond},
+	}
+
+	for _, c := range cases {
+		if got, want := distanceSeekTime(distanceSeekDeviceConfig, distanceSeekDeviceConfig.TrackToTrackSeekTime,
+			distanceSeekDeviceConfig.FullStrokeSeekTime, c.from, c.to), c.want; got != want {
+			t.Errorf("distanceSeekTime(%d, %d) = %s, want %s", c.from, c.to, got, want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"time"
+)
+
+// ioLimiter holds back reads and writes from processes that have used up what their I/O limits
+// allow, like blk-throttle. Each request reserves its share of its group's bandwidth and IOPS when
+// it arrives, and is released once the requests reserved before it would have used them up.
+type ioLimiter struct {
+	// The limits the groups were created for, so they can be forgotten if the limits change.
+	limits string
+	// State for the processes matched by each IOLimit, by index.
+	groups map[int]*ioGroup
+}
+
+// ioGroup tracks when a group of processes may next read or write.
+type ioGroup struct {
+	// When the bandwidth reserved so far will have been used up.
+	readBytesFree, writeBytesFree time.Time
+	// When the IOPS reserved so far will have been used up.
+	readOpsFree, writeOpsFree time.Time
+}
+
+func newIOLimiter() *ioLimiter {
+	return &ioLimiter{groups: make(map[int]*ioGroup)}
+}
+
+// reserve reserves bandwidth and IOPS for a read or write under the given limits, and returns when
+// the request may be sent to the device. This is never before the request arrived.
+func (l *ioLimiter) reserve(limits slowfs.IOLimits, req *Request) time.Time {
+	if len(limits) == 0 {
+		return req.Timestamp
+	}
+	if s := limits.String(); s != l.limits {
+		l.limits, l.groups = s, make(map[int]*ioGroup)
+	}
+	limit, idx := limits.Match(req.Uid, req.Gid, req.Process)
+	if limit == nil {
+		return req.Timestamp
+	}
+	group := l.groups[idx]
+	if group == nil {
+		group = &ioGroup{}
+		l.groups[idx] = group
+	}
+
+	bytesFree, opsFree := &group.readBytesFree, &group.readOpsFree
+	transferTime, iops := limit.ReadTime(req.Size), limit.ReadIOPS
+	if req.Type == WriteRequest {
+		bytesFree, opsFree = &group.writeBytesFree, &group.writeOpsFree
+		transferTime, iops = limit.WriteTime(req.Size), limit.WriteIOPS
+	}
+
+	// Unlimited bandwidth or IOPS leave the times they are free at zero.
+	release := latestTime(req.Timestamp, latestTime(*bytesFree, *opsFree))
+	if transferTime != 0 {
+		*bytesFree = release.Add(transferTime)
+	}
+	if iops != 0 {
+		*opsFree = release.Add(time.Second / time.Duration(iops))
+	}
+	return release
+}
@@ -0,0 +1,236 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"math"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// ioPolicy decides the order queued reads and writes are sent to the device in.
+type ioPolicy interface {
+	// insert returns where in the queue a newly arrived request should go.
+	insert(queue []*requestData, data *requestData) int
+	// next returns the index of the request in the non-empty queue to send to the device next.
+	next(queue []*requestData, now time.Time) int
+	// dispatched is told about every request taken off the queue.
+	dispatched(req *Request)
+}
+
+func newIOPolicy(dc *deviceContext) ioPolicy {
+	switch dc.deviceConfig.IOScheduler {
+	case slowfs.NoopIOScheduler:
+		return noopPolicy{}
+	case slowfs.DeadlineIOScheduler:
+		return &deadlinePolicy{elevatorPolicy{dc: dc}}
+	case slowfs.ElevatorIOScheduler:
+		return &elevatorPolicy{dc: dc}
+	case slowfs.FairIOScheduler:
+		return &fairPolicy{dc: dc, served: make(map[uint32]units.NumBytes)}
+	default:
+		return &reorderPolicy{dc: dc}
+	}
+}
+
+// reorderPolicy inserts requests next to others they would be sequential with, as long as they
+// arrived soon enough after them.
+type reorderPolicy struct {
+	dc *deviceContext
+}
+
+func (p *reorderPolicy) insert(queue []*requestData, data *requestData) int {
+	req := data.req
+	reqByteEnd := req.Start + req.Size
+	var bestDiff units.NumBytes = math.MaxInt64
+	bestIdx := len(queue)
+	reachedFront := true
+	for i := len(queue) - 1; i >= 0; i-- {
+		otherReq := queue[i].req
+
+		otherReqByteEnd := otherReq.Start + otherReq.Size
+		if otherReq.Path == req.Path && req.Start >= otherReqByteEnd {
+			// Place after request other.
+			diff := req.Start - otherReqByteEnd
+			if diff < bestDiff {
+				bestDiff = diff
+				bestIdx = i + 1
+			}
+		}
+
+		// Don't insert before a request that was made really early.
+		if req.Timestamp.After(otherReq.Timestamp.Add(p.dc.deviceConfig.RequestReorderMaxDelay)) {
+			reachedFront = false
+			break
+		}
+
+		if otherReq.Path == req.Path && reqByteEnd <= otherReq.Start {
+			// Place before request other.
+			diff := otherReq.Start - reqByteEnd
+			if diff < bestDiff {
+				bestDiff = diff
+				bestIdx = i
+			}
+		}
+	}
+	// Continuing a stream the device is tracking is as good as following a request on the front of
+	// the queue.
+	firstUnseenByte, tracked := p.dc.streams.get(req.Path)
+	if tracked && reachedFront && req.Start >= firstUnseenByte && req.Start-firstUnseenByte < bestDiff {
+		bestIdx = 0
+	}
+	return bestIdx
+}
+
+func (p *reorderPolicy) next(queue []*requestData, now time.Time) int {
+	return 0
+}
+
+func (p *reorderPolicy) dispatched(req *Request) {}
+
+// noopPolicy sends requests in the order they arrive.
+type noopPolicy struct{}
+
+func (noopPolicy) insert(queue []*requestData, data *requestData) int {
+	return len(queue)
+}
+
+func (noopPolicy) next(queue []*requestData, now time.Time) int {
+	return 0
+}
+
+func (noopPolicy) dispatched(req *Request) {}
+
+// elevatorPolicy keeps requests in the order they arrive, but sends them in order of their position
+// on the disk: the nearest one at or after the end of the last request sent, or if there are none,
+// the one closest to the start of the disk.
+type elevatorPolicy struct {
+	dc   *deviceContext
+	head units.NumBytes
+}
+
+func (p *elevatorPolicy) insert(queue []*requestData, data *requestData) int {
+	return len(queue)
+}
+
+func (p *elevatorPolicy) next(queue []*requestData, now time.Time) int {
+	return p.nearest(queue, func(*Request) bool { return true })
+}
+
+// nearest returns the index of the next request matching include in C-LOOK order, or -1 if there
+// are none.
+func (p *elevatorPolicy) nearest(queue []*requestData, include func(*Request) bool) int {
+	ahead, lowest := -1, -1
+	var aheadPos, lowestPos units.NumBytes
+	for i, data := range queue {
+		if !include(data.req) {
+			continue
+		}
+		pos := p.dc.position(data.req.Path, data.req.Start)
+		if pos >= p.head && (ahead == -1 || pos < aheadPos) {
+			ahead, aheadPos = i, pos
+		}
+		if lowest == -1 || pos < lowestPos {
+			lowest, lowestPos = i, pos
+		}
+	}
+	if ahead != -1 {
+		return ahead
+	}
+	return lowest
+}
+
+func (p *elevatorPolicy) dispatched(req *Request) {
+	p.head = p.dc.position(req.Path, req.Start+req.Size)
+}
+
+// deadlinePolicy sends the oldest read or write once it has waited too long, and otherwise sends
+// reads ahead of writes, each in elevator order.
+type deadlinePolicy struct {
+	elevatorPolicy
+}
+
+func (p *deadlinePolicy) next(queue []*requestData, now time.Time) int {
+	// The queue is in arrival order, so the first read and write are the oldest.
+	oldestRead, oldestWrite := -1, -1
+	for i, data := range queue {
+		if data.req.Type == ReadRequest && oldestRead == -1 {
+			oldestRead = i
+		} else if data.req.Type == WriteRequest && oldestWrite == -1 {
+			oldestWrite = i
+		}
+	}
+	config := p.dc.deviceConfig
+	if oldestRead != -1 && !now.Before(queue[oldestRead].req.Timestamp.Add(config.ReadExpire())) {
+		return oldestRead
+	}
+	if oldestWrite != -1 && !now.Before(queue[oldestWrite].req.Timestamp.Add(config.WriteExpire())) {
+		return oldestWrite
+	}
+	if oldestRead != -1 {
+		return p.nearest(queue, func(req *Request) bool { return req.Type == ReadRequest })
+	}
+	return p.nearest(queue, func(*Request) bool { return true })
+}
+
+// fairPolicy shares the device between processes by the number of bytes transferred for each,
+// scaled by the weight the device's I/O limits give them. It next sends the oldest request from
+// whichever process with requests waiting has been served the least.
+type fairPolicy struct {
+	dc *deviceContext
+	// Weighted bytes transferred for each process that has sent requests.
+	served map[uint32]units.NumBytes
+}
+
+func (p *fairPolicy) insert(queue []*requestData, data *requestData) int {
+	pid := data.req.Pid
+	// A process that has been idle only gets credit from the point it starts waiting again, so it
+	// can't then shut out the processes that kept the device busy meanwhile.
+	waiting := make(map[uint32]bool)
+	for _, other := range queue {
+		waiting[other.req.Pid] = true
+	}
+	if !waiting[pid] {
+		least, found := units.NumBytes(0), false
+		for other := range waiting {
+			if served := p.served[other]; !found || served < least {
+				least, found = served, true
+			}
+		}
+		if p.served[pid] < least {
+			p.served[pid] = least
+		}
+	}
+	return len(queue)
+}
+
+func (p *fairPolicy) next(queue []*requestData, now time.Time) int {
+	best := 0
+	for i, data := range queue {
+		if p.served[data.req.Pid] < p.served[queue[best].req.Pid] {
+			best = i
+		}
+	}
+	return best
+}
+
+func (p *fairPolicy) dispatched(req *Request) {
+	weight := slowfs.DefaultIOWeight
+	if limit, _ := p.dc.deviceConfig.IOLimits.Match(req.Uid, req.Gid, req.Process); limit != nil {
+		weight = limit.IOWeight()
+	}
+	p.served[req.Pid] += req.Size * units.NumBytes(slowfs.DefaultIOWeight) / units.NumBytes(weight)
+}
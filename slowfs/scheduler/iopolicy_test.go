@@ -0,0 +1,138 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+// policyOp either pushes a request, or pops requests at the given time until the queue is empty.
+type policyOp struct {
+	push *Request
+	pop  time.Duration
+}
+
+func runPolicyOps(config *slowfs.DeviceConfig, ops []policyOp) []string {
+	rwq := newReadWriteQueue(newDeviceContext(config), clock.RealClock{})
+	var got []string
+	for _, op := range ops {
+		if op.push != nil {
+			rwq.push(&requestData{op.push, nil})
+			continue
+		}
+		for len(rwq.queue) > 0 {
+			data, _ := rwq.pop(startTime.Add(op.pop))
+			if data == nil {
+				got = append(got, "not ready")
+				break
+			}
+			got = append(got, fmt.Sprintf("%s%d@%d", data.req.Type, data.req.Pid, data.req.Start))
+		}
+	}
+	return got
+}
+
+func TestIOPolicies(t *testing.T) {
+	withIOScheduler := func(s slowfs.IOScheduler) *slowfs.DeviceConfig {
+		config := *basicDeviceConfig
+		config.IOScheduler = s
+		config.DeadlineReadExpire = 10 * time.Second
+		config.DeadlineWriteExpire = 20 * time.Second
+		return &config
+	}
+	read := func(at time.Duration, start int64) policyOp {
+		return policyOp{push: &Request{Type: ReadRequest, Timestamp: startTime.Add(at), Path: "a", Start: units.NumBytes(start), Size: 1}}
+	}
+	write := func(at time.Duration, start int64) policyOp {
+		return policyOp{push: &Request{Type: WriteRequest, Timestamp: startTime.Add(at), Path: "a", Start: units.NumBytes(start), Size: 1}}
+	}
+	process := func(pid uint32) policyOp {
+		return policyOp{push: &Request{Type: ReadRequest, Timestamp: startTime, Path: fmt.Sprint(pid), Size: 10, Caller: Caller{Pid: pid, Uid: pid}}}
+	}
+	pop := func(at time.Duration) policyOp {
+		return policyOp{pop: at}
+	}
+	weighted := withIOScheduler(slowfs.FairIOScheduler)
+	weighted.IOLimits = slowfs.IOLimits{{Match: "uid", Value: "1", Weight: 300}}
+
+	cases := []struct {
+		desc   string
+		config *slowfs.DeviceConfig
+		ops    []policyOp
+		want   []string
+	}{
+		{
+			desc:   "noop keeps arrival order",
+			config: withIOScheduler(slowfs.NoopIOScheduler),
+			ops:    []policyOp{read(0, 50), read(0, 10), read(0, 51), pop(time.Second)},
+			want:   []string{"read0@50", "read0@10", "read0@51"},
+		},
+		{
+			desc:   "elevator sweeps up then jumps back",
+			config: withIOScheduler(slowfs.ElevatorIOScheduler),
+			ops: []policyOp{
+				read(0, 50), read(0, 10), write(0, 30), pop(time.Second),
+				read(time.Second, 40), read(time.Second, 5), read(time.Second, 60), pop(2 * time.Second),
+			},
+			want: []string{"read0@10", "write0@30", "read0@50", "read0@60", "read0@5", "read0@40"},
+		},
+		{
+			desc:   "deadline sends reads first",
+			config: withIOScheduler(slowfs.DeadlineIOScheduler),
+			ops:    []policyOp{write(0, 0), read(0, 50), read(0, 10), pop(time.Second)},
+			want:   []string{"read0@10", "read0@50", "write0@0"},
+		},
+		{
+			desc:   "deadline sends expired writes first",
+			config: withIOScheduler(slowfs.DeadlineIOScheduler),
+			ops:    []policyOp{write(0, 0), read(20*time.Second, 10), pop(25 * time.Second)},
+			want:   []string{"write0@0", "read0@10"},
+		},
+		{
+			desc:   "fair alternates between processes",
+			config: withIOScheduler(slowfs.FairIOScheduler),
+			ops:    []policyOp{process(1), process(1), process(1), process(2), pop(time.Second)},
+			want:   []string{"read1@0", "read2@0", "read1@0", "read1@0"},
+		},
+		{
+			desc:   "fair doesn't credit idle processes",
+			config: withIOScheduler(slowfs.FairIOScheduler),
+			ops: []policyOp{
+				process(1), process(1), pop(time.Second), process(1), process(3), pop(2 * time.Second),
+			},
+			want: []string{"read1@0", "read1@0", "read1@0", "read3@0"},
+		},
+		{
+			desc:   "fair shares by weight",
+			config: weighted,
+			ops: []policyOp{
+				process(1), process(1), process(1), process(1), process(2), process(2), pop(time.Second),
+			},
+			want: []string{"read1@0", "read2@0", "read1@0", "read1@0", "read1@0", "read2@0"},
+		},
+	}
+
+	for _, c := range cases {
+		if got := runPolicyOps(c.config, c.ops); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("fail (%s) sent %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// networkLatency returns the fixed time a read or write to network media takes: the server's
+// latency, plus a round trip for each window of data transferred.
+func (dc *deviceContext) networkLatency(req *Request) time.Duration {
+	latency := dc.duration(req, "WriteLatency", dc.deviceConfig.WriteLatency)
+	if req.Type == ReadRequest {
+		latency = dc.duration(req, "ReadLatency", dc.deviceConfig.ReadLatency)
+	}
+	return latency + dc.roundTripTime(req, networkRoundTrips(dc.deviceConfig, req.Size))
+}
+
+// computeNetworkMetadataCost computes how long a metadata request or close occupies network media.
+// Every metadata operation, like a lookup or getattr, takes a round trip to the server. With
+// close-to-open consistency, closing a file also writes back its dirty data and has the server
+// commit it.
+func (dc *deviceContext) computeNetworkMetadataCost(req *Request) requestCost {
+	cost := requestCost{access: dc.duration(req, "MetadataOpTime", dc.deviceConfig.MetadataOpTime) + dc.roundTripTime(req, 1)}
+	if req.Type != CloseRequest || dc.writeBackCache == nil {
+		return cost
+	}
+	if bytes := dc.writeBackCache.getUnwrittenBytes(req.Path); bytes > 0 {
+		cost.access += dc.flushLatency(req)
+		cost.transfer, cost.kind, cost.bytes = dc.deviceConfig.WriteTime(bytes), writeTransfer, bytes
+	}
+	return cost
+}
+
+// roundTripTime returns how long the given number of round trips to the server take for a request,
+// including jitter.
+func (dc *deviceContext) roundTripTime(req *Request, trips int64) time.Duration {
+	return time.Duration(trips)*dc.duration(req, "RoundTripTime", dc.deviceConfig.RoundTripTime) + dc.jitter(req)
+}
+
+// networkRoundTrips returns how many round trips transferring numBytes takes, waiting for each
+// window of data to be acknowledged before sending the next.
+func networkRoundTrips(config *slowfs.DeviceConfig, numBytes units.NumBytes) int64 {
+	if config.NetworkWindow == 0 || numBytes <= config.NetworkWindow {
+		return 1
+	}
+	return int64((numBytes + config.NetworkWindow - 1) / config.NetworkWindow)
+}
+
+// jitter picks how much longer than usual a request's round trips take: up to RoundTripJitter, or a
+// value picked from its distribution if it has one.
+func (dc *deviceContext) jitter(req *Request) time.Duration {
+	if _, ok := dc.deviceConfig.Distributions["RoundTripJitter"]; ok {
+		return dc.duration(req, "RoundTripJitter", dc.deviceConfig.RoundTripJitter)
+	}
+	return time.Duration(dc.random(req, "RoundTripJitter") * float64(dc.deviceConfig.RoundTripJitter))
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestDeviceContext_Network(t *testing.T) {
+	type requestInvocation struct {
+		at   time.Duration
+		req  *Request
+		want time.Duration
+	}
+
+	cases := []struct {
+		desc     string
+		requests []requestInvocation
+	}{
+		{
+			desc: "read within the window takes one round trip",
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 31 * time.Millisecond},
+			},
+		},
+		{
+			desc: "each extra window takes another round trip",
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 6}, want: 91 * time.Millisecond},
+			},
+		},
+		{
+			desc: "requests are in flight in parallel, sharing bandwidth",
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 2}, want: 31 * time.Millisecond},
+				{at: 0, req: &Request{Type: ReadRequest, Path: "b", Start: 0, Size: 2}, want: 51 * time.Millisecond},
+				// Waits for a channel.
+				{at: 0, req: &Request{Type: MetadataRequest, Path: "c"}, want: 46 * time.Millisecond},
+			},
+		},
+		{
+			desc: "metadata takes a round trip",
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: MetadataRequest, Path: "a"}, want: 15 * time.Millisecond},
+			},
+		},
+		{
+			desc: "close writes back and commits dirty data",
+			requests: []requestInvocation{
+				{at: 0, req: &Request{Type: WriteRequest, Path: "a", Start: 0, Size: 4}, want: 0},
+				{at: 0, req: &Request{Type: CloseRequest, Path: "a"}, want: 67 * time.Millisecond},
+				{at: time.Second, req: &Request{Type: FsyncRequest, Path: "a"}, want: 12 * time.Millisecond},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		dc := newDeviceContext(networkDeviceConfig)
+		for _, req := range c.requests {
+			req.req.Timestamp = startTime.Add(req.at)
+			if got, want := dc.computeTime(req.req), req.want; got != want {
+				t.Errorf("fail (%s) computeTime(%+v) = %s, want %s", c.desc, req.req, got, want)
+			}
+			dc.execute(req.req)
+		}
+	}
+}
+
+func TestDeviceContext_Jitter(t *testing.T) {
+	req := &Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 2}
+	config := *networkDeviceConfig
+	config.RoundTripJitter = time.Millisecond
+	dc := newDeviceContext(&config)
+	jitter := dc.jitter(req)
+	if jitter < 0 || jitter >= time.Millisecond {
+		t.Errorf("jitter(%+v) = %s, want within [0, 1ms)", req, jitter)
+	}
+	if got := dc.jitter(req); got != jitter {
+		t.Errorf("jitter(%+v) = %s then %s, want the same", req, jitter, got)
+	}
+	if got, want := dc.computeTime(req), 31*time.Millisecond+jitter; got != want {
+		t.Errorf("computeTime(%+v) = %s, want %s", req, got, want)
+	}
+
+	config.RoundTripJitter = 0
+	if got := newDeviceContext(&config).jitter(req); got != 0 {
+		t.Errorf("jitter(%+v) without RoundTripJitter = %s, want 0", req, got)
+	}
+}
+
+func TestNetworkRoundTrips(t *testing.T) {
+	cases := []struct {
+		window   int64
+		numBytes int64
+		want     int64
+	}{
+		{0, 100, 1},
+		{2, 0, 1},
+		{2, 2, 1},
+		{2, 3, 2},
+		{2, 6, 3},
+	}
+
+	for _, c := range cases {
+		config := &slowfs.DeviceConfig{NetworkWindow: units.NumBytes(c.window)}
+		if got := networkRoundTrips(config, units.NumBytes(c.numBytes)); got != c.want {
+			t.Errorf("networkRoundTrips(window %d, %d) = %d, want %d", c.window, c.numBytes, got, c.want)
+		}
+	}
+}
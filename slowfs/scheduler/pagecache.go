@@ -0,0 +1,213 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"container/list"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+)
+
+type pageKey struct {
+	path string
+	page int64
+}
+
+// pageList is an ordered set of pages, from most to least recently added.
+type pageList struct {
+	order    *list.List
+	elements map[pageKey]*list.Element
+}
+
+func newPageList() *pageList {
+	return &pageList{
+		order:    list.New(),
+		elements: make(map[pageKey]*list.Element),
+	}
+}
+
+func (pl *pageList) contains(key pageKey) bool {
+	_, ok := pl.elements[key]
+	return ok
+}
+
+func (pl *pageList) len() int {
+	return len(pl.elements)
+}
+
+// pushFront adds key to the front of the list, or moves it there if already present.
+func (pl *pageList) pushFront(key pageKey) {
+	if e, ok := pl.elements[key]; ok {
+		pl.order.MoveToFront(e)
+		return
+	}
+	pl.elements[key] = pl.order.PushFront(key)
+}
+
+func (pl *pageList) remove(key pageKey) {
+	if e, ok := pl.elements[key]; ok {
+		pl.order.Remove(e)
+		delete(pl.elements, key)
+	}
+}
+
+// popBack removes and returns the page at the back of the list.
+func (pl *pageList) popBack() pageKey {
+	key := pl.order.Remove(pl.order.Back()).(pageKey)
+	delete(pl.elements, key)
+	return key
+}
+
+// pageSet is a bounded set of cached pages, which decides which page to evict when full.
+type pageSet interface {
+	// contains returns whether the page is cached, without counting as an access.
+	contains(key pageKey) bool
+	// access records a read or write of the page, caching it and evicting another page if full.
+	access(key pageKey)
+}
+
+// lruPageSet evicts the least recently used page.
+type lruPageSet struct {
+	capacity int
+	pages    *pageList
+}
+
+func (s *lruPageSet) contains(key pageKey) bool {
+	return s.pages.contains(key)
+}
+
+func (s *lruPageSet) access(key pageKey) {
+	s.pages.pushFront(key)
+	if s.pages.len() > s.capacity {
+		s.pages.popBack()
+	}
+}
+
+// twoQueuePageSet evicts using the full 2Q algorithm from "2Q: A Low Overhead High Performance
+// Buffer Management Replacement Algorithm" (Johnson and Shasha, 1994).
+type twoQueuePageSet struct {
+	capacity int
+	// Pages accessed once recently, in FIFO order, and how many to keep there before evicting.
+	in         *pageList
+	inCapacity int
+	// Pages recently evicted from in, which are no longer cached. Only remembering them lets us
+	// spot pages that are accessed again.
+	out         *pageList
+	outCapacity int
+	// Hot pages, in LRU order.
+	hot *pageList
+}
+
+func newTwoQueuePageSet(capacity int) *twoQueuePageSet {
+	return &twoQueuePageSet{
+		capacity:    capacity,
+		in:          newPageList(),
+		inCapacity:  maxInt(capacity/4, 1),
+		out:         newPageList(),
+		outCapacity: maxInt(capacity/2, 1),
+		hot:         newPageList(),
+	}
+}
+
+func (s *twoQueuePageSet) contains(key pageKey) bool {
+	return s.in.contains(key) || s.hot.contains(key)
+}
+
+func (s *twoQueuePageSet) access(key pageKey) {
+	switch {
+	case s.hot.contains(key):
+		s.hot.pushFront(key)
+	case s.in.contains(key):
+		// Pages stay in FIFO order however often they are accessed while in the in queue.
+	case s.out.contains(key):
+		s.out.remove(key)
+		s.makeRoom()
+		s.hot.pushFront(key)
+	default:
+		s.makeRoom()
+		s.in.pushFront(key)
+	}
+}
+
+func (s *twoQueuePageSet) makeRoom() {
+	if s.in.len()+s.hot.len() < s.capacity {
+		return
+	}
+	if s.in.len() > s.inCapacity || s.hot.len() == 0 {
+		s.out.pushFront(s.in.popBack())
+		if s.out.len() > s.outCapacity {
+			s.out.popBack()
+		}
+		return
+	}
+	s.hot.popBack()
+}
+
+// pageCache models the operating system's cache of file data in memory.
+type pageCache struct {
+	pageSize units.NumBytes
+	pages    pageSet
+}
+
+// newPageCache creates a page cache as described by config, or returns nil if config doesn't use
+// one.
+func newPageCache(config *slowfs.DeviceConfig) *pageCache {
+	if config.PageCacheSize == 0 {
+		return nil
+	}
+
+	pageSize := config.CachePageSize()
+	capacity := maxInt(int(config.PageCacheSize/pageSize), 1)
+	var pages pageSet
+	switch config.PageCacheEviction {
+	case slowfs.TwoQueueEviction:
+		pages = newTwoQueuePageSet(capacity)
+	default:
+		pages = &lruPageSet{capacity: capacity, pages: newPageList()}
+	}
+	return &pageCache{
+		pageSize: pageSize,
+		pages:    pages,
+	}
+}
+
+// missingBytes returns how many of the size bytes at start in the file at path aren't cached.
+func (pc *pageCache) missingBytes(path string, start, size units.NumBytes) units.NumBytes {
+	var missing units.NumBytes
+	end := start + size
+	for page := start / pc.pageSize; page*pc.pageSize < end; page++ {
+		if pc.pages.contains(pageKey{path, int64(page)}) {
+			continue
+		}
+		pageStart := page * pc.pageSize
+		pageEnd := pageStart + pc.pageSize
+		if pageStart < start {
+			pageStart = start
+		}
+		if pageEnd > end {
+			pageEnd = end
+		}
+		missing += pageEnd - pageStart
+	}
+	return missing
+}
+
+// access records that the size bytes at start in the file at path have been read or written,
+// caching them.
+func (pc *pageCache) access(path string, start, size units.NumBytes) {
+	for page := start / pc.pageSize; page*pc.pageSize < start+size; page++ {
+		pc.pages.access(pageKey{path, int64(page)})
+	}
+}
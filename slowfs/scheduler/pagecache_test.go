@@ -0,0 +1,83 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestPageCache_MissingBytes(t *testing.T) {
+	pc := newPageCache(pageCacheDeviceConfig)
+	pc.access("a", 2, 3)
+
+	cases := []struct {
+		path        string
+		start, size units.NumBytes
+		want        units.NumBytes
+	}{
+		{"a", 2, 4, 0},
+		{"a", 3, 1, 0},
+		{"a", 0, 4, 2},
+		{"a", 1, 6, 2},
+		{"a", 5, 3, 2},
+		{"a", 6, 0, 0},
+		{"b", 2, 4, 4},
+	}
+
+	for _, c := range cases {
+		if got, want := pc.missingBytes(c.path, c.start, c.size), c.want; got != want {
+			t.Errorf("missingBytes(%s, %d, %d) = %d, want %d", c.path, c.start, c.size, got, want)
+		}
+	}
+}
+
+func TestPageSet_Access(t *testing.T) {
+	cases := []struct {
+		desc     string
+		eviction slowfs.EvictionPolicy
+		accesses []int64
+		want     []int64
+	}{
+		{"lru fills", slowfs.LRUEviction, []int64{0, 1, 2, 3}, []int64{0, 1, 2, 3}},
+		{"lru evicts least recent", slowfs.LRUEviction, []int64{0, 1, 2, 3, 0, 4}, []int64{0, 2, 3, 4}},
+		{"lru scan evicts hot pages", slowfs.LRUEviction, []int64{0, 0, 1, 1, 2, 3, 4, 5}, []int64{2, 3, 4, 5}},
+		{"2q fills", slowfs.TwoQueueEviction, []int64{0, 1, 2, 3}, []int64{0, 1, 2, 3}},
+		{"2q evicts first in", slowfs.TwoQueueEviction, []int64{0, 1, 2, 3, 4}, []int64{1, 2, 3, 4}},
+		// 0 and 1 are accessed again after being evicted, so become hot and survive the scan.
+		{"2q scan keeps hot pages", slowfs.TwoQueueEviction, []int64{0, 1, 2, 3, 4, 5, 0, 1, 6, 7, 8, 9}, []int64{0, 1, 8, 9}},
+	}
+
+	for _, c := range cases {
+		config := *pageCacheDeviceConfig
+		config.PageCacheEviction = c.eviction
+		pc := newPageCache(&config)
+		for _, page := range c.accesses {
+			pc.pages.access(pageKey{"a", page})
+		}
+
+		var got []int64
+		for page := int64(0); page < 10; page++ {
+			if pc.pages.contains(pageKey{"a", page}) {
+				got = append(got, page)
+			}
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("fail (%s) cached pages = %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
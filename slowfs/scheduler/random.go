@@ -0,0 +1,49 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// random returns a number between 0 and 1 picked at random for the given use by a request. It's
+// derived from a hash of the request, the use and the device's RandomSeed, so computing how long
+// the same request takes again gives the same answer, and runs with the same seed pick the same
+// numbers.
+func (dc *deviceContext) random(req *Request, use string) float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d %s %d %s %d %d %d", dc.deviceConfig.RandomSeed, use, req.Type, req.Path, req.Start,
+		req.Size, req.Timestamp.UnixNano())
+	// FNV barely mixes the last bytes hashed into the high bits, so finish with MurmurHash3's mixer.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return float64(x>>11) / (1 << 53)
+}
+
+// duration returns the value of the named duration field of the device config for a request: the
+// field itself, or if it's a distribution, a value picked from it at random.
+func (dc *deviceContext) duration(req *Request, field string, value time.Duration) time.Duration {
+	d, ok := dc.deviceConfig.Distributions[field]
+	if !ok {
+		return value
+	}
+	return d.Quantile(dc.random(req, field))
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"slowfs/slowfs"
+	"testing"
+	"time"
+)
+
+func TestDeviceContext_Distributions(t *testing.T) {
+	config := *basicDeviceConfig
+	if err := config.SetField("MetadataOpTime", "uniform(50ms,150ms)"); err != nil {
+		t.Fatalf("SetField(MetadataOpTime, uniform(50ms,150ms)) error: %s", err)
+	}
+	reseeded := config
+	reseeded.RandomSeed = 1
+
+	times := func(config *slowfs.DeviceConfig) []time.Duration {
+		dc := newDeviceContext(config)
+		var got []time.Duration
+		for i := 0; i < 20; i++ {
+			req := &Request{Type: MetadataRequest, Timestamp: startTime, Path: fmt.Sprintf("f%d", i)}
+			got = append(got, dc.computeTime(req))
+		}
+		return got
+	}
+
+	got := times(&config)
+	distinct := make(map[time.Duration]struct{})
+	for _, d := range got {
+		if d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Errorf("metadata request took %s, want within [50ms, 150ms]", d)
+		}
+		distinct[d] = struct{}{}
+	}
+	if len(distinct) < 2 {
+		t.Errorf("metadata requests took %v, want them to vary", got)
+	}
+	if again := times(&config); !reflect.DeepEqual(again, got) {
+		t.Errorf("metadata requests took %v then %v with the same seed, want the same", got, again)
+	}
+	if other := times(&reseeded); reflect.DeepEqual(other, got) {
+		t.Errorf("metadata requests took %v with both seeds, want them to differ", got)
+	}
+}
+
+func TestDeviceContext_DistanceSeekDistributions(t *testing.T) {
+	config := *distanceSeekDeviceConfig
+	if err := config.SetField("FullStrokeSeekTime", "uniform(6ms,16ms)"); err != nil {
+		t.Fatalf("SetField(FullStrokeSeekTime, uniform(6ms,16ms)) error: %s", err)
+	}
+
+	// Seeks the same distance take different times, picked from the distribution.
+	dc := newDeviceContext(&config)
+	distinct := make(map[time.Duration]struct{})
+	for i := 0; i < 20; i++ {
+		req := &Request{Type: ReadRequest, Timestamp: startTime.Add(time.Duration(i) * time.Second), Path: "f", Size: 1}
+		distinct[dc.computeSeekTime(req)] = struct{}{}
+	}
+	if len(distinct) < 2 {
+		t.Errorf("distance seeks took %v, want them to vary", distinct)
+	}
+}
+
+func TestDeviceContext_DistributionsComputeMatchesExecute(t *testing.T) {
+	config := *networkDeviceConfig
+	config.SetField("RoundTripTime", "lognormal(10ms,1)")
+	config.SetField("ReadLatency", "p50=1ms,p99=20ms")
+	dc := newDeviceContext(&config)
+	for i := 0; i < 10; i++ {
+		req := &Request{Type: ReadRequest, Timestamp: startTime.Add(time.Duration(i) * time.Second),
+			Path: "a", Start: 0, Size: 2}
+		want := dc.computeTime(req)
+		if got := dc.executeRequest(req).Sub(req.Timestamp); got != want {
+			t.Errorf("executeRequest(%+v) takes %s, want %s from computeTime", req, got, want)
+		}
+	}
+}
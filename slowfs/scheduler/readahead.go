@@ -0,0 +1,148 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs"
+	"slowfs/slowfs/units"
+	"time"
+)
+
+// readaheadState tracks a sequential stream of reads through a file, like the kernel's
+// file_ra_state.
+type readaheadState struct {
+	// Where the last read of the file ended, to spot the start of a sequential stream.
+	lastEnd units.NumBytes
+
+	// The range of the file that has been read into memory, either by a read or by reading ahead.
+	start, end units.NumBytes
+
+	// Once a read goes past marker, the next window is read ahead. This is the start of the most
+	// recent window, so each window is read ahead as soon as the reader starts on the one before.
+	marker units.NumBytes
+
+	// The size of the most recent window, or 0 if the file isn't being read sequentially.
+	window units.NumBytes
+
+	// When the most recent window will have finished being read ahead.
+	ready time.Time
+}
+
+// readahead models the operating system prefetching data ahead of sequential readers, using
+// windows that start small and grow as the stream continues, like the kernel's ondemand readahead.
+type readahead struct {
+	initialWindow units.NumBytes
+	maxWindow     units.NumBytes
+	files         map[string]*readaheadState
+}
+
+// newReadahead creates a readahead model as described by config, or returns nil if config
+// doesn't read ahead.
+func newReadahead(config *slowfs.DeviceConfig) *readahead {
+	if config.ReadaheadMaxWindow == 0 {
+		return nil
+	}
+	return &readahead{
+		initialWindow: config.ReadaheadInitialWindow,
+		maxWindow:     config.ReadaheadMaxWindow,
+		files:         make(map[string]*readaheadState),
+	}
+}
+
+// unread returns the part of the given read request that hasn't already been read into memory.
+// Reads in a stream only ever overlap the start of what has been read, so this is always the end
+// of the request, and may be empty.
+func (ra *readahead) unread(req *Request) *Request {
+	st, ok := ra.files[req.Path]
+	if !ok || req.Start < st.start || req.Start >= st.end {
+		return req
+	}
+	unread := *req
+	end := req.Start + req.Size
+	if end <= st.end {
+		unread.Start, unread.Size = end, 0
+	} else {
+		unread.Start, unread.Size = st.end, end-st.end
+	}
+	return &unread
+}
+
+// wait returns how long the given read request has to wait for data it needs that is still being
+// read ahead.
+func (ra *readahead) wait(req *Request) time.Duration {
+	st, ok := ra.files[req.Path]
+	if !ok || req.Start+req.Size <= st.marker || req.Start >= st.end {
+		return 0
+	}
+	if wait := st.ready.Sub(req.Timestamp); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// read records a read of size bytes at start in the file at path, and returns the window that
+// should now be read ahead, which is empty if there isn't one.
+func (ra *readahead) read(path string, start, size units.NumBytes) (units.NumBytes, units.NumBytes) {
+	end := start + size
+	st, ok := ra.files[path]
+	if !ok {
+		st = &readaheadState{}
+		ra.files[path] = st
+	}
+
+	switch {
+	case st.window > 0 && start >= st.start && start <= st.end:
+		// Continuing a stream, but only read the next window once the reader reaches the last one.
+		if end <= st.marker {
+			st.lastEnd = end
+			return 0, 0
+		}
+		st.window = ra.nextWindow(st.window)
+	case start == st.lastEnd:
+		// Starting a stream, either at the start of the file or straight after the last read.
+		st.window = ra.initialWindow
+		st.end = end
+	default:
+		// Random reads don't read ahead at all.
+		*st = readaheadState{lastEnd: end}
+		return 0, 0
+	}
+
+	windowStart := st.end
+	if end > windowStart {
+		windowStart = end
+	}
+	st.lastEnd = end
+	st.start, st.end, st.marker = start, windowStart+st.window, windowStart
+	return windowStart, st.window
+}
+
+// nextWindow returns the size of the window to read ahead after one of size window, quadrupling
+// small windows and doubling larger ones, up to the maximum.
+func (ra *readahead) nextWindow(window units.NumBytes) units.NumBytes {
+	switch {
+	case window < ra.maxWindow/16:
+		return 4 * window
+	case window <= ra.maxWindow/2:
+		return 2 * window
+	default:
+		return ra.maxWindow
+	}
+}
+
+// close forgets about the stream through the file at path.
+func (ra *readahead) close(path string) {
+	delete(ra.files, path)
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestReadahead_Read(t *testing.T) {
+	cases := []struct {
+		desc        string
+		path        string
+		start, size units.NumBytes
+		wantStart   units.NumBytes
+		wantSize    units.NumBytes
+	}{
+		{"start of file starts stream", "a", 0, 2, 2, 4},
+		{"reaching window doubles it", "a", 2, 2, 6, 8},
+		{"before marker", "a", 4, 2, 0, 0},
+		{"reaching window again", "a", 6, 2, 14, 16},
+		{"up to marker", "a", 8, 6, 0, 0},
+		{"window is capped", "a", 14, 2, 30, 16},
+		{"random read stops stream", "a", 100, 2, 0, 0},
+		{"read after last restarts stream", "a", 102, 2, 104, 4},
+		{"random read in other file", "b", 5, 1, 0, 0},
+		{"sequential read in other file", "b", 6, 1, 7, 4},
+	}
+
+	ra := newReadahead(readaheadDeviceConfig)
+	for _, c := range cases {
+		start, size := ra.read(c.path, c.start, c.size)
+		if start != c.wantStart || size != c.wantSize {
+			t.Errorf("fail (%s) read(%s, %d, %d) = %d, %d, want %d, %d", c.desc, c.path, c.start, c.size,
+				start, size, c.wantStart, c.wantSize)
+		}
+	}
+}
+
+func TestReadahead_NextWindow(t *testing.T) {
+	ra := &readahead{maxWindow: 128}
+	cases := []struct {
+		window units.NumBytes
+		want   units.NumBytes
+	}{{4, 16}, {8, 16}, {16, 32}, {64, 128}, {100, 128}, {128, 128}}
+
+	for _, c := range cases {
+		if got, want := ra.nextWindow(c.window), c.want; got != want {
+			t.Errorf("nextWindow(%d) = %d, want %d", c.window, got, want)
+		}
+	}
+}
+
+func TestReadahead_Unread(t *testing.T) {
+	ra := newReadahead(readaheadDeviceConfig)
+	// Reads bytes 0 and 1, then reads ahead up to byte 6.
+	ra.read("a", 0, 2)
+
+	cases := []struct {
+		path        string
+		start, size units.NumBytes
+		wantStart   units.NumBytes
+		wantSize    units.NumBytes
+	}{
+		{"a", 0, 4, 4, 0},
+		{"a", 4, 6, 6, 4},
+		{"a", 6, 2, 6, 2},
+		{"b", 0, 4, 0, 4},
+	}
+
+	for _, c := range cases {
+		unread := ra.unread(&Request{Type: ReadRequest, Path: c.path, Start: c.start, Size: c.size})
+		if unread.Start != c.wantStart || unread.Size != c.wantSize {
+			t.Errorf("unread(%s, %d, %d) = %d, %d, want %d, %d", c.path, c.start, c.size,
+				unread.Start, unread.Size, c.wantStart, c.wantSize)
+		}
+	}
+}
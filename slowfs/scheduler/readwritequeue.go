@@ -15,95 +15,166 @@
 package scheduler
 
 import (
-	"math"
-	"slowfs/slowfs/units"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
 	"time"
 )
 
-// ReadWriteQueue reorders any requests that are close enough together in time if they would become
-// a sequential read or write by being reordered.
+// ReadWriteQueue holds read and write requests until they are sent to the device, in an order
+// decided by the device's I/O scheduler.
 type readWriteQueue struct {
 	dc    *deviceContext
-	timer *time.Timer
+	clock clock.Clock
+	// Only created once there is a response to schedule, since we only want to fire when the
+	// next request to send is ready.
+	timer clock.Timer
 	queue []*requestData
+
+	// Decides the order requests are sent in, for the I/O scheduler it was created for.
+	policy      ioPolicy
+	ioScheduler slowfs.IOScheduler
+
+	// Holds back requests from processes over their I/O limits. Requests it is holding back are
+	// in releaseTimes, along with when they may be sent, until they are completed.
+	limiter      *ioLimiter
+	releaseTimes map[*requestData]time.Time
 }
 
-func newReadWriteQueue(dc *deviceContext) *readWriteQueue {
-	// If we don't stop the timer, it will immediately fire its channel, but we only want to fire
-	// when the request at the front of the queue is ready.
-	t := time.NewTimer(time.Hour)
-	t.Stop()
+func newReadWriteQueue(dc *deviceContext, clk clock.Clock) *readWriteQueue {
 	return &readWriteQueue{
-		dc:    dc,
-		timer: t,
-		queue: make([]*requestData, 0, 16),
+		dc:           dc,
+		clock:        clk,
+		queue:        make([]*requestData, 0, 16),
+		limiter:      newIOLimiter(),
+		releaseTimes: make(map[*requestData]time.Time),
 	}
 }
 
-func (rwq *readWriteQueue) push(data *requestData) {
-	req := data.req
-	reqByteEnd := req.Start + req.Size
-	var bestDiff units.NumBytes = math.MaxInt64
-	bestIdx := len(rwq.queue)
-	for i := len(rwq.queue) - 1; i >= 0; i-- {
-		otherReq := rwq.queue[i].req
-
-		otherReqByteEnd := otherReq.Start + otherReq.Size
-		if otherReq.Path == req.Path && req.Start >= otherReqByteEnd {
-			// Place after request other.
-			diff := req.Start - otherReqByteEnd
-			if diff < bestDiff {
-				bestDiff = diff
-				bestIdx = i + 1
-			}
-		}
-
-		// Don't insert before a request that was made really early.
-		if req.Timestamp.After(otherReq.Timestamp.Add(rwq.dc.deviceConfig.RequestReorderMaxDelay)) {
-			break
-		}
-
-		if otherReq.Path == req.Path && reqByteEnd <= otherReq.Start {
-			// Place before request other.
-			diff := otherReq.Start - reqByteEnd
-			if diff < bestDiff {
-				bestDiff = diff
-				bestIdx = i
-			}
-		}
+// Push adds a request to the queue, and returns whether it was reordered ahead of any requests
+// already there.
+func (rwq *readWriteQueue) push(data *requestData) bool {
+	release := rwq.limiter.reserve(rwq.dc.deviceConfig.IOLimits, data.req)
+	if release.After(data.req.Timestamp) {
+		rwq.releaseTimes[data] = release
 	}
+	idx := rwq.currentPolicy().insert(rwq.queue, data)
+	reordered := idx != len(rwq.queue)
 	rwq.queue = append(rwq.queue, nil)
-	copy(rwq.queue[bestIdx+1:], rwq.queue[bestIdx:])
-	rwq.queue[bestIdx] = data
+	copy(rwq.queue[idx+1:], rwq.queue[idx:])
+	rwq.queue[idx] = data
+	return reordered
 }
 
-func (rwq *readWriteQueue) pop(curTime time.Time) *requestData {
+// currentPolicy returns the policy for the device's I/O scheduler, starting a new one if the device
+// has been switched to a different I/O scheduler.
+func (rwq *readWriteQueue) currentPolicy() ioPolicy {
+	if rwq.policy == nil || rwq.ioScheduler != rwq.dc.deviceConfig.IOScheduler {
+		rwq.policy = newIOPolicy(rwq.dc)
+		rwq.ioScheduler = rwq.dc.deviceConfig.IOScheduler
+	}
+	return rwq.policy
+}
+
+// Pop takes the next request to send to the device off the queue, if it is ready, and returns
+// whether it was sent ahead of any requests that were queued in front of it.
+func (rwq *readWriteQueue) pop(curTime time.Time) (*requestData, bool) {
 	if len(rwq.queue) == 0 || !rwq.ready(curTime) {
-		return nil
+		return nil, false
 	}
 
-	item := rwq.queue[0]
-	rwq.queue = rwq.queue[1:]
-	return item
+	idx := rwq.nextIndex(curTime)
+	item := rwq.queue[idx]
+	rwq.queue = append(rwq.queue[:idx], rwq.queue[idx+1:]...)
+	rwq.policy.dispatched(item.req)
+	return item, idx != 0
 }
 
 func (rwq *readWriteQueue) scheduleResponse(curTime time.Time) {
 	if len(rwq.queue) == 0 {
 		return
 	}
-	timeToWait := rwq.cutoffTime(rwq.queue[0].req).Sub(curTime)
-	rwq.timer.Reset(timeToWait)
+	// Wait until the next request is ready, or a request the I/O limits are holding back is
+	// released, since that may change which request goes next.
+	var wakeTime time.Time
+	if idx := rwq.nextIndex(curTime); idx >= 0 {
+		wakeTime = rwq.cutoffTime(rwq.queue[idx].req)
+	}
+	for _, release := range rwq.releaseTimes {
+		if release.After(curTime) && (wakeTime.IsZero() || release.Before(wakeTime)) {
+			wakeTime = release
+		}
+	}
+	timeToWait := wakeTime.Sub(curTime)
+	if rwq.timer == nil {
+		rwq.timer = rwq.clock.NewTimer(timeToWait)
+	} else {
+		rwq.timer.Reset(timeToWait)
+	}
 }
 
+// ResponseChannel returns a channel that fires when the request at the front of the queue may be
+// ready. Until a response has been scheduled, this is a nil channel, which never fires.
 func (rwq *readWriteQueue) responseChannel() <-chan time.Time {
-	return rwq.timer.C
+	if rwq.timer == nil {
+		return nil
+	}
+	return rwq.timer.C()
 }
 
 func (rwq *readWriteQueue) ready(curTime time.Time) bool {
-	if len(rwq.queue) == 0 {
-		return false
+	idx := rwq.nextIndex(curTime)
+	return idx >= 0 && curTime.After(rwq.cutoffTime(rwq.queue[idx].req))
+}
+
+// nextIndex returns the index of the request in the queue that would be sent to the device next,
+// out of those the I/O limits have released, or -1 if there are none.
+func (rwq *readWriteQueue) nextIndex(curTime time.Time) int {
+	released := rwq.queue
+	if len(rwq.releaseTimes) != 0 {
+		released = make([]*requestData, 0, len(rwq.queue))
+		for _, data := range rwq.queue {
+			if release, ok := rwq.releaseTimes[data]; !ok || !release.After(curTime) {
+				released = append(released, data)
+			}
+		}
+	}
+	if len(released) == 0 {
+		return -1
+	}
+	next := released[rwq.currentPolicy().next(released, curTime)]
+	for i, data := range rwq.queue {
+		if data == next {
+			return i
+		}
+	}
+	return -1
+}
+
+// dropWrites takes every write off the queue without sending it to the device, and returns them.
+func (rwq *readWriteQueue) dropWrites() []*requestData {
+	var writes []*requestData
+	queue := rwq.queue[:0]
+	for _, data := range rwq.queue {
+		if data.req.Type == WriteRequest {
+			writes = append(writes, data)
+			delete(rwq.releaseTimes, data)
+		} else {
+			queue = append(queue, data)
+		}
+	}
+	rwq.queue = queue
+	return writes
+}
+
+// takeReleaseTime returns when the I/O limits allowed a request taken off the queue to be sent to
+// the device, and forgets about it. For requests that weren't held back, this is their timestamp.
+func (rwq *readWriteQueue) takeReleaseTime(data *requestData) time.Time {
+	release, ok := rwq.releaseTimes[data]
+	if !ok {
+		return data.req.Timestamp
 	}
-	return curTime.After(rwq.cutoffTime(rwq.queue[0].req))
+	delete(rwq.releaseTimes, data)
+	return release
 }
 
 // We need to wait for a while before allowing a request to be popped off, because requests that
@@ -17,6 +17,8 @@ package scheduler
 import (
 	"fmt"
 	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
 	"testing"
 	"time"
 )
@@ -27,7 +29,7 @@ func (rd *requestData) String() string {
 
 func TestReadWriteQueue_CutoffTime(t *testing.T) {
 	var startTime time.Time
-	testRwq := newReadWriteQueue(newDeviceContext(basicDeviceConfig))
+	testRwq := newReadWriteQueue(newDeviceContext(basicDeviceConfig), clock.RealClock{})
 
 	cases := []struct {
 		desc string
@@ -132,7 +134,7 @@ func TestReadWriteQueue_Ready(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		var testRwq = newReadWriteQueue(newDeviceContext(basicDeviceConfig))
+		var testRwq = newReadWriteQueue(newDeviceContext(basicDeviceConfig), clock.RealClock{})
 		for _, reqData := range c.reqData {
 			testRwq.push(reqData)
 		}
@@ -208,12 +210,12 @@ func TestReadWriteQueue_ScheduleResponse(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		var testRwq = newReadWriteQueue(newDeviceContext(basicDeviceConfig))
+		clk := clock.NewSimulatedClock(c.curTime)
+		var testRwq = newReadWriteQueue(newDeviceContext(basicDeviceConfig), clk)
 		testRwq.push(c.reqData)
-		testRwq.scheduleResponse(c.curTime)
-		start := time.Now()
+		testRwq.scheduleResponse(clk.Now())
 		<-testRwq.responseChannel()
-		if got, want := time.Since(start), c.want; got-want < 0 || got-want > time.Millisecond {
+		if got, want := clk.Since(c.curTime), c.want; got-want < 0 || got-want > time.Millisecond {
 			t.Errorf("fail (%s) response took %s, want %s", c.desc, got, want)
 		}
 	}
@@ -821,12 +823,12 @@ func TestReadWriteQueue_PushAndPop(t *testing.T) {
 
 	for _, c := range cases {
 		dc := newDeviceContext(basicDeviceConfig)
-		testRwq := newReadWriteQueue(dc)
+		testRwq := newReadWriteQueue(dc, clock.RealClock{})
 		for _, push := range c.pushes {
 			testRwq.push(push)
 		}
 		for _, pop := range c.pops {
-			got := testRwq.pop(pop.time)
+			got, _ := testRwq.pop(pop.time)
 			if !reflect.DeepEqual(got, pop.want) {
 				t.Errorf("fail (%s) pop(%+v) = %+v, want %+v", c.desc, pop.time, got, pop.want)
 			}
@@ -836,3 +838,53 @@ func TestReadWriteQueue_PushAndPop(t *testing.T) {
 		}
 	}
 }
+
+func TestReadWriteQueue_PushContinuesStream(t *testing.T) {
+	var startTime time.Time
+
+	dc := newDeviceContext(streamTableDeviceConfig)
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 1})
+	dc.execute(&Request{Type: ReadRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 1})
+	testRwq := newReadWriteQueue(dc, clock.RealClock{})
+
+	cases := []struct {
+		req           *Request
+		wantReordered bool
+	}{
+		{&Request{Type: ReadRequest, Timestamp: startTime, Path: "b", Start: 5, Size: 1}, false},
+		{&Request{Type: ReadRequest, Timestamp: startTime, Path: "c", Start: 0, Size: 1}, false},
+		// Continues the stream through a, so goes to the front.
+		{&Request{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 1, Size: 1}, true},
+		// Continues the stream through b, but too late to go ahead of the others.
+		{&Request{Type: ReadRequest, Timestamp: startTime.Add(time.Second), Path: "b", Start: 1, Size: 1}, false},
+	}
+
+	for _, c := range cases {
+		if got, want := testRwq.push(&requestData{c.req, nil}), c.wantReordered; got != want {
+			t.Errorf("push(%+v) = %t, want %t", c.req, got, want)
+		}
+	}
+
+	var got []string
+	for _, reqData := range testRwq.queue {
+		got = append(got, fmt.Sprintf("%s@%d", reqData.req.Path, reqData.req.Start))
+	}
+	if want := []string{"a@1", "b@5", "c@0", "b@1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queue = %v, want %v", got, want)
+	}
+}
+
+func TestReadWriteQueue_IOLimits(t *testing.T) {
+	config := *basicDeviceConfig
+	config.IOLimits = slowfs.IOLimits{{Match: "uid", Value: "1", ReadIOPS: 1}}
+	read := func(uid uint32) policyOp {
+		return policyOp{push: &Request{Type: ReadRequest, Timestamp: startTime, Path: fmt.Sprint(uid), Size: 10, Caller: Caller{Pid: uid, Uid: uid}}}
+	}
+
+	// The second read from UID 1 is held back for a second, but doesn't hold up UID 2.
+	ops := []policyOp{read(1), read(1), read(2), {pop: 500 * time.Millisecond}, {pop: 2 * time.Second}}
+	want := []string{"read1@0", "read2@0", "not ready", "read1@0"}
+	if got := runPolicyOps(&config, ops); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
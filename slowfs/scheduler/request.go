@@ -15,7 +15,9 @@
 package scheduler
 
 import (
+	"fmt"
 	"slowfs/slowfs/units"
+	"strings"
 	"time"
 )
 
@@ -31,8 +33,100 @@ const (
 	FsyncRequest
 	AllocateRequest
 	MetadataRequest
+	// FdatasyncRequest is an fsync that only needs to persist the file's data, not its metadata.
+	FdatasyncRequest
+	// SyncFileRangeRequest writes back Size bytes of the file's data, like sync_file_range with
+	// SYNC_FILE_RANGE_WAIT_BEFORE, SYNC_FILE_RANGE_WRITE and SYNC_FILE_RANGE_WAIT_AFTER. It doesn't
+	// flush the device's cache.
+	SyncFileRangeRequest
+	// SyncfsRequest persists everything waiting to be written back, like syncfs or sync.
+	SyncfsRequest
+	// DirFsyncRequest is an fsync of a directory, which persists its entries.
+	DirFsyncRequest
 )
 
+func (t RequestType) String() string {
+	switch t {
+	case ReadRequest:
+		return "read"
+	case WriteRequest:
+		return "write"
+	case OpenRequest:
+		return "open"
+	case CloseRequest:
+		return "close"
+	case FsyncRequest:
+		return "fsync"
+	case AllocateRequest:
+		return "allocate"
+	case MetadataRequest:
+		return "metadata"
+	case FdatasyncRequest:
+		return "fdatasync"
+	case SyncFileRangeRequest:
+		return "syncfilerange"
+	case SyncfsRequest:
+		return "syncfs"
+	case DirFsyncRequest:
+		return "dirfsync"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseRequestTypeFromString parses a string, as returned by RequestType.String, into a
+// RequestType. Case insensitive.
+func ParseRequestTypeFromString(s string) (RequestType, error) {
+	switch strings.ToLower(s) {
+	case "read":
+		return ReadRequest, nil
+	case "write":
+		return WriteRequest, nil
+	case "open":
+		return OpenRequest, nil
+	case "close":
+		return CloseRequest, nil
+	case "fsync":
+		return FsyncRequest, nil
+	case "allocate":
+		return AllocateRequest, nil
+	case "metadata":
+		return MetadataRequest, nil
+	case "fdatasync":
+		return FdatasyncRequest, nil
+	case "syncfilerange", "sync_file_range":
+		return SyncFileRangeRequest, nil
+	case "syncfs", "sync":
+		return SyncfsRequest, nil
+	case "dirfsync":
+		return DirFsyncRequest, nil
+	}
+	return ReadRequest, fmt.Errorf("unknown request type %s", s)
+}
+
+// RequestFlags change how reads and writes are handled, according to the flags their file was
+// opened with.
+type RequestFlags int
+
+// Flags that can be set on a request.
+const (
+	// SyncFlag makes a write persist its data and metadata before completing, like O_SYNC.
+	SyncFlag RequestFlags = 1 << iota
+	// DataSyncFlag makes a write persist its data before completing, like O_DSYNC.
+	DataSyncFlag
+	// DirectFlag makes a read or write bypass the page cache and write back cache, like O_DIRECT.
+	DirectFlag
+)
+
+// Caller identifies the process that made a request, as far as it is known.
+type Caller struct {
+	Pid uint32
+	Uid uint32
+	Gid uint32
+	// The name of the process's executable.
+	Process string
+}
+
 // Request contains information for all types of requests.
 type Request struct {
 	Type      RequestType
@@ -40,4 +134,55 @@ type Request struct {
 	Path      string
 	Start     units.NumBytes
 	Size      units.NumBytes
+	Flags     RequestFlags
+	Caller
+}
+
+// flagNames are the names of the flags, in the order their bits are in.
+var flagNames = []string{"sync", "dsync", "direct"}
+
+// String returns the names of the flags that are set, separated by commas, like "sync,direct".
+func (f RequestFlags) String() string {
+	var names []string
+	for i, name := range flagNames {
+		if f&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseRequestFlagsFromString parses a comma separated list of flags, as returned by
+// RequestFlags.String, into RequestFlags. Case insensitive.
+func ParseRequestFlagsFromString(s string) (RequestFlags, error) {
+	var flags RequestFlags
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for i, flagName := range flagNames {
+			if name == flagName {
+				flags |= 1 << uint(i)
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown request flag %s", name)
+		}
+	}
+	return flags, nil
+}
+
+// WritesThrough returns whether writes with these flags go straight to the device, rather than
+// into the write back cache.
+func (f RequestFlags) WritesThrough() bool {
+	return f&(SyncFlag|DataSyncFlag|DirectFlag) != 0
+}
+
+// writesThrough returns whether a write goes straight to the device, rather than into the write
+// back cache.
+func (req *Request) writesThrough() bool {
+	return req.Flags.WritesThrough()
 }
@@ -0,0 +1,128 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"path/filepath"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/units"
+	"strings"
+	"time"
+)
+
+// Route sends requests for paths matching Pattern to Scheduler.
+type Route struct {
+	// Pattern is a pattern, as accepted by filepath.Match, for paths relative to the root of the
+	// filesystem. It matches a path if it matches the path or any of its parent directories, so a
+	// plain directory name like "wal" matches everything under that directory.
+	Pattern   string
+	Scheduler *Scheduler
+}
+
+// Router sends each request to the scheduler for the device its path is on, so that different
+// parts of a filesystem can be on different devices.
+type Router struct {
+	routes   []Route
+	fallback *Scheduler
+	clock    clock.Clock
+}
+
+// NewRouter creates a Router that sends requests to the scheduler of the first route matching
+// their path, or to fallback if none do. If fallback is nil, requests that no route matches take
+// no time at all. All the schedulers must use clk.
+func NewRouter(clk clock.Clock, routes []Route, fallback *Scheduler) (*Router, error) {
+	// FUSE gives paths without leading or trailing slashes.
+	trimmed := make([]Route, len(routes))
+	for i, route := range routes {
+		route.Pattern = strings.Trim(route.Pattern, "/")
+		if _, err := filepath.Match(route.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad path pattern %q: %s", route.Pattern, err)
+		}
+		trimmed[i] = route
+	}
+	return &Router{
+		routes:   trimmed,
+		fallback: fallback,
+		clock:    clk,
+	}, nil
+}
+
+// Clock returns the Clock the router's schedulers tell the time with.
+func (r *Router) Clock() clock.Clock {
+	return r.clock
+}
+
+// Scheduler returns the scheduler for the device the given path is on, or nil if requests for it
+// should take no time.
+func (r *Router) Scheduler(path string) *Scheduler {
+	path = strings.Trim(path, "/")
+	for _, route := range r.routes {
+		// Try the path itself, then each of its parent directories.
+		for p := path; ; p = filepath.Dir(p) {
+			if matched, _ := filepath.Match(route.Pattern, p); matched {
+				return route.Scheduler
+			}
+			if !strings.Contains(p, "/") {
+				break
+			}
+		}
+	}
+	return r.fallback
+}
+
+// Schedule schedules a request on the scheduler for its path, and returns how long the request
+// should take.
+// N.B. this can block.
+func (r *Router) Schedule(req *Request) time.Duration {
+	s := r.Scheduler(req.Path)
+	if s == nil {
+		return 0
+	}
+	return s.Schedule(req)
+}
+
+// Schedulers returns each of the router's schedulers once, in the order of the routes they first
+// appear in, followed by the fallback.
+func (r *Router) Schedulers() []*Scheduler {
+	var schedulers []*Scheduler
+	seen := make(map[*Scheduler]bool)
+	add := func(s *Scheduler) {
+		if s != nil && !seen[s] {
+			seen[s] = true
+			schedulers = append(schedulers, s)
+		}
+	}
+	for _, route := range r.routes {
+		add(route.Scheduler)
+	}
+	add(r.fallback)
+	return schedulers
+}
+
+// PowerCut calls PowerCut on each of the router's schedulers, and returns how many bytes of each
+// open file were lost, and how many bytes of closed files were lost on each device.
+func (r *Router) PowerCut() (lost map[string]units.NumBytes, orphaned map[*Scheduler]units.NumBytes) {
+	lost = make(map[string]units.NumBytes)
+	orphaned = make(map[*Scheduler]units.NumBytes)
+	for _, s := range r.Schedulers() {
+		schedulerLost, schedulerOrphaned := s.PowerCut()
+		for path, bytes := range schedulerLost {
+			lost[path] += bytes
+		}
+		orphaned[s] = schedulerOrphaned
+	}
+	return lost, orphaned
+}
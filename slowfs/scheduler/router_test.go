@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/clock"
+	"testing"
+	"time"
+)
+
+func TestRouter_Scheduler(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	wal := NewWithClock(basicDeviceConfig, clk)
+	data := NewWithClock(basicDeviceConfig, clk)
+	router, err := NewRouter(clk, []Route{
+		{Pattern: "/wal/", Scheduler: wal},
+		{Pattern: "data*", Scheduler: data},
+		{Pattern: "tmp/*.log", Scheduler: wal},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewRouter() error: %s", err)
+	}
+
+	cases := []struct {
+		path string
+		want *Scheduler
+	}{
+		{"wal", wal},
+		{"wal/000001", wal},
+		{"wal2/000001", nil},
+		{"data1/a/b", data},
+		{"data", data},
+		{"tmp/x.log", wal},
+		{"tmp/x", nil},
+		{"x.log", nil},
+		{"", nil},
+	}
+
+	for _, c := range cases {
+		if got := router.Scheduler(c.path); got != c.want {
+			t.Errorf("Scheduler(%q) = %p, want %p", c.path, got, c.want)
+		}
+	}
+
+	got := router.Schedulers()
+	if len(got) != 2 || got[0] != wal || got[1] != data {
+		t.Errorf("Schedulers() = %v, want [%p %p]", got, wal, data)
+	}
+}
+
+func TestRouter_Schedule(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	router, err := NewRouter(clk, []Route{{Pattern: "slow", Scheduler: NewWithClock(basicDeviceConfig, clk)}}, nil)
+	if err != nil {
+		t.Fatalf("NewRouter() error: %s", err)
+	}
+
+	cases := []struct {
+		req  *Request
+		want time.Duration
+	}{
+		{&Request{Type: MetadataRequest, Timestamp: startTime, Path: "slow/a"}, 80 * time.Millisecond},
+		{&Request{Type: MetadataRequest, Timestamp: startTime, Path: "fast/a"}, 0},
+	}
+
+	for _, c := range cases {
+		if got := router.Schedule(c.req); got != c.want {
+			t.Errorf("Schedule(%+v) = %s, want %s", c.req, got, c.want)
+		}
+	}
+}
+
+func TestNewRouter_BadPattern(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	if _, err := NewRouter(clk, []Route{{Pattern: "[", Scheduler: nil}}, nil); err == nil {
+		t.Errorf("NewRouter([) should fail")
+	}
+}
@@ -18,6 +18,8 @@ package scheduler
 
 import (
 	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/units"
 	"time"
 )
 
@@ -26,21 +28,93 @@ type Scheduler struct {
 	dc             *deviceContext
 	readWriteQueue *readWriteQueue
 	requests       chan *requestData
+	clock          clock.Clock
+
+	// Functions sent here are run by the event loop in between requests, so they can safely
+	// change the state of the scheduler.
+	control chan func()
+
+	// While paused, no requests are accepted or completed. Only accessed by the event loop.
+	paused bool
+	// Set by Close to stop the event loop. Only accessed by the event loop.
+	closed bool
+
+	// Notified about every request once it has been scheduled. Only accessed by the event loop.
+	observers []Observer
+
+	// Read and write requests that were reordered ahead of others when queued, until they are
+	// completed. Only accessed by the event loop.
+	reordered map[*requestData]bool
+
+	// When the scheduler was created, according to its clock.
+	created time.Time
+}
+
+// Event describes a request that the scheduler has decided the duration of.
+type Event struct {
+	Request *Request
+	// When the request was taken off the queue and sent to the device.
+	Dispatched time.Time
+	// How long the request should take, from its timestamp.
+	Duration time.Duration
+	// Whether the request had to seek.
+	Seek bool
+	// Whether the request was reordered ahead of requests that arrived before it.
+	Reordered bool
+	// Whether the request was a read served entirely from memory, i.e. the page cache or data that
+	// had been read ahead.
+	CacheHit bool
+	// How long the I/O limits held the request back for, which is included in Duration.
+	Throttled time.Duration
+}
+
+// Observer is notified about every request the scheduler handles, e.g. to export metrics.
+type Observer interface {
+	// Observe is called by the scheduler's event loop, so should return quickly, and must not
+	// call back into the scheduler.
+	Observe(e *Event)
+}
+
+// Stats is a snapshot of the scheduler's state.
+type Stats struct {
+	// How many read and write requests are waiting to be reordered.
+	QueueLength int
+	// How many bytes are waiting to be written back, for open and closed files.
+	UnwrittenBytes         units.NumBytes
+	OrphanedUnwrittenBytes units.NumBytes
+	// How long the device has been working on requests, and how long the scheduler has existed.
+	BusyTime time.Duration
+	Elapsed  time.Duration
 }
 
 // New creates a new Scheduler using the given DeviceConfig to help compute how long requests
 // should take.
 func New(config *slowfs.DeviceConfig) *Scheduler {
+	return NewWithClock(config, clock.RealClock{})
+}
+
+// NewWithClock creates a new Scheduler like New, but which tells the time using the given Clock.
+func NewWithClock(config *slowfs.DeviceConfig, clk clock.Clock) *Scheduler {
 	dc := newDeviceContext(config)
 	scheduler := &Scheduler{
 		dc:             dc,
-		readWriteQueue: newReadWriteQueue(dc),
+		readWriteQueue: newReadWriteQueue(dc, clk),
 		requests:       make(chan *requestData, 10),
+		clock:          clk,
+		control:        make(chan func()),
+		reordered:      make(map[*requestData]bool),
+		created:        clk.Now(),
 	}
 	go scheduler.serveRequests()
 	return scheduler
 }
 
+// Clock returns the Clock the scheduler tells the time with. Anything waiting for the durations
+// the scheduler hands out should wait using this clock.
+func (s *Scheduler) Clock() clock.Clock {
+	return s.clock
+}
+
 type requestData struct {
 	req             *Request
 	responseChannel chan time.Duration
@@ -54,29 +128,204 @@ func (s *Scheduler) Schedule(req *Request) time.Duration {
 	return <-ch
 }
 
+// Config returns a copy of the DeviceConfig the scheduler is currently using.
+func (s *Scheduler) Config() slowfs.DeviceConfig {
+	var config slowfs.DeviceConfig
+	s.do(func() {
+		config = *s.dc.deviceConfig
+	})
+	return config
+}
+
+// SetConfig validates the given DeviceConfig, and if it is valid, switches the scheduler over to
+// a copy of it. The switch happens in between requests, and keeps state such as data waiting to be
+// written back where it still makes sense.
+func (s *Scheduler) SetConfig(config *slowfs.DeviceConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	newConfig := *config
+	s.do(func() {
+		s.dc.setConfig(&newConfig)
+	})
+	return nil
+}
+
+// Pause stops the scheduler from accepting or completing any requests until Resume is called.
+func (s *Scheduler) Pause() {
+	s.do(func() {
+		s.paused = true
+	})
+}
+
+// Resume undoes Pause. Requests that arrived while paused are then served as normal, having
+// already waited for the duration of the pause.
+func (s *Scheduler) Resume() {
+	s.do(func() {
+		s.paused = false
+	})
+}
+
+// Paused returns whether the scheduler is paused.
+func (s *Scheduler) Paused() bool {
+	var paused bool
+	s.do(func() {
+		paused = s.paused
+	})
+	return paused
+}
+
+// AddObserver registers an Observer to be told about every request from now on.
+func (s *Scheduler) AddObserver(o Observer) {
+	s.do(func() {
+		s.observers = append(s.observers, o)
+	})
+}
+
+// Stats returns a snapshot of the scheduler's state.
+func (s *Scheduler) Stats() Stats {
+	var stats Stats
+	s.do(func() {
+		stats.QueueLength = len(s.readWriteQueue.queue)
+		if wbc := s.dc.writeBackCache; wbc != nil {
+			for _, bytes := range wbc.unwrittenBytes {
+				stats.UnwrittenBytes += bytes
+			}
+			stats.OrphanedUnwrittenBytes = wbc.orphanedUnwrittenBytes
+		}
+		stats.BusyTime = s.dc.busyTime
+		stats.Elapsed = s.clock.Since(s.created)
+	})
+	return stats
+}
+
+// PowerCut simulates the device losing power, forgetting everything in its write back cache. Writes
+// still waiting in the queue are dropped, and complete straight away without reaching the device.
+// It returns how many bytes of each open file were lost, counting the dropped writes, and how many
+// bytes of closed files were lost. Without a write back cache, nothing is lost. The page cache is
+// emptied too.
+func (s *Scheduler) PowerCut() (lost map[string]units.NumBytes, orphaned units.NumBytes) {
+	lost = make(map[string]units.NumBytes)
+	s.do(func() {
+		s.dc.dropCaches()
+		wbc := s.dc.writeBackCache
+		if wbc == nil {
+			return
+		}
+		for path, bytes := range wbc.unwrittenBytes {
+			lost[path] = bytes
+		}
+		for _, reqData := range s.readWriteQueue.dropWrites() {
+			lost[reqData.req.Path] += reqData.req.Size
+			delete(s.reordered, reqData)
+			reqData.responseChannel <- s.clock.Since(reqData.req.Timestamp)
+		}
+		orphaned = wbc.orphanedUnwrittenBytes
+		s.dc.writeBackCache = newWriteBackCache(s.dc.deviceConfig)
+	})
+	return lost, orphaned
+}
+
+// DropCaches empties the page cache and forgets anything read ahead, like writing 3 to
+// /proc/sys/vm/drop_caches. Data waiting to be written back is kept.
+func (s *Scheduler) DropCaches() {
+	s.do(func() {
+		s.dc.dropCaches()
+	})
+}
+
+// Close stops the scheduler's event loop. The scheduler must not be used afterwards.
+func (s *Scheduler) Close() {
+	s.do(func() {
+		s.closed = true
+	})
+}
+
+// Runs f on the event loop, and waits for it to finish.
+func (s *Scheduler) do(f func()) {
+	done := make(chan struct{})
+	s.control <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
 // Main event loop to serve requests.
 func (s *Scheduler) serveRequests() {
 	for {
+		// Receiving from a nil channel blocks forever, so this stops requests being accepted or
+		// completed while paused.
+		requests, responses := s.requests, s.readWriteQueue.responseChannel()
+		if s.paused {
+			requests, responses = nil, nil
+		}
+
 		select {
-		case reqData := <-s.requests:
-			req, resp := reqData.req, reqData.responseChannel
-			switch req.Type {
+		case f := <-s.control:
+			f()
+			if s.closed {
+				return
+			}
+		case reqData := <-requests:
+			switch reqData.req.Type {
 			case ReadRequest, WriteRequest:
-				s.readWriteQueue.push(reqData)
+				// Reads served from the page cache never reach the device, so don't queue.
+				if s.dc.cacheHit(reqData.req) {
+					s.complete(reqData)
+				} else if s.readWriteQueue.push(reqData) {
+					s.reordered[reqData] = true
+				}
 			default:
-				resp <- s.dc.computeTime(req)
-				s.dc.execute(req)
+				s.complete(reqData)
 			}
-		case <-s.readWriteQueue.responseChannel():
-			reqData := s.readWriteQueue.pop(time.Now())
+		case <-responses:
+			reqData, reordered := s.readWriteQueue.pop(s.clock.Now())
 			if reqData != nil {
-				reqData.responseChannel <- s.dc.computeTime(reqData.req)
-				s.dc.execute(reqData.req)
+				if reordered {
+					s.reordered[reqData] = true
+				}
+				s.complete(reqData)
 			}
 		}
 
 		// This needs to be called every loop, since executing a request can change how long a
 		// read or write request on the front of the queue would take.
-		s.readWriteQueue.scheduleResponse(time.Now())
+		if !s.paused {
+			s.readWriteQueue.scheduleResponse(s.clock.Now())
+		}
+	}
+}
+
+// Sends back how long a request should take, executes it on the device, and tells observers.
+func (s *Scheduler) complete(reqData *requestData) {
+	req := reqData.req
+	// A request held back by the I/O limits reaches the device as if it had arrived when released.
+	deviceReq := req
+	release := s.readWriteQueue.takeReleaseTime(reqData)
+	throttled := release.Sub(req.Timestamp)
+	if throttled > 0 {
+		released := *req
+		released.Timestamp = release
+		deviceReq = &released
+	}
+	// The flusher may have kept the device busy since the last request.
+	s.dc.flushExpired(s.clock.Now())
+	event := &Event{
+		Request:    req,
+		Dispatched: s.clock.Now(),
+		Duration:   throttled + s.dc.computeTime(deviceReq),
+		Seek:       s.dc.seeks(deviceReq),
+		Reordered:  s.reordered[reqData],
+		CacheHit:   s.dc.cacheHit(deviceReq),
+		Throttled:  throttled,
+	}
+	delete(s.reordered, reqData)
+
+	reqData.responseChannel <- event.Duration
+	s.dc.execute(deviceReq)
+
+	for _, o := range s.observers {
+		o.Observe(event)
 	}
 }
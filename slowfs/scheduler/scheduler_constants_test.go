@@ -81,3 +81,193 @@ var notNiceNumbersDeviceConfig = &slowfs.DeviceConfig{
 	WriteStrategy:          slowfs.SimulateWrite,
 	MetadataOpTime:         80 * time.Millisecond,
 }
+
+var solidStateDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MediaType:              slowfs.SolidStateMedia,
+	Channels:               2,
+	ReadLatency:            10 * time.Millisecond,
+	WriteLatency:           5 * time.Millisecond,
+}
+
+// Rotational latency is 5ms, and a seek across a quarter of the disk takes 6ms.
+var distanceSeekDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	SeekModel:              slowfs.DistanceSeek,
+	DiskCapacity:           10000 * units.Byte,
+	TrackToTrackSeekTime:   1 * time.Millisecond,
+	FullStrokeSeekTime:     11 * time.Millisecond,
+	RPM:                    6000,
+}
+
+// Holds four pages of two bytes, and reads them at 1000B/s.
+var pageCacheDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	PageCacheSize:          8 * units.Byte,
+	PageSize:               2 * units.Byte,
+	MemoryBytesPerSecond:   1000 * units.Byte,
+}
+
+// Reads ahead windows of 4 bytes growing to 16 bytes, and reads from memory at 1000B/s.
+var readaheadDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	MemoryBytesPerSecond:   1000 * units.Byte,
+	ReadaheadInitialWindow: 4 * units.Byte,
+	ReadaheadMaxWindow:     16 * units.Byte,
+}
+
+var streamTableDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	StreamTableSize:        2,
+}
+
+// Starts throttling writes once 20 bytes are waiting to be written back, and blocks at 30.
+var dirtyThrottleDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	DirtyBackgroundBytes:   10 * units.Byte,
+	DirtyLimitBytes:        30 * units.Byte,
+}
+
+// The flusher wakes up every 50ms, and writes back data older than 100ms.
+var flusherDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	DirtyExpireInterval:    100 * time.Millisecond,
+	DirtyWritebackInterval: 50 * time.Millisecond,
+}
+
+// Fsyncs write back every file's data, and take an extra 5ms to commit the journal, or 3ms
+// without any data.
+var journaledDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.JournaledFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	JournalCommitTime:      5 * time.Millisecond,
+	JournalPolicy:          slowfs.JournalAllFiles,
+	MetadataFsyncTime:      3 * time.Millisecond,
+}
+
+// UID 1000 can only make 10 reads per second.
+var ioLimitsDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 10 * time.Millisecond,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+	IOLimits:               slowfs.IOLimits{{Match: "uid", Value: "1000", ReadIOPS: 10}},
+}
+
+// Runs reads and writes at 1000 bytes per second, after a fixed 1ms latency.
+var fastTierDeviceConfig = &slowfs.DeviceConfig{
+	Name:                   "fast",
+	ReadBytesPerSecond:     1000 * units.Byte,
+	WriteBytesPerSecond:    1000 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	FsyncStrategy:          slowfs.NoFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MediaType:              slowfs.SolidStateMedia,
+	ReadLatency:            time.Millisecond,
+	WriteLatency:           time.Millisecond,
+}
+
+// compositeDeviceConfig returns a device built from the given members, with stripes of 2 bytes.
+func compositeDeviceConfig(layout slowfs.DeviceLayout, members ...*slowfs.DeviceConfig) *slowfs.DeviceConfig {
+	config := &slowfs.DeviceConfig{
+		Layout:                 layout,
+		MemberConfigs:          members,
+		StripeSize:             2 * units.Byte,
+		TierCacheSize:          2 * units.Byte,
+		ReadBytesPerSecond:     100 * units.Byte,
+		WriteBytesPerSecond:    100 * units.Byte,
+		AllocateBytesPerSecond: 1000 * units.Byte,
+		FsyncStrategy:          slowfs.NoFsync,
+		WriteStrategy:          slowfs.SimulateWrite,
+		MetadataOpTime:         80 * time.Millisecond,
+	}
+	for _, m := range members {
+		config.Members = append(config.Members, m.Name)
+	}
+	return config
+}
+
+// Every request takes a 10ms round trip, plus another for each 2 bytes beyond the first 2, and two
+// requests can be in flight at once.
+var networkDeviceConfig = &slowfs.DeviceConfig{
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	FsyncStrategy:          slowfs.WriteBackCachedFsync,
+	WriteStrategy:          slowfs.FastWrite,
+	MetadataOpTime:         5 * time.Millisecond,
+	MediaType:              slowfs.NetworkMedia,
+	Channels:               2,
+	ReadLatency:            time.Millisecond,
+	WriteLatency:           2 * time.Millisecond,
+	RoundTripTime:          10 * time.Millisecond,
+	NetworkWindow:          2 * units.Byte,
+}
@@ -0,0 +1,422 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"reflect"
+	"runtime"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/units"
+	"testing"
+	"time"
+)
+
+func TestScheduler_ScheduleSimulatedClock(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(basicDeviceConfig, clk)
+
+	cases := []struct {
+		desc string
+		at   time.Duration
+		req  *Request
+		want time.Duration
+	}{
+		{
+			desc: "first read seeks",
+			at:   0,
+			req:  &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 1},
+			want: 20 * time.Millisecond,
+		},
+		{
+			desc: "sequential read",
+			at:   20 * time.Millisecond,
+			req:  &Request{Type: ReadRequest, Path: "a", Start: 1, Size: 1},
+			want: 10 * time.Millisecond,
+		},
+		{
+			desc: "metadata",
+			at:   30 * time.Millisecond,
+			req:  &Request{Type: MetadataRequest},
+			want: 80 * time.Millisecond,
+		},
+	}
+
+	for _, c := range cases {
+		clk.AdvanceTo(startTime.Add(c.at))
+		c.req.Timestamp = clk.Now()
+		if got, want := s.Schedule(c.req), c.want; got != want {
+			t.Errorf("fail (%s) Schedule(%+v) = %s, want %s", c.desc, c.req, got, want)
+		}
+	}
+}
+
+func TestScheduler_SetConfig(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(basicDeviceConfig, clk)
+
+	config := *basicDeviceConfig
+	config.MetadataOpTime = time.Second
+	if err := s.SetConfig(&config); err != nil {
+		t.Fatalf("SetConfig(%s) error: %s", &config, err)
+	}
+	// Changing the passed config afterwards shouldn't affect the scheduler.
+	config.MetadataOpTime = time.Hour
+
+	req := &Request{Type: MetadataRequest, Timestamp: clk.Now()}
+	if got, want := s.Schedule(req), time.Second; got != want {
+		t.Errorf("Schedule(%+v) = %s, want %s", req, got, want)
+	}
+
+	config.ReadBytesPerSecond = 0
+	if err := s.SetConfig(&config); err == nil {
+		t.Errorf("SetConfig(%s) should fail validation", &config)
+	}
+	if got, want := s.Config().MetadataOpTime, time.Second; got != want {
+		t.Errorf("Config().MetadataOpTime = %s, want %s", got, want)
+	}
+}
+
+func TestScheduler_PowerCut(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(writeBackCacheDeviceConfig, clk)
+
+	reqs := []*Request{
+		{Type: WriteRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 10},
+		{Type: WriteRequest, Timestamp: startTime, Path: "b", Start: 0, Size: 20},
+		{Type: CloseRequest, Timestamp: startTime, Path: "b"},
+	}
+	for _, req := range reqs {
+		s.Schedule(req)
+	}
+
+	lost, orphaned := s.PowerCut()
+	if want := map[string]units.NumBytes{"a": 10}; !reflect.DeepEqual(lost, want) {
+		t.Errorf("PowerCut() lost = %v, want %v", lost, want)
+	}
+	if got, want := orphaned, units.NumBytes(20); got != want {
+		t.Errorf("PowerCut() orphaned = %s, want %s", got, want)
+	}
+
+	// Everything was forgotten by the first power cut.
+	lost, orphaned = s.PowerCut()
+	if len(lost) != 0 || orphaned != 0 {
+		t.Errorf("second PowerCut() = %v, %s, want nothing lost", lost, orphaned)
+	}
+	if got := s.Stats().UnwrittenBytes; got != 0 {
+		t.Errorf("Stats().UnwrittenBytes after PowerCut() = %s, want 0", got)
+	}
+}
+
+func TestScheduler_PowerCutDropsQueuedWrites(t *testing.T) {
+	// Only allow one write a second, so that the second write waits in the queue.
+	config := *writeBackCacheDeviceConfig
+	config.IOLimits = slowfs.IOLimits{{Match: "uid", Value: "0", WriteIOPS: 1}}
+	s := New(&config)
+
+	s.Schedule(&Request{Type: WriteRequest, Timestamp: time.Now(), Path: "a", Start: 0, Size: 10})
+	done := make(chan time.Duration)
+	go func() {
+		done <- s.Schedule(&Request{Type: WriteRequest, Timestamp: time.Now(), Path: "a", Start: 10, Size: 20})
+	}()
+	for s.Stats().QueueLength == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	lost, _ := s.PowerCut()
+	if got, want := lost["a"], units.NumBytes(30); got != want {
+		t.Errorf("PowerCut() lost %s of a, want %s", got, want)
+	}
+	if got := <-done; got >= time.Second {
+		t.Errorf("queued write took %s, want it to finish at the power cut", got)
+	}
+	if got := s.Stats(); got.QueueLength != 0 || got.UnwrittenBytes != 0 {
+		t.Errorf("Stats() after PowerCut() = %+v, want nothing queued or unwritten", got)
+	}
+}
+
+func TestScheduler_Close(t *testing.T) {
+	before := runtime.NumGoroutine()
+	s := NewWithClock(basicDeviceConfig, clock.NewSimulatedClock(startTime))
+	s.Schedule(&Request{Type: MetadataRequest, Timestamp: startTime})
+	s.Close()
+
+	// The event loop may take a moment to exit after Close returns.
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 1000 {
+			t.Fatalf("%d goroutines running after Close(), want %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_DropCaches(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(pageCacheDeviceConfig, clk)
+	observer := &recordingObserver{}
+	s.AddObserver(observer)
+
+	cases := []struct {
+		desc    string
+		drop    bool
+		want    time.Duration
+		wantHit bool
+	}{
+		{desc: "first read misses", want: 30 * time.Millisecond},
+		{desc: "second read hits", want: 2 * time.Millisecond, wantHit: true},
+		{desc: "read after drop misses", drop: true, want: 30 * time.Millisecond},
+	}
+
+	for i, c := range cases {
+		if c.drop {
+			s.DropCaches()
+		}
+		req := &Request{Type: ReadRequest, Timestamp: clk.Now(), Path: "a", Start: 0, Size: 2}
+		if got, want := s.Schedule(req), c.want; got != want {
+			t.Errorf("fail (%s) Schedule(%+v) = %s, want %s", c.desc, req, got, want)
+		}
+		clk.Advance(time.Second)
+		// Make sure the request has been observed.
+		s.Stats()
+		if got, want := observer.events[i].CacheHit, c.wantHit; got != want {
+			t.Errorf("fail (%s) CacheHit = %t, want %t", c.desc, got, want)
+		}
+	}
+}
+
+func TestScheduler_FlushExpired(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(flusherDeviceConfig, clk)
+
+	cases := []struct {
+		desc string
+		at   time.Duration
+		req  *Request
+		want time.Duration
+	}{
+		{
+			desc: "write is cached",
+			at:   0,
+			req:  &Request{Type: WriteRequest, Path: "a", Start: 0, Size: 100},
+			want: 0,
+		},
+		// The simulated clock moves on 1ns to dispatch the write, so the flusher first wakes up
+		// at 50ms+1ns. At 100ms+1ns, spare time writes back 9 bytes, then the flusher writes back
+		// the other 91, keeping the device busy until 1020ms+1ns.
+		{
+			desc: "read waits for flusher",
+			at:   150 * time.Millisecond,
+			req:  &Request{Type: ReadRequest, Path: "b", Start: 0, Size: 1},
+			want: 890*time.Millisecond + time.Nanosecond,
+		},
+	}
+
+	for _, c := range cases {
+		clk.AdvanceTo(startTime.Add(c.at))
+		c.req.Timestamp = clk.Now()
+		if got, want := s.Schedule(c.req), c.want; got != want {
+			t.Errorf("fail (%s) Schedule(%+v) = %s, want %s", c.desc, c.req, got, want)
+		}
+	}
+	if got := s.Stats().UnwrittenBytes; got != 0 {
+		t.Errorf("Stats().UnwrittenBytes = %s, want 0", got)
+	}
+}
+
+func TestScheduler_IOLimits(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(ioLimitsDeviceConfig, clk)
+	observer := &recordingObserver{}
+	s.AddObserver(observer)
+
+	cases := []struct {
+		desc          string
+		at            time.Duration
+		req           *Request
+		want          time.Duration
+		wantThrottled time.Duration
+	}{
+		{
+			desc: "first read isn't throttled",
+			at:   0,
+			req:  &Request{Type: ReadRequest, Path: "a", Start: 0, Size: 1, Caller: Caller{Uid: 1000}},
+			want: 20 * time.Millisecond,
+		},
+		{
+			desc:          "second read waits until 100ms",
+			at:            20 * time.Millisecond,
+			req:           &Request{Type: ReadRequest, Path: "a", Start: 1, Size: 1, Caller: Caller{Uid: 1000}},
+			want:          90 * time.Millisecond,
+			wantThrottled: 80 * time.Millisecond,
+		},
+		{
+			desc: "other users aren't limited",
+			at:   110 * time.Millisecond,
+			req:  &Request{Type: ReadRequest, Path: "a", Start: 2, Size: 1},
+			want: 10 * time.Millisecond,
+		},
+	}
+
+	for i, c := range cases {
+		clk.AdvanceTo(startTime.Add(c.at))
+		c.req.Timestamp = clk.Now()
+		if got, want := s.Schedule(c.req), c.want; got != want {
+			t.Errorf("fail (%s) Schedule(%+v) = %s, want %s", c.desc, c.req, got, want)
+		}
+		// Make sure the request has been observed.
+		s.Stats()
+		if got, want := observer.events[i].Throttled, c.wantThrottled; got != want {
+			t.Errorf("fail (%s) Throttled = %s, want %s", c.desc, got, want)
+		}
+	}
+}
+
+type recordingObserver struct {
+	events []*Event
+}
+
+func (o *recordingObserver) Observe(e *Event) {
+	o.events = append(o.events, e)
+}
+
+func TestScheduler_Observe(t *testing.T) {
+	clk := clock.NewSimulatedClock(startTime)
+	s := NewWithClock(basicDeviceConfig, clk)
+	o := &recordingObserver{}
+	s.AddObserver(o)
+
+	reqs := []*Request{
+		{Type: ReadRequest, Timestamp: startTime, Path: "a", Start: 0, Size: 1},
+		{Type: ReadRequest, Timestamp: startTime.Add(20 * time.Millisecond), Path: "a", Start: 1, Size: 1},
+		{Type: MetadataRequest, Timestamp: startTime.Add(30 * time.Millisecond)},
+	}
+	for _, req := range reqs {
+		clk.AdvanceTo(req.Timestamp)
+		s.Schedule(req)
+	}
+	// Make sure the last request has been observed.
+	s.Stats()
+
+	wantSeeks := []bool{true, false, false}
+	wantDurations := []time.Duration{20 * time.Millisecond, 10 * time.Millisecond, 80 * time.Millisecond}
+	if got, want := len(o.events), len(reqs); got != want {
+		t.Fatalf("observed %d events, want %d", got, want)
+	}
+	for i, e := range o.events {
+		if e.Request != reqs[i] {
+			t.Errorf("event %d has request %+v, want %+v", i, e.Request, reqs[i])
+		}
+		if got, want := e.Seek, wantSeeks[i]; got != want {
+			t.Errorf("event %d has Seek %t, want %t", i, got, want)
+		}
+		if got, want := e.Duration, wantDurations[i]; got != want {
+			t.Errorf("event %d has Duration %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestRequestType_String(t *testing.T) {
+	cases := []struct {
+		requestType RequestType
+		want        string
+	}{
+		{ReadRequest, "read"},
+		{WriteRequest, "write"},
+		{FsyncRequest, "fsync"},
+		{MetadataRequest, "metadata"},
+		{FdatasyncRequest, "fdatasync"},
+		{SyncFileRangeRequest, "syncfilerange"},
+		{SyncfsRequest, "syncfs"},
+		{DirFsyncRequest, "dirfsync"},
+		{12345, "unknown"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.requestType.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.requestType, got, want)
+		}
+	}
+}
+
+func TestRequestFlags_String(t *testing.T) {
+	cases := []struct {
+		flags RequestFlags
+		want  string
+	}{
+		{0, ""},
+		{SyncFlag, "sync"},
+		{DataSyncFlag | DirectFlag, "dsync,direct"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.flags.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.flags, got, want)
+		}
+	}
+}
+
+func TestParseRequestFlagsFromString(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    RequestFlags
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"SYNC", SyncFlag, false},
+		{"direct, dsync", DataSyncFlag | DirectFlag, false},
+		{"sync,chicken", 0, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRequestFlagsFromString(c.s)
+		if c.wantErr != (err != nil) {
+			t.Errorf("ParseRequestFlagsFromString(%s) error = %v, want error: %t", c.s, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("ParseRequestFlagsFromString(%s) = %s, want %s", c.s, got, c.want)
+		}
+	}
+}
+
+func TestParseRequestTypeFromString(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    RequestType
+		wantErr bool
+	}{
+		{"read", ReadRequest, false},
+		{"Write", WriteRequest, false},
+		{"OPEN", OpenRequest, false},
+		{"close", CloseRequest, false},
+		{"fsync", FsyncRequest, false},
+		{"allocate", AllocateRequest, false},
+		{"metadata", MetadataRequest, false},
+		{"fdatasync", FdatasyncRequest, false},
+		{"sync_file_range", SyncFileRangeRequest, false},
+		{"SYNC", SyncfsRequest, false},
+		{"dirfsync", DirFsyncRequest, false},
+		{"chicken", ReadRequest, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseRequestTypeFromString(c.s)
+		if c.wantErr != (err != nil) {
+			t.Errorf("ParseRequestTypeFromString(%s) error = %v, want error: %t", c.s, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("ParseRequestTypeFromString(%s) = %s, want %s", c.s, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"container/list"
+	"slowfs/slowfs/units"
+)
+
+// stream records how far sequential access through a file has got.
+type stream struct {
+	path string
+	// The offset of the first byte we have not accessed.
+	firstUnseenByte units.NumBytes
+}
+
+// streamTable tracks sequential access through the most recently accessed files, so that several
+// files can be read or written sequentially at once without each access being treated as random.
+// When full, the least recently accessed file is forgotten.
+type streamTable struct {
+	capacity int
+	// Streams from most to least recently accessed.
+	order   *list.List
+	streams map[string]*list.Element
+}
+
+func newStreamTable(capacity int) *streamTable {
+	return &streamTable{
+		capacity: maxInt(capacity, 1),
+		order:    list.New(),
+		streams:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the first byte not yet accessed in the file at path, and whether the file is being
+// tracked at all. This doesn't count as accessing the file.
+func (st *streamTable) get(path string) (units.NumBytes, bool) {
+	e, ok := st.streams[path]
+	if !ok {
+		return 0, false
+	}
+	return e.Value.(*stream).firstUnseenByte, true
+}
+
+// access records that the file at path has been accessed up to firstUnseenByte.
+func (st *streamTable) access(path string, firstUnseenByte units.NumBytes) {
+	if e, ok := st.streams[path]; ok {
+		e.Value.(*stream).firstUnseenByte = firstUnseenByte
+		st.order.MoveToFront(e)
+		return
+	}
+	st.streams[path] = st.order.PushFront(&stream{path, firstUnseenByte})
+	st.evict()
+}
+
+// remove stops tracking the file at path.
+func (st *streamTable) remove(path string) {
+	if e, ok := st.streams[path]; ok {
+		st.order.Remove(e)
+		delete(st.streams, path)
+	}
+}
+
+// resize changes how many files are tracked, forgetting the least recently accessed if needed.
+func (st *streamTable) resize(capacity int) {
+	st.capacity = maxInt(capacity, 1)
+	st.evict()
+}
+
+func (st *streamTable) evict() {
+	for st.order.Len() > st.capacity {
+		delete(st.streams, st.order.Remove(st.order.Back()).(*stream).path)
+	}
+}
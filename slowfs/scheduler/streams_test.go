@@ -0,0 +1,72 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"slowfs/slowfs/units"
+	"testing"
+)
+
+func TestStreamTable(t *testing.T) {
+	type getInvocation struct {
+		path            string
+		firstUnseenByte units.NumBytes
+		tracked         bool
+	}
+
+	st := newStreamTable(2)
+	cases := []struct {
+		desc    string
+		f       func()
+		wantGet []getInvocation
+	}{
+		{
+			desc:    "empty",
+			f:       func() {},
+			wantGet: []getInvocation{{"a", 0, false}},
+		},
+		{
+			desc:    "two streams",
+			f:       func() { st.access("a", 1); st.access("b", 2) },
+			wantGet: []getInvocation{{"a", 1, true}, {"b", 2, true}},
+		},
+		{
+			desc:    "third stream forgets least recently accessed",
+			f:       func() { st.access("a", 3); st.access("c", 4) },
+			wantGet: []getInvocation{{"a", 3, true}, {"b", 0, false}, {"c", 4, true}},
+		},
+		{
+			desc:    "remove",
+			f:       func() { st.remove("a") },
+			wantGet: []getInvocation{{"a", 0, false}, {"c", 4, true}},
+		},
+		{
+			desc:    "shrink",
+			f:       func() { st.access("d", 5); st.resize(0) },
+			wantGet: []getInvocation{{"c", 0, false}, {"d", 5, true}},
+		},
+	}
+
+	for _, c := range cases {
+		c.f()
+		for _, get := range c.wantGet {
+			firstUnseenByte, tracked := st.get(get.path)
+			if firstUnseenByte != get.firstUnseenByte || tracked != get.tracked {
+				t.Errorf("fail (%s) get(%s) = %d, %t, want %d, %t", c.desc, get.path, firstUnseenByte, tracked,
+					get.firstUnseenByte, get.tracked)
+			}
+		}
+	}
+}
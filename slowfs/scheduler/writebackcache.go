@@ -18,6 +18,7 @@ import (
 	"math/rand"
 	"slowfs/slowfs"
 	"slowfs/slowfs/units"
+	"sort"
 	"time"
 )
 
@@ -25,38 +26,215 @@ type writeBackCache struct {
 	// Records cached writes for files. Will be written back gradually or on fsync.
 	unwrittenBytes map[string]units.NumBytes
 
+	// When each file in unwrittenBytes was first written to since it was last fully written back,
+	// like the kernel's dirtied_when.
+	dirtiedAt map[string]time.Time
+
 	// If a file is closed while still having writes not yet written back to disk,
 	// record them here. If a file is closed we still need to write back data for it, as that
 	// will take up spare IO time that would otherwise be used for other files getting written back.
 	orphanedUnwrittenBytes units.NumBytes
 
+	// When the oldest data in orphanedUnwrittenBytes was written.
+	orphanedDirtiedAt time.Time
+
 	deviceConfig *slowfs.DeviceConfig
 }
 
 func newWriteBackCache(config *slowfs.DeviceConfig) *writeBackCache {
 	return &writeBackCache{
 		unwrittenBytes: make(map[string]units.NumBytes),
+		dirtiedAt:      make(map[string]time.Time),
 		deviceConfig:   config,
 	}
 }
 
 func (wbc *writeBackCache) close(path string) {
+	if wbc.unwrittenBytes[path] > 0 {
+		if wbc.orphanedUnwrittenBytes == 0 || wbc.dirtiedAt[path].Before(wbc.orphanedDirtiedAt) {
+			wbc.orphanedDirtiedAt = wbc.dirtiedAt[path]
+		}
+	}
 	wbc.orphanedUnwrittenBytes += wbc.unwrittenBytes[path]
-	delete(wbc.unwrittenBytes, path)
+	wbc.forget(path)
 }
 
-func (wbc *writeBackCache) write(path string, numBytes units.NumBytes) {
+// write records numBytes being written to the file at path at the given time.
+func (wbc *writeBackCache) write(path string, numBytes units.NumBytes, at time.Time) {
 	if numBytes > 0 {
+		if wbc.unwrittenBytes[path] == 0 {
+			wbc.dirtiedAt[path] = at
+		}
 		wbc.unwrittenBytes[path] += numBytes
 	}
 }
 
+// forget records that all data for the file at path has been written back.
+func (wbc *writeBackCache) forget(path string) {
+	delete(wbc.unwrittenBytes, path)
+	delete(wbc.dirtiedAt, path)
+}
+
 func (wbc *writeBackCache) getUnwrittenBytes(path string) units.NumBytes {
 	return wbc.unwrittenBytes[path]
 }
 
+// dirtyBytes returns how many bytes are waiting to be written back, for open and closed files.
+func (wbc *writeBackCache) dirtyBytes() units.NumBytes {
+	dirty := wbc.orphanedUnwrittenBytes
+	for _, bytes := range wbc.unwrittenBytes {
+		dirty += bytes
+	}
+	return dirty
+}
+
+// throttledBytes returns how many bytes have to be written back before a write of numBytes can
+// complete, like Linux's balance_dirty_pages. Writes aren't throttled until the cache is halfway
+// between DirtyBackgroundBytes and DirtyLimitBytes, and are then throttled more the closer it
+// gets to the limit. Beyond the limit, writes can only go as fast as the device writes back.
+func (wbc *writeBackCache) throttledBytes(numBytes units.NumBytes) units.NumBytes {
+	limit := wbc.deviceConfig.DirtyLimitBytes
+	if limit == 0 {
+		return 0
+	}
+	freerun := (wbc.deviceConfig.DirtyBackgroundBytes + limit) / 2
+	over := wbc.dirtyBytes() + numBytes - freerun
+	if over <= 0 {
+		return 0
+	}
+	if over >= limit-freerun {
+		return numBytes
+	}
+	return units.NumBytes(float64(numBytes) * float64(over) / float64(limit-freerun))
+}
+
+// writeBackBytes writes back numBytes, from closed files first and then from open files, oldest
+// first like the flusher.
+func (wbc *writeBackCache) writeBackBytes(numBytes units.NumBytes) {
+	orphaned := units.NumBytesMin(wbc.orphanedUnwrittenBytes, numBytes)
+	wbc.orphanedUnwrittenBytes -= orphaned
+	numBytes -= orphaned
+
+	for _, path := range wbc.dirtyFiles() {
+		if numBytes == 0 {
+			break
+		}
+		bytesToWrite := units.NumBytesMin(wbc.unwrittenBytes[path], numBytes)
+		wbc.unwrittenBytes[path] -= bytesToWrite
+		if wbc.unwrittenBytes[path] == 0 {
+			wbc.forget(path)
+		}
+		numBytes -= bytesToWrite
+	}
+}
+
 func (wbc *writeBackCache) writeBackFile(path string) {
-	delete(wbc.unwrittenBytes, path)
+	wbc.forget(path)
+}
+
+// writeBackFileBytes writes back up to numBytes of the file at path.
+func (wbc *writeBackCache) writeBackFileBytes(path string, numBytes units.NumBytes) {
+	wbc.unwrittenBytes[path] -= units.NumBytesMin(wbc.unwrittenBytes[path], numBytes)
+	if wbc.unwrittenBytes[path] == 0 {
+		wbc.forget(path)
+	}
+}
+
+// writeBackAll writes back everything, for open and closed files.
+func (wbc *writeBackCache) writeBackAll() {
+	wbc.unwrittenBytes = make(map[string]units.NumBytes)
+	wbc.dirtiedAt = make(map[string]time.Time)
+	wbc.orphanedUnwrittenBytes = 0
+}
+
+// entangled returns the open files whose data has to be written back when a journal commit is
+// forced by fsyncing the file at path, including that file, and whether closed files' data has to
+// be written back too. If the file at path has no data waiting, only its metadata is committed, so
+// nothing is written back.
+func (wbc *writeBackCache) entangled(path string) ([]string, bool) {
+	dirtiedAt, ok := wbc.dirtiedAt[path]
+	if !ok {
+		return nil, false
+	}
+	switch wbc.deviceConfig.JournalPolicy {
+	case slowfs.JournalAllFiles:
+		paths := make([]string, 0, len(wbc.unwrittenBytes))
+		for p := range wbc.unwrittenBytes {
+			paths = append(paths, p)
+		}
+		return paths, wbc.orphanedUnwrittenBytes > 0
+	case slowfs.JournalOlderFiles:
+		return wbc.expired(dirtiedAt), wbc.orphanedUnwrittenBytes > 0 && !wbc.orphanedDirtiedAt.After(dirtiedAt)
+	default:
+		return []string{path}, false
+	}
+}
+
+// entangledBytes returns how many bytes fsyncing the file at path writes back with a journal.
+func (wbc *writeBackCache) entangledBytes(path string) units.NumBytes {
+	paths, orphaned := wbc.entangled(path)
+	var bytes units.NumBytes
+	for _, p := range paths {
+		bytes += wbc.unwrittenBytes[p]
+	}
+	if orphaned {
+		bytes += wbc.orphanedUnwrittenBytes
+	}
+	return bytes
+}
+
+// writeBackEntangled writes back the file at path, along with whatever else a journal commit
+// forces to be written back.
+func (wbc *writeBackCache) writeBackEntangled(path string) {
+	paths, orphaned := wbc.entangled(path)
+	for _, p := range paths {
+		wbc.forget(p)
+	}
+	if orphaned {
+		wbc.orphanedUnwrittenBytes = 0
+	}
+}
+
+// expired returns the open files with data that has been waiting to be written back since before
+// the given time, oldest first.
+func (wbc *writeBackCache) expired(before time.Time) []string {
+	var paths []string
+	for _, path := range wbc.dirtyFiles() {
+		if wbc.dirtiedAt[path].After(before) {
+			break
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// dirtyFiles returns the open files with data waiting to be written back, oldest first.
+func (wbc *writeBackCache) dirtyFiles() []string {
+	paths := make([]string, 0, len(wbc.dirtiedAt))
+	for path := range wbc.dirtiedAt {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := wbc.dirtiedAt[paths[i]], wbc.dirtiedAt[paths[j]]
+		return a.Before(b) || (a.Equal(b) && paths[i] < paths[j])
+	})
+	return paths
+}
+
+// oldestDirtiedAt returns when the oldest data waiting to be written back was written, or false
+// if there isn't any.
+func (wbc *writeBackCache) oldestDirtiedAt() (time.Time, bool) {
+	var oldest time.Time
+	found := wbc.orphanedUnwrittenBytes > 0
+	if found {
+		oldest = wbc.orphanedDirtiedAt
+	}
+	for _, dirtiedAt := range wbc.dirtiedAt {
+		if !found || dirtiedAt.Before(oldest) {
+			oldest, found = dirtiedAt, true
+		}
+	}
+	return oldest, found
 }
 
 func (wbc *writeBackCache) writeBack(duration time.Duration) {
@@ -91,7 +269,7 @@ func (wbc *writeBackCache) writeBackBytesForFile(path string, duration time.Dura
 
 	wbc.unwrittenBytes[path] -= bytesToWrite
 	if wbc.unwrittenBytes[path] == 0 {
-		delete(wbc.unwrittenBytes, path)
+		wbc.forget(path)
 	}
 	return timeTaken
 }
@@ -32,7 +32,7 @@ func TestWriteBackCache_Write(t *testing.T) {
 
 	writeBackCache := newWriteBackCache(basicDeviceConfig)
 	for _, c := range cases {
-		writeBackCache.write(c.path, c.numBytes)
+		writeBackCache.write(c.path, c.numBytes, startTime)
 		if got, want := writeBackCache.getUnwrittenBytes(c.path), c.want; got != want {
 			t.Errorf("getUnwrittenBytes(%s) = %d, want %d", c.path, got, want)
 		}
@@ -48,7 +48,7 @@ func TestWriteBackCache_Close(t *testing.T) {
 
 	writeBackCache := newWriteBackCache(basicDeviceConfig)
 	for _, c := range cases {
-		writeBackCache.write(c.path, c.numBytes)
+		writeBackCache.write(c.path, c.numBytes, startTime)
 		writeBackCache.close(c.path)
 
 		if got, want := writeBackCache.getUnwrittenBytes(c.path), units.NumBytes(0); got != want {
@@ -126,7 +126,7 @@ func TestWriteBackCache_WriteBack(t *testing.T) {
 	for _, c := range cases {
 		writeBackCache := newWriteBackCache(basicDeviceConfig)
 		for _, write := range c.writes {
-			writeBackCache.write(write.path, write.numBytes)
+			writeBackCache.write(write.path, write.numBytes, startTime)
 			if write.shouldClose {
 				writeBackCache.close(write.path)
 			}
@@ -222,7 +222,7 @@ func TestWriteBackCache_WriteBackBytesForFile(t *testing.T) {
 
 	for _, c := range cases {
 		writeBackCache := newWriteBackCache(c.deviceConfig)
-		writeBackCache.write("a", c.numBytes)
+		writeBackCache.write("a", c.numBytes, startTime)
 
 		if got, want := writeBackCache.writeBackBytesForFile("a", c.duration), c.wantDuration; got != want {
 			t.Errorf("fail (%s) writeBackBytesForFile(\"a\", %s) = %s, want %s", c.desc, c.duration, got, want)
@@ -272,3 +272,139 @@ func TestSliceShuffle(t *testing.T) {
 		t.Errorf("sliceShuffle failed: %v -> %v", a, acopy)
 	}
 }
+
+func TestWriteBackCache_ThrottledBytes(t *testing.T) {
+	cases := []struct {
+		desc         string
+		deviceConfig *slowfs.DeviceConfig
+		dirty        units.NumBytes
+		numBytes     units.NumBytes
+		want         units.NumBytes
+	}{
+		{"no limit", writeBackCacheDeviceConfig, 1000, 10, 0},
+		{"well under limit", dirtyThrottleDeviceConfig, 0, 10, 0},
+		{"up to freerun", dirtyThrottleDeviceConfig, 10, 10, 0},
+		{"halfway to limit", dirtyThrottleDeviceConfig, 15, 10, 5},
+		{"past limit", dirtyThrottleDeviceConfig, 25, 10, 10},
+		{"well past limit", dirtyThrottleDeviceConfig, 100, 4, 4},
+	}
+
+	for _, c := range cases {
+		writeBackCache := newWriteBackCache(c.deviceConfig)
+		writeBackCache.write("a", c.dirty, startTime)
+		if got, want := writeBackCache.throttledBytes(c.numBytes), c.want; got != want {
+			t.Errorf("fail (%s) throttledBytes(%d) with %d dirty = %d, want %d", c.desc, c.numBytes, c.dirty,
+				got, want)
+		}
+	}
+}
+
+func TestWriteBackCache_WriteBackBytes(t *testing.T) {
+	cases := []struct {
+		numBytes      units.NumBytes
+		wantOrphaned  units.NumBytes
+		wantRemaining units.NumBytes
+	}{{0, 5, 25}, {3, 2, 25}, {5, 0, 25}, {15, 0, 15}, {100, 0, 0}}
+
+	for _, c := range cases {
+		writeBackCache := newWriteBackCache(writeBackCacheDeviceConfig)
+		writeBackCache.write("a", 5, startTime)
+		writeBackCache.close("a")
+		writeBackCache.write("b", 10, startTime)
+		writeBackCache.write("c", 15, startTime)
+
+		writeBackCache.writeBackBytes(c.numBytes)
+		if got, want := writeBackCache.orphanedUnwrittenBytes, c.wantOrphaned; got != want {
+			t.Errorf("writeBackBytes(%d) left orphanedUnwrittenBytes = %d, want %d", c.numBytes, got, want)
+		}
+		if got, want := writeBackCache.dirtyBytes()-writeBackCache.orphanedUnwrittenBytes, c.wantRemaining; got != want {
+			t.Errorf("writeBackBytes(%d) left %d unwritten bytes for open files, want %d", c.numBytes, got, want)
+		}
+	}
+}
+
+func TestWriteBackCache_WriteBackBytesOldestFirst(t *testing.T) {
+	writeBackCache := newWriteBackCache(writeBackCacheDeviceConfig)
+	writeBackCache.write("c", 10, startTime.Add(2*time.Second))
+	writeBackCache.write("a", 10, startTime.Add(3*time.Second))
+	writeBackCache.write("b", 10, startTime.Add(1*time.Second))
+
+	writeBackCache.writeBackBytes(15)
+	for path, want := range map[string]units.NumBytes{"a": 10, "b": 0, "c": 5} {
+		if got := writeBackCache.getUnwrittenBytes(path); got != want {
+			t.Errorf("writeBackBytes(15) left %d unwritten bytes for %s, want %d", got, path, want)
+		}
+	}
+}
+
+func TestWriteBackCache_Expired(t *testing.T) {
+	writeBackCache := newWriteBackCache(writeBackCacheDeviceConfig)
+	writeBackCache.write("c", 1, startTime.Add(2*time.Second))
+	writeBackCache.write("a", 1, startTime.Add(3*time.Second))
+	writeBackCache.write("b", 1, startTime.Add(1*time.Second))
+	writeBackCache.write("d", 1, startTime.Add(2*time.Second))
+	// Only the first write since being written back counts.
+	writeBackCache.write("b", 1, startTime.Add(5*time.Second))
+	writeBackCache.write("e", 0, startTime)
+
+	cases := []struct {
+		before time.Time
+		want   []string
+	}{
+		{startTime, nil},
+		{startTime.Add(1 * time.Second), []string{"b"}},
+		{startTime.Add(2 * time.Second), []string{"b", "c", "d"}},
+		{startTime.Add(time.Minute), []string{"b", "c", "d", "a"}},
+	}
+
+	for _, c := range cases {
+		if got := writeBackCache.expired(c.before); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expired(%s) = %v, want %v", c.before, got, c.want)
+		}
+	}
+
+	writeBackCache.close("c")
+	writeBackCache.writeBackFile("b")
+	if got, ok := writeBackCache.oldestDirtiedAt(); !ok || !got.Equal(startTime.Add(2*time.Second)) {
+		t.Errorf("oldestDirtiedAt() = %s, %t, want %s, true", got, ok, startTime.Add(2*time.Second))
+	}
+	if got := writeBackCache.expired(startTime.Add(time.Minute)); !reflect.DeepEqual(got, []string{"d", "a"}) {
+		t.Errorf("expired() after close = %v, want [d a]", got)
+	}
+}
+
+func TestWriteBackCache_EntangledBytes(t *testing.T) {
+	cases := []struct {
+		policy slowfs.JournalPolicy
+		path   string
+		want   units.NumBytes
+	}{
+		{slowfs.JournalAllFiles, "b", 65},
+		{slowfs.JournalAllFiles, "e", 0},
+		{slowfs.JournalOlderFiles, "b", 30},
+		{slowfs.JournalOlderFiles, "d", 65},
+		{slowfs.JournalOlderFiles, "e", 0},
+		{slowfs.JournalFileOnly, "b", 20},
+		{slowfs.JournalFileOnly, "e", 0},
+	}
+
+	for _, c := range cases {
+		config := *journaledDeviceConfig
+		config.JournalPolicy = c.policy
+		writeBackCache := newWriteBackCache(&config)
+		writeBackCache.write("a", 10, startTime.Add(1*time.Second))
+		writeBackCache.write("b", 20, startTime.Add(2*time.Second))
+		writeBackCache.write("c", 30, startTime.Add(3*time.Second))
+		writeBackCache.close("c")
+		writeBackCache.write("d", 5, startTime.Add(4*time.Second))
+
+		if got, want := writeBackCache.entangledBytes(c.path), c.want; got != want {
+			t.Errorf("entangledBytes(%s) with %s = %s, want %s", c.path, c.policy, got, want)
+		}
+		before := writeBackCache.dirtyBytes()
+		writeBackCache.writeBackEntangled(c.path)
+		if got, want := writeBackCache.dirtyBytes(), before-c.want; got != want {
+			t.Errorf("dirtyBytes() after writeBackEntangled(%s) with %s = %s, want %s", c.path, c.policy, got, want)
+		}
+	}
+}
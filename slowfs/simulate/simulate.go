@@ -0,0 +1,130 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simulate replays traces of requests against a device config in simulated time, to
+// predict how a workload would perform on a device without running it.
+package simulate
+
+import (
+	"fmt"
+	"io"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/trace"
+	"sort"
+	"time"
+)
+
+// Result describes how the requests in a trace performed.
+type Result struct {
+	// How many requests there were, and the time from the first arriving to the last finishing.
+	Requests int
+	Runtime  time.Duration
+	// How long each request took by type, from shortest to longest.
+	Durations map[scheduler.RequestType][]time.Duration
+}
+
+// Run replays the requests in records through a scheduler using config, and reports how long
+// they took. Each request arrives at the time recorded for it, whether or not earlier requests
+// have finished. Requests are handed to the scheduler one at a time, so they are never reordered.
+func Run(config *slowfs.DeviceConfig, records []*trace.Record) *Result {
+	result := &Result{
+		Requests:  len(records),
+		Durations: make(map[scheduler.RequestType][]time.Duration),
+	}
+	if len(records) == 0 {
+		return result
+	}
+
+	sorted := make([]*trace.Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Arrival.Before(sorted[j].Arrival)
+	})
+
+	start := sorted[0].Arrival
+	clk := clock.NewSimulatedClock(start)
+	s := scheduler.NewWithClock(config, clk)
+	defer s.Close()
+	end := start
+	for _, r := range sorted {
+		clk.AdvanceTo(r.Arrival)
+		duration := s.Schedule(r.Request())
+		result.Durations[r.Type] = append(result.Durations[r.Type], duration)
+		if finish := r.Arrival.Add(duration); finish.After(end) {
+			end = finish
+		}
+	}
+	result.Runtime = end.Sub(start)
+
+	for _, durations := range result.Durations {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	}
+	return result
+}
+
+// Percentile returns the duration that p percent of requests of the given type took at most, or 0
+// if there weren't any.
+func (r *Result) Percentile(reqType scheduler.RequestType, p float64) time.Duration {
+	durations := r.Durations[reqType]
+	if len(durations) == 0 {
+		return 0
+	}
+	idx := int(p / 100 * float64(len(durations)))
+	if idx >= len(durations) {
+		idx = len(durations) - 1
+	}
+	return durations[idx]
+}
+
+// Stalls returns how many requests of the given type took longer than threshold, and how long
+// they took in total.
+func (r *Result) Stalls(reqType scheduler.RequestType, threshold time.Duration) (int, time.Duration) {
+	var count int
+	var total time.Duration
+	for _, d := range r.Durations[reqType] {
+		if d > threshold {
+			count++
+			total += d
+		}
+	}
+	return count, total
+}
+
+// WriteReport writes a human readable summary of the result to w, counting fsyncs that took
+// longer than stallThreshold as stalls.
+func (r *Result) WriteReport(w io.Writer, stallThreshold time.Duration) error {
+	if _, err := fmt.Fprintf(w, "requests: %d\nruntime: %s\n", r.Requests, r.Runtime); err != nil {
+		return err
+	}
+
+	types := make([]scheduler.RequestType, 0, len(r.Durations))
+	for t := range r.Durations {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, t := range types {
+		durations := r.Durations[t]
+		_, err := fmt.Fprintf(w, "%s: count %d, p50 %s, p90 %s, p99 %s, max %s\n", t, len(durations),
+			r.Percentile(t, 50), r.Percentile(t, 90), r.Percentile(t, 99), durations[len(durations)-1])
+		if err != nil {
+			return err
+		}
+	}
+
+	stalls, stalled := r.Stalls(scheduler.FsyncRequest, stallThreshold)
+	_, err := fmt.Fprintf(w, "fsync stalls over %s: %d, taking %s\n", stallThreshold, stalls, stalled)
+	return err
+}
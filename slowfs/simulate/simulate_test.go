@@ -0,0 +1,116 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulate
+
+import (
+	"bytes"
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/trace"
+	"slowfs/slowfs/units"
+	"strings"
+	"testing"
+	"time"
+)
+
+var startTime = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+var testDeviceConfig = &slowfs.DeviceConfig{
+	SeekWindow:             4 * units.Byte,
+	SeekTime:               10 * time.Millisecond,
+	ReadBytesPerSecond:     100 * units.Byte,
+	WriteBytesPerSecond:    100 * units.Byte,
+	AllocateBytesPerSecond: 1000 * units.Byte,
+	RequestReorderMaxDelay: 0,
+	FsyncStrategy:          slowfs.DumbFsync,
+	WriteStrategy:          slowfs.SimulateWrite,
+	MetadataOpTime:         80 * time.Millisecond,
+}
+
+// Out of order, to check they get sorted by arrival.
+var testRecords = []*trace.Record{
+	{Type: scheduler.ReadRequest, Path: "b", Offset: 0, Size: 10, Arrival: startTime.Add(450 * time.Millisecond)},
+	{Type: scheduler.ReadRequest, Path: "a", Offset: 0, Size: 10, Arrival: startTime},
+	{Type: scheduler.ReadRequest, Path: "a", Offset: 10, Size: 10, Arrival: startTime.Add(200 * time.Millisecond)},
+	{Type: scheduler.FsyncRequest, Path: "a", Arrival: startTime.Add(400 * time.Millisecond)},
+}
+
+func TestRun(t *testing.T) {
+	result := Run(testDeviceConfig, testRecords)
+
+	if got, want := result.Requests, 4; got != want {
+		t.Errorf("Requests = %d, want %d", got, want)
+	}
+	// The last read has to wait for the fsync to finish at 500ms, then seeks and reads.
+	if got, want := result.Runtime, 610*time.Millisecond; got != want {
+		t.Errorf("Runtime = %s, want %s", got, want)
+	}
+	wantDurations := map[scheduler.RequestType][]time.Duration{
+		scheduler.ReadRequest:  {100 * time.Millisecond, 110 * time.Millisecond, 160 * time.Millisecond},
+		scheduler.FsyncRequest: {100 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(result.Durations, wantDurations) {
+		t.Errorf("Durations = %v, want %v", result.Durations, wantDurations)
+	}
+
+	if result := Run(testDeviceConfig, nil); result.Requests != 0 || result.Runtime != 0 {
+		t.Errorf("Run(no records) = %+v, want nothing", result)
+	}
+}
+
+func TestResult_Percentile(t *testing.T) {
+	result := &Result{
+		Durations: map[scheduler.RequestType][]time.Duration{
+			scheduler.ReadRequest: {1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		},
+	}
+
+	cases := []struct {
+		reqType scheduler.RequestType
+		p       float64
+		want    time.Duration
+	}{
+		{scheduler.ReadRequest, 0, 1},
+		{scheduler.ReadRequest, 50, 6},
+		{scheduler.ReadRequest, 90, 10},
+		{scheduler.ReadRequest, 100, 10},
+		{scheduler.WriteRequest, 50, 0},
+	}
+
+	for _, c := range cases {
+		if got := result.Percentile(c.reqType, c.p); got != c.want {
+			t.Errorf("Percentile(%s, %g) = %d, want %d", c.reqType, c.p, got, c.want)
+		}
+	}
+}
+
+func TestResult_WriteReport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Run(testDeviceConfig, testRecords).WriteReport(&buf, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"requests: 4",
+		"runtime: 610ms",
+		"read: count 3, p50 110ms, p90 160ms, p99 160ms, max 160ms",
+		"fsync: count 1, p50 100ms, p90 100ms, p99 100ms, max 100ms",
+		"fsync stalls over 50ms: 1, taking 100ms",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("WriteReport() = %q, want %q", got, want)
+	}
+}
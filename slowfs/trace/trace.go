@@ -0,0 +1,451 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace reads and writes traces of the requests a scheduler handles, either as newline
+// delimited JSON, or in a compact binary format.
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slowfs/slowfs/scheduler"
+	"slowfs/slowfs/units"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format is the encoding of a trace.
+type Format int
+
+// Format options.
+const (
+	// JSONFormat has one JSON object per line, with durations in nanoseconds.
+	JSONFormat Format = iota
+	// BinaryFormat is a header followed by varint encoded records.
+	BinaryFormat
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSONFormat:
+		return "JSONFormat"
+	case BinaryFormat:
+		return "BinaryFormat"
+	}
+	return "UnknownFormat"
+}
+
+// ParseFormatFromString parses a string into a Format. Case insensitive.
+func ParseFormatFromString(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "jsonformat", "json":
+		return JSONFormat, nil
+	case "binaryformat", "binary":
+		return BinaryFormat, nil
+	}
+	return JSONFormat, fmt.Errorf("unknown trace format %s", s)
+}
+
+// Binary traces start with this, followed by a version byte. Version 2 added request flags and
+// callers to each record; version 1 traces can still be read.
+const binaryMagic = "SLOWFSTR"
+const binaryVersion = 2
+
+// maxPathLen is the longest path, or process name, binary records can have, PATH_MAX on Linux.
+// Longer lengths are taken as corruption, rather than trusted with allocating that much memory.
+const maxPathLen = 4096
+
+// Flags in binary records.
+const (
+	seekFlag = 1 << iota
+	reorderedFlag
+)
+
+// Record describes one request.
+type Record struct {
+	Type   scheduler.RequestType
+	Path   string
+	Offset units.NumBytes
+	Size   units.NumBytes
+	// When the request arrived at the scheduler.
+	Arrival time.Time
+	// When the request was sent to the device, after any time spent queued for reordering.
+	Dispatched time.Time
+	// How long the request took, from its arrival.
+	Duration  time.Duration
+	Seek      bool
+	Reordered bool
+	// The flags the request's file was opened with, and who made the request.
+	Flags scheduler.RequestFlags
+	scheduler.Caller
+}
+
+// NewRecord creates a Record describing the request in e.
+func NewRecord(e *scheduler.Event) *Record {
+	return &Record{
+		Type:       e.Request.Type,
+		Path:       e.Request.Path,
+		Offset:     e.Request.Start,
+		Size:       e.Request.Size,
+		Arrival:    e.Request.Timestamp,
+		Dispatched: e.Dispatched,
+		Duration:   e.Duration,
+		Seek:       e.Seek,
+		Reordered:  e.Reordered,
+		Flags:      e.Request.Flags,
+		Caller:     e.Request.Caller,
+	}
+}
+
+// Request returns the request r describes.
+func (r *Record) Request() *scheduler.Request {
+	return &scheduler.Request{
+		Type:      r.Type,
+		Timestamp: r.Arrival,
+		Path:      r.Path,
+		Start:     r.Offset,
+		Size:      r.Size,
+		Flags:     r.Flags,
+		Caller:    r.Caller,
+	}
+}
+
+// jsonRecord is how a Record is written in JSON traces.
+type jsonRecord struct {
+	Type       string
+	Path       string `json:",omitempty"`
+	Offset     units.NumBytes
+	Size       units.NumBytes
+	Arrival    time.Time
+	Dispatched time.Time
+	Duration   time.Duration
+	Seek       bool
+	Reordered  bool
+	Flags      string `json:",omitempty"`
+	Pid        uint32 `json:",omitempty"`
+	Uid        uint32 `json:",omitempty"`
+	Gid        uint32 `json:",omitempty"`
+	Process    string `json:",omitempty"`
+}
+
+// Writer writes a trace. It is also a scheduler.Observer, so it can record everything a scheduler
+// does. It is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+
+	format Format
+	w      *bufio.Writer
+	// Buffer for encoding binary records.
+	buf []byte
+	// The first error from Observe, which has no way of returning it.
+	err error
+}
+
+// NewWriter creates a Writer that writes records to w in the given format. Records are buffered,
+// so Flush must be called once done.
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	tw := &Writer{
+		format: format,
+		w:      bufio.NewWriter(w),
+	}
+	if format == BinaryFormat {
+		if _, err := tw.w.WriteString(binaryMagic); err != nil {
+			return nil, err
+		}
+		if err := tw.w.WriteByte(binaryVersion); err != nil {
+			return nil, err
+		}
+	}
+	return tw, nil
+}
+
+// Write writes a record to the trace.
+func (tw *Writer) Write(r *Record) error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	switch tw.format {
+	case JSONFormat:
+		data, err := json.Marshal(&jsonRecord{
+			Type:       r.Type.String(),
+			Path:       r.Path,
+			Offset:     r.Offset,
+			Size:       r.Size,
+			Arrival:    r.Arrival,
+			Dispatched: r.Dispatched,
+			Duration:   r.Duration,
+			Seek:       r.Seek,
+			Reordered:  r.Reordered,
+			Flags:      r.Flags.String(),
+			Pid:        r.Pid,
+			Uid:        r.Uid,
+			Gid:        r.Gid,
+			Process:    r.Process,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.w.Write(data); err != nil {
+			return err
+		}
+		return tw.w.WriteByte('\n')
+	case BinaryFormat:
+		var flags byte
+		if r.Seek {
+			flags |= seekFlag
+		}
+		if r.Reordered {
+			flags |= reorderedFlag
+		}
+		tw.buf = append(tw.buf[:0], byte(r.Type), flags)
+		tw.buf = appendUvarint(tw.buf, uint64(len(r.Path)))
+		tw.buf = append(tw.buf, r.Path...)
+		tw.buf = appendVarint(tw.buf, int64(r.Offset))
+		tw.buf = appendVarint(tw.buf, int64(r.Size))
+		// Seconds and nanoseconds, as UnixNano can't represent all times.
+		tw.buf = appendVarint(tw.buf, r.Arrival.Unix())
+		tw.buf = appendUvarint(tw.buf, uint64(r.Arrival.Nanosecond()))
+		tw.buf = appendVarint(tw.buf, int64(r.Dispatched.Sub(r.Arrival)))
+		tw.buf = appendVarint(tw.buf, int64(r.Duration))
+		tw.buf = appendUvarint(tw.buf, uint64(r.Flags))
+		tw.buf = appendUvarint(tw.buf, uint64(r.Pid))
+		tw.buf = appendUvarint(tw.buf, uint64(r.Uid))
+		tw.buf = appendUvarint(tw.buf, uint64(r.Gid))
+		tw.buf = appendUvarint(tw.buf, uint64(len(r.Process)))
+		tw.buf = append(tw.buf, r.Process...)
+		_, err := tw.w.Write(tw.buf)
+		return err
+	}
+	return fmt.Errorf("unknown trace format %s", tw.format)
+}
+
+// Observe writes a record of the request in e. Errors are logged the first time they happen, and
+// returned by Flush.
+func (tw *Writer) Observe(e *scheduler.Event) {
+	if err := tw.Write(NewRecord(e)); err != nil {
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		if tw.err == nil {
+			log.Printf("couldn't write trace: %s\n", err)
+			tw.err = err
+		}
+	}
+}
+
+// Flush writes any buffered records. It returns the first error seen by Observe, if any.
+func (tw *Writer) Flush() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if err := tw.w.Flush(); err != nil {
+		return err
+	}
+	return tw.err
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+// Reader reads a trace in either format.
+type Reader struct {
+	format Format
+	// The version of a binary trace.
+	version byte
+	r       *bufio.Reader
+}
+
+// NewReader creates a Reader for the trace in r, working out which format it is in.
+func NewReader(r io.Reader) (*Reader, error) {
+	tr := &Reader{
+		format: JSONFormat,
+		r:      bufio.NewReader(r),
+	}
+	header, err := tr.r.Peek(len(binaryMagic) + 1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.HasPrefix(header, []byte(binaryMagic)) {
+		if len(header) <= len(binaryMagic) || header[len(binaryMagic)] < 1 || header[len(binaryMagic)] > binaryVersion {
+			return nil, errors.New("unsupported binary trace version")
+		}
+		tr.r.Discard(len(header))
+		tr.format = BinaryFormat
+		tr.version = header[len(binaryMagic)]
+	}
+	return tr, nil
+}
+
+// Format returns the format of the trace being read.
+func (tr *Reader) Format() Format {
+	return tr.format
+}
+
+// Read returns the next record in the trace, or io.EOF if there are no more.
+func (tr *Reader) Read() (*Record, error) {
+	if tr.format == JSONFormat {
+		return tr.readJSON()
+	}
+	return tr.readBinary()
+}
+
+func (tr *Reader) readJSON() (*Record, error) {
+	for {
+		line, err := tr.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var jr jsonRecord
+		if err := json.Unmarshal(line, &jr); err != nil {
+			return nil, fmt.Errorf("bad trace record %s: %s", line, err)
+		}
+		reqType, err := scheduler.ParseRequestTypeFromString(jr.Type)
+		if err != nil {
+			return nil, fmt.Errorf("bad trace record %s: %s", line, err)
+		}
+		flags, err := scheduler.ParseRequestFlagsFromString(jr.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("bad trace record %s: %s", line, err)
+		}
+		return &Record{
+			Type:       reqType,
+			Path:       jr.Path,
+			Offset:     jr.Offset,
+			Size:       jr.Size,
+			Arrival:    jr.Arrival,
+			Dispatched: jr.Dispatched,
+			Duration:   jr.Duration,
+			Seek:       jr.Seek,
+			Reordered:  jr.Reordered,
+			Flags:      flags,
+			Caller:     scheduler.Caller{Pid: jr.Pid, Uid: jr.Uid, Gid: jr.Gid, Process: jr.Process},
+		}, nil
+	}
+}
+
+func (tr *Reader) readBinary() (*Record, error) {
+	reqType, err := tr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Past the first byte, running out of trace is an error.
+	record, err := tr.readBinaryRest(scheduler.RequestType(reqType))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return record, err
+}
+
+func (tr *Reader) readBinaryRest(reqType scheduler.RequestType) (*Record, error) {
+	flags, err := tr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	path, err := tr.readString("path")
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the remaining fields, stopping at the first error.
+	varint := func() int64 {
+		var v int64
+		if err == nil {
+			v, err = binary.ReadVarint(tr.r)
+		}
+		return v
+	}
+	offset := varint()
+	size := varint()
+	arrivalSeconds := varint()
+	var arrivalNanos uint64
+	if err == nil {
+		arrivalNanos, err = binary.ReadUvarint(tr.r)
+	}
+	dispatchDelay := varint()
+	duration := varint()
+	if err != nil {
+		return nil, err
+	}
+
+	var reqFlags uint64
+	var caller scheduler.Caller
+	if tr.version >= 2 {
+		uvarint := func() uint64 {
+			var v uint64
+			if err == nil {
+				v, err = binary.ReadUvarint(tr.r)
+			}
+			return v
+		}
+		reqFlags = uvarint()
+		caller.Pid = uint32(uvarint())
+		caller.Uid = uint32(uvarint())
+		caller.Gid = uint32(uvarint())
+		if err == nil {
+			caller.Process, err = tr.readString("process name")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	arrival := time.Unix(arrivalSeconds, int64(arrivalNanos))
+	return &Record{
+		Type:       reqType,
+		Path:       path,
+		Offset:     units.NumBytes(offset),
+		Size:       units.NumBytes(size),
+		Arrival:    arrival,
+		Dispatched: arrival.Add(time.Duration(dispatchDelay)),
+		Duration:   time.Duration(duration),
+		Seek:       flags&seekFlag != 0,
+		Reordered:  flags&reorderedFlag != 0,
+		Flags:      scheduler.RequestFlags(reqFlags),
+		Caller:     caller,
+	}, nil
+}
+
+// readString reads a length prefixed string from a binary record, described by name in errors.
+func (tr *Reader) readString(name string) (string, error) {
+	n, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return "", err
+	}
+	if n > maxPathLen {
+		return "", fmt.Errorf("bad trace record: %s length %d is longer than %d", name, n, maxPathLen)
+	}
+	s := make([]byte, n)
+	if _, err := io.ReadFull(tr.r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
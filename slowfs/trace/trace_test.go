@@ -0,0 +1,250 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"slowfs/slowfs"
+	"slowfs/slowfs/clock"
+	"slowfs/slowfs/scheduler"
+	"testing"
+	"time"
+)
+
+var startTime = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+
+var testRecords = []*Record{
+	{
+		Type:       scheduler.WriteRequest,
+		Path:       "dir/file",
+		Offset:     4096,
+		Size:       512,
+		Arrival:    startTime,
+		Dispatched: startTime.Add(3 * time.Millisecond),
+		Duration:   15 * time.Millisecond,
+		Seek:       true,
+		Reordered:  true,
+		Flags:      scheduler.SyncFlag | scheduler.DirectFlag,
+		Caller:     scheduler.Caller{Pid: 42, Uid: 1000, Gid: 100, Process: "postgres"},
+	},
+	{
+		Type:       scheduler.MetadataRequest,
+		Arrival:    startTime.Add(time.Second),
+		Dispatched: startTime.Add(time.Second),
+		Duration:   time.Millisecond,
+	},
+	{
+		Type:       scheduler.ReadRequest,
+		Path:       "file",
+		Size:       1,
+		Arrival:    time.Time{},
+		Dispatched: time.Time{},
+	},
+}
+
+func TestFormat_String(t *testing.T) {
+	cases := []struct {
+		format Format
+		want   string
+	}{
+		{JSONFormat, "JSONFormat"},
+		{BinaryFormat, "BinaryFormat"},
+		{12345, "UnknownFormat"},
+	}
+
+	for _, c := range cases {
+		if got, want := c.format.String(), c.want; got != want {
+			t.Errorf("%d.String() = %s, want %s", c.format, got, want)
+		}
+	}
+}
+
+func TestParseFormatFromString(t *testing.T) {
+	cases := []struct {
+		s       string
+		want    Format
+		wantErr bool
+	}{
+		{"json", JSONFormat, false},
+		{"JSONFormat", JSONFormat, false},
+		{"Binary", BinaryFormat, false},
+		{"binaryformat", BinaryFormat, false},
+		{"chicken", JSONFormat, true},
+	}
+
+	for _, c := range cases {
+		got, err := ParseFormatFromString(c.s)
+		if c.wantErr != (err != nil) {
+			t.Errorf("ParseFormatFromString(%s) error = %v, want error: %t", c.s, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("ParseFormatFromString(%s) = %s, want %s", c.s, got, c.want)
+		}
+	}
+}
+
+func writeTrace(t *testing.T, format Format, records []*Record) []byte {
+	var buf bytes.Buffer
+	tw, err := NewWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := tw.Write(r); err != nil {
+			t.Fatalf("Write(%+v) error: %s", r, err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readTrace(t *testing.T, data []byte, wantFormat Format) []*Record {
+	tr, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tr.Format(), wantFormat; got != want {
+		t.Errorf("Format() = %s, want %s", got, want)
+	}
+
+	var records []*Record
+	for {
+		r, err := tr.Read()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Read() error: %s", err)
+		}
+		records = append(records, r)
+	}
+}
+
+// equalRecords compares records, treating times in different locations as equal.
+func equalRecords(a, b *Record) bool {
+	if !a.Arrival.Equal(b.Arrival) || !a.Dispatched.Equal(b.Dispatched) {
+		return false
+	}
+	ac, bc := *a, *b
+	ac.Arrival, bc.Arrival = time.Time{}, time.Time{}
+	ac.Dispatched, bc.Dispatched = time.Time{}, time.Time{}
+	return reflect.DeepEqual(ac, bc)
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{JSONFormat, BinaryFormat} {
+		got := readTrace(t, writeTrace(t, format, testRecords), format)
+		if len(got) != len(testRecords) {
+			t.Fatalf("%s trace read back %d records, want %d", format, len(got), len(testRecords))
+		}
+		for i := range got {
+			if !equalRecords(got[i], testRecords[i]) {
+				t.Errorf("%s trace record %d = %+v, want %+v", format, i, got[i], testRecords[i])
+			}
+		}
+	}
+}
+
+func TestReader_Version1(t *testing.T) {
+	// A read of 1 byte of "a" at offset 2, arriving at 3s and 4ns past the epoch, dispatched 5ns
+	// later and taking 6ns, from before flags and callers were recorded.
+	data := []byte(binaryMagic + "\x01\x00\x01\x01a\x04\x02\x06\x04\x0a\x0c")
+	got := readTrace(t, data, BinaryFormat)
+	arrival := time.Unix(3, 4)
+	want := &Record{
+		Type:       scheduler.ReadRequest,
+		Path:       "a",
+		Offset:     2,
+		Size:       1,
+		Arrival:    arrival,
+		Dispatched: arrival.Add(5),
+		Duration:   6,
+		Seek:       true,
+	}
+	if len(got) != 1 || !equalRecords(got[0], want) {
+		t.Errorf("version 1 trace read as %+v, want [%+v]", got, want)
+	}
+}
+
+func TestReader_Errors(t *testing.T) {
+	binaryTrace := writeTrace(t, BinaryFormat, testRecords[:1])
+
+	cases := []struct {
+		desc string
+		data []byte
+	}{
+		{"truncated binary", binaryTrace[:len(binaryTrace)-1]},
+		{"huge binary path", append([]byte(binaryMagic+"\x01\x00\x00"), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f)},
+		{"bad json", []byte("{\"Type\": \"read\"\n")},
+		{"bad request type", []byte(`{"Type": "chicken"}` + "\n")},
+		{"bad flags", []byte(`{"Type": "write", "Flags": "chicken"}` + "\n")},
+	}
+
+	for _, c := range cases {
+		tr, err := NewReader(bytes.NewReader(c.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.Read(); err == nil || err == io.EOF {
+			t.Errorf("fail (%s) Read() error = %v, want error", c.desc, err)
+		}
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte(binaryMagic + "\x09"))); err == nil {
+		t.Errorf("NewReader(unknown binary version) should fail")
+	}
+}
+
+func TestWriter_Observe(t *testing.T) {
+	config := slowfs.HDD7200RpmDeviceConfig
+	s := scheduler.NewWithClock(&config, clock.NewSimulatedClock(startTime))
+	var buf bytes.Buffer
+	tw, err := NewWriter(&buf, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddObserver(tw)
+
+	req := &scheduler.Request{Type: scheduler.ReadRequest, Timestamp: startTime, Path: "a", Size: 10,
+		Flags: scheduler.DirectFlag, Caller: scheduler.Caller{Pid: 1, Uid: 2, Gid: 3, Process: "cat"}}
+	duration := s.Schedule(req)
+	s.Pause() // Wait for the event loop to observe the request.
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readTrace(t, buf.Bytes(), BinaryFormat)
+	if len(got) != 1 {
+		t.Fatalf("trace has %d records, want 1", len(got))
+	}
+	gotReq := got[0].Request()
+	if !gotReq.Timestamp.Equal(req.Timestamp) {
+		t.Errorf("trace has request timestamp %s, want %s", gotReq.Timestamp, req.Timestamp)
+	}
+	gotReq.Timestamp = req.Timestamp
+	if !reflect.DeepEqual(gotReq, req) {
+		t.Errorf("trace has request %+v, want %+v", gotReq, req)
+	}
+	if got, want := got[0].Duration, duration; got != want {
+		t.Errorf("trace has duration %s, want %s", got, want)
+	}
+	if !got[0].Seek {
+		t.Errorf("trace says the first read didn't seek")
+	}
+}
@@ -45,6 +45,14 @@ func NumBytesMin(a, b NumBytes) NumBytes {
 	return a
 }
 
+// NumBytesMax returns the larger of the two passed NumBytes values.
+func NumBytesMax(a, b NumBytes) NumBytes {
+	if a < b {
+		return b
+	}
+	return a
+}
+
 func (n NumBytes) String() string {
 	var base NumBytes
 	var suffix string
@@ -39,6 +39,25 @@ func TestNumBytesMin(t *testing.T) {
 	}
 }
 
+func TestNumBytesMax(t *testing.T) {
+	cases := []struct {
+		a    NumBytes
+		b    NumBytes
+		want NumBytes
+	}{
+		{1, 1, 1},
+		{100, -12, 100},
+		{100, 101, 101},
+		{0, 1, 1},
+	}
+
+	for _, c := range cases {
+		if got, want := NumBytesMax(c.a, c.b), c.want; got != want {
+			t.Errorf("NumBytesMax(%d, %d) = %d, want %d", c.a, c.b, got, want)
+		}
+	}
+}
+
 func TestNumBytes_String(t *testing.T) {
 	cases := []struct {
 		numBytes NumBytes